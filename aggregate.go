@@ -0,0 +1,298 @@
+package gostore
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// defaultTopTerms is the number of terms returned by an aggregate which asks for top terms without a size
+const defaultTopTerms = 10
+
+// TermCount is the number of rows in which a field has a value
+type TermCount struct {
+	Term  interface{} `json:"term"`
+	Count int         `json:"count"`
+}
+
+// NumberRangeCount is the number of rows whose field falls within [From, To). A nil bound is open
+type NumberRangeCount struct {
+	Name  string   `json:"name"`
+	From  *float64 `json:"from,omitempty"`
+	To    *float64 `json:"to,omitempty"`
+	Count int      `json:"count"`
+}
+
+// DateRangeCount is the number of rows whose date field falls within [From, To). A nil bound is open
+type DateRangeCount struct {
+	Name  string     `json:"name"`
+	From  *time.Time `json:"from,omitempty"`
+	To    *time.Time `json:"to,omitempty"`
+	Count int        `json:"count"`
+}
+
+// aggregation computes a Match over the rows of a query. It is built from an entry of the
+// aggregates map passed to Query:
+//
+//	"status": {"match": "=available|busy", "top": 5}
+//	"price": {"numberRange": [{"name": "cheap", "to": 10}, {"name": "pricey", "from": 10}]}
+//	"joined": {"field": "user.created", "dateRange": [{"from": "2017-01-01", "to": "2018-01-01"}]}
+//	"kind": "~^th"
+//
+// field defaults to the aggregate name and a string value is shorthand for match
+type aggregation struct {
+	name   string
+	field  []string
+	match  *FilterCondition
+	top    int
+	terms  map[string]*TermCount
+	order  []string
+	nums   []NumberRangeCount
+	dates  []DateRangeCount
+	result Match
+}
+
+// Aggregator accumulates the aggregates of a Query over rows fed to it one at a time
+type Aggregator struct {
+	aggs []*aggregation
+}
+
+// NewAggregator parses the aggregates argument of Query
+func NewAggregator(aggregates map[string]interface{}) (*Aggregator, error) {
+	a := &Aggregator{}
+	for _, name := range sortedFilterKeys(aggregates) {
+		agg, err := parseAggregation(name, aggregates[name])
+		if err != nil {
+			return nil, err
+		}
+		a.aggs = append(a.aggs, agg)
+	}
+	return a, nil
+}
+
+func parseAggregation(name string, spec interface{}) (*aggregation, error) {
+	opts, ok := spec.(map[string]interface{})
+	if !ok {
+		if s, isString := spec.(string); isString {
+			opts = map[string]interface{}{"match": s}
+		} else if spec == nil || spec == true {
+			opts = map[string]interface{}{}
+		} else {
+			return nil, &FilterError{Key: name, Value: spec, Reason: "aggregate must be a map or a match expression"}
+		}
+	}
+	field := name
+	if f, ok := opts["field"].(string); ok {
+		field = f
+	}
+	path, err := parseFilterPath(nil, field)
+	if err != nil {
+		return nil, err
+	}
+	agg := &aggregation{name: name, field: path, terms: make(map[string]*TermCount)}
+	agg.result.Field = field
+	if m, ok := opts["match"]; ok {
+		if agg.match, err = parseFilterCondition(path, m); err != nil {
+			return nil, err
+		}
+	}
+	if top, ok := opts["top"]; ok {
+		n, isNum := toFloat(top)
+		switch {
+		case top == true:
+			agg.top = defaultTopTerms
+		case isNum && n > 0:
+			agg.top = int(n)
+		default:
+			return nil, &FilterError{Key: name, Value: top, Reason: "top must be a positive number"}
+		}
+	}
+	if ranges, ok := opts["numberRange"]; ok {
+		if agg.nums, err = parseNumberRanges(name, ranges); err != nil {
+			return nil, err
+		}
+	}
+	if ranges, ok := opts["dateRange"]; ok {
+		if agg.dates, err = parseDateRanges(name, ranges); err != nil {
+			return nil, err
+		}
+	}
+	return agg, nil
+}
+
+func rangeSpecs(name string, ranges interface{}) ([]map[string]interface{}, error) {
+	list, ok := ranges.([]interface{})
+	if !ok {
+		if maps, ok := ranges.([]map[string]interface{}); ok {
+			return maps, nil
+		}
+		return nil, &FilterError{Key: name, Value: ranges, Reason: "ranges must be a list"}
+	}
+	specs := make([]map[string]interface{}, len(list))
+	for i, r := range list {
+		if specs[i], ok = r.(map[string]interface{}); !ok {
+			return nil, &FilterError{Key: name, Value: r, Reason: fmt.Sprintf("range %d is not a map", i)}
+		}
+	}
+	return specs, nil
+}
+
+func rangeName(spec map[string]interface{}) string {
+	if n, ok := spec["name"].(string); ok {
+		return n
+	}
+	from, to := "*", "*"
+	if v, ok := spec["from"]; ok {
+		from = fmt.Sprint(v)
+	}
+	if v, ok := spec["to"]; ok {
+		to = fmt.Sprint(v)
+	}
+	return from + "-" + to
+}
+
+func parseNumberRanges(name string, ranges interface{}) (counts []NumberRangeCount, err error) {
+	specs, err := rangeSpecs(name, ranges)
+	if err != nil {
+		return
+	}
+	for _, spec := range specs {
+		r := NumberRangeCount{Name: rangeName(spec)}
+		for bound, dst := range map[string]**float64{"from": &r.From, "to": &r.To} {
+			v, ok := spec[bound]
+			if !ok {
+				continue
+			}
+			f, ok := toFloat(v)
+			if !ok {
+				return nil, &FilterError{Key: name, Value: v, Reason: bound + " is not a number"}
+			}
+			*dst = &f
+		}
+		counts = append(counts, r)
+	}
+	return
+}
+
+func parseDateRanges(name string, ranges interface{}) (counts []DateRangeCount, err error) {
+	specs, err := rangeSpecs(name, ranges)
+	if err != nil {
+		return
+	}
+	for _, spec := range specs {
+		r := DateRangeCount{Name: rangeName(spec)}
+		for bound, dst := range map[string]**time.Time{"from": &r.From, "to": &r.To} {
+			v, ok := spec[bound]
+			if !ok {
+				continue
+			}
+			t, ok := v.(time.Time)
+			if !ok {
+				s, isString := v.(string)
+				if !isString {
+					return nil, &FilterError{Key: name, Value: v, Reason: bound + " is not a date"}
+				}
+				if t, err = parseFilterTime(s); err != nil {
+					return nil, &FilterError{Key: name, Value: v, Reason: err.Error()}
+				}
+			}
+			*dst = &t
+		}
+		counts = append(counts, r)
+	}
+	return
+}
+
+// Add counts a row in every aggregate
+func (a *Aggregator) Add(doc map[string]interface{}) {
+	for _, agg := range a.aggs {
+		agg.add(doc)
+	}
+}
+
+func (agg *aggregation) add(doc map[string]interface{}) {
+	val, ok := lookupField(doc, agg.field)
+	if !ok || val == nil {
+		agg.result.Missing++
+		return
+	}
+	if agg.match == nil || agg.match.Match(doc) {
+		agg.result.Matched++
+	} else {
+		agg.result.UnMatched++
+	}
+	if agg.top > 0 {
+		if vals, ok := val.([]interface{}); ok {
+			for _, v := range vals {
+				agg.addTerm(v)
+			}
+		} else {
+			agg.addTerm(val)
+		}
+	}
+	if f, ok := toFloat(val); ok {
+		for i := range agg.nums {
+			r := &agg.nums[i]
+			if (r.From == nil || f >= *r.From) && (r.To == nil || f < *r.To) {
+				r.Count++
+			}
+		}
+	}
+	if len(agg.dates) > 0 {
+		if t, ok := toTime(val); ok {
+			for i := range agg.dates {
+				r := &agg.dates[i]
+				if (r.From == nil || !t.Before(*r.From)) && (r.To == nil || t.Before(*r.To)) {
+					r.Count++
+				}
+			}
+		}
+	}
+}
+
+func (agg *aggregation) addTerm(val interface{}) {
+	b, ok := indexValue(val)
+	if !ok {
+		agg.result.Other++
+		return
+	}
+	key := string(b)
+	if tc, ok := agg.terms[key]; ok {
+		tc.Count++
+		return
+	}
+	agg.terms[key] = &TermCount{Term: val, Count: 1}
+	agg.order = append(agg.order, key)
+}
+
+// Result returns a Match for every aggregate keyed by the aggregate name
+func (a *Aggregator) Result() AggregateResult {
+	result := make(AggregateResult, len(a.aggs))
+	for _, agg := range a.aggs {
+		m := agg.result
+		if agg.top > 0 {
+			terms := make([]TermCount, 0, len(agg.order))
+			for _, key := range agg.order {
+				terms = append(terms, *agg.terms[key])
+			}
+			sort.SliceStable(terms, func(i, j int) bool {
+				return terms[i].Count > terms[j].Count
+			})
+			if len(terms) > agg.top {
+				for _, t := range terms[agg.top:] {
+					m.Other += t.Count
+				}
+				terms = terms[:agg.top]
+			}
+			m.Top = terms
+		}
+		if agg.nums != nil {
+			m.NumberRange = agg.nums
+		}
+		if agg.dates != nil {
+			m.DateRange = agg.dates
+		}
+		result[agg.name] = m
+	}
+	return result
+}
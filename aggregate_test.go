@@ -0,0 +1,78 @@
+package gostore
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAggregator(t *testing.T) {
+	Convey("Given some rows", t, func() {
+		rows := []map[string]interface{}{
+			{"status": "available", "price": 5, "tags": []interface{}{"a", "b"}, "created": "2017-03-01T00:00:00Z"},
+			{"status": "available", "price": 15, "tags": []interface{}{"a"}, "created": "2017-09-01T00:00:00Z"},
+			{"status": "busy", "price": 25, "created": "2018-03-01T00:00:00Z"},
+			{"status": "offline"},
+			{"price": 10},
+		}
+		Convey("Aggregates count terms, ranges and missing fields", func() {
+			agg, err := NewAggregator(map[string]interface{}{
+				"status": map[string]interface{}{"match": "=available|busy", "top": 2},
+				"price": map[string]interface{}{"numberRange": []interface{}{
+					map[string]interface{}{"name": "cheap", "to": 10},
+					map[string]interface{}{"from": 10},
+				}},
+				"year": map[string]interface{}{"field": "created", "dateRange": []interface{}{
+					map[string]interface{}{"name": "2017", "from": "2017-01-01T00:00:00Z", "to": "2018-01-01T00:00:00Z"},
+				}},
+				"tags": map[string]interface{}{"top": true},
+			})
+			So(err, ShouldBeNil)
+			for _, row := range rows {
+				agg.Add(row)
+			}
+			result := agg.Result()
+
+			status := result["status"].(Match)
+			So(status.Matched, ShouldEqual, 3)
+			So(status.UnMatched, ShouldEqual, 1)
+			So(status.Missing, ShouldEqual, 1)
+			So(status.Other, ShouldEqual, 1)
+			So(status.Top, ShouldResemble, []TermCount{{"available", 2}, {"busy", 1}})
+
+			price := result["price"].(Match)
+			So(price.Missing, ShouldEqual, 1)
+			ranges := price.NumberRange.([]NumberRangeCount)
+			So(ranges[0].Name, ShouldEqual, "cheap")
+			So(ranges[0].Count, ShouldEqual, 1)
+			So(ranges[1].Name, ShouldEqual, "10-*")
+			So(ranges[1].Count, ShouldEqual, 3)
+
+			year := result["year"].(Match)
+			So(year.Field, ShouldEqual, "created")
+			So(year.DateRange.([]DateRangeCount)[0].Count, ShouldEqual, 2)
+
+			So(result["tags"].(Match).Top, ShouldResemble, []TermCount{{"a", 2}, {"b", 1}})
+		})
+		Convey("Invalid aggregates are reported", func() {
+			_, err := NewAggregator(map[string]interface{}{"price": map[string]interface{}{"top": -1}})
+			So(err, ShouldNotBeNil)
+			_, err = NewAggregator(map[string]interface{}{"price": map[string]interface{}{"numberRange": []interface{}{map[string]interface{}{"from": "a"}}}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestBoltQuery(t *testing.T) {
+	Convey("Giving a bolt store with some things", t, func() {
+		store, done := newTestBoltStore()
+		defer done()
+		saveBoltThings(store)
+		Convey("Query returns a page of rows and aggregates over every match", func() {
+			rows, aggs, err := store.Query(map[string]interface{}{"rating": ">2"}, map[string]interface{}{"kind": map[string]interface{}{"top": 5}}, 1, 1, collection, nil)
+			So(err, ShouldBeNil)
+			So(rowIds(rows, nil), ShouldResemble, []string{"2"})
+			So(aggs["kind"].(Match).Top, ShouldResemble, []TermCount{{"thing", 2}, {"something", 1}})
+		})
+	})
+}
@@ -3,13 +3,15 @@ package gostore
 //TODO: Extract methods into functions
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"net/url"
 
 	"github.com/boltdb/bolt"
 	"github.com/dustin/gojson"
 	// "github.com/fatih/structs"
 	// "github.com/ventu-io/go-shortid"
 	"log"
-	"sync"
 	"time"
 )
 
@@ -19,10 +21,37 @@ type HasID interface {
 type BoltStore struct {
 	Bucket []byte
 	Db     *bolt.DB
+	codec  Codec
+	ctx    context.Context
+}
+
+func init() {
+	Register("bolt", DriverFunc(openBolt))
+}
+
+//openBolt opens bolt:///path/to/app.db, the codec parameter names the codec of the store
+func openBolt(u *url.URL) (ObjectStore, error) {
+	path, err := urlPath(u)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewBoltObjectStore(path)
+	if err != nil {
+		return nil, err
+	}
+	if name := u.Query().Get("codec"); name != "" {
+		codec, ok := CodecByName(name)
+		if !ok {
+			s.Db.Close()
+			return nil, fmt.Errorf("gostore: unknown codec %q", name)
+		}
+		s = s.WithCodec(codec)
+	}
+	return s, nil
 }
 
 func NewBoltStore(bucket string, db *bolt.DB) BoltStore {
-	e := BoltStore{[]byte(bucket), db}
+	e := BoltStore{Bucket: []byte(bucket), Db: db}
 	//	e.CreateBucket(bucket)
 	return e
 }
@@ -32,17 +61,27 @@ func NewBoltObjectStore(path string) (s BoltStore, err error) {
 	if err != nil {
 		return
 	}
-	s = BoltStore{[]byte("_default"), db}
+	s = BoltStore{Bucket: []byte("_default"), Db: db}
 	//	e.CreateBucket(bucket)
 	return
 }
 
+//Capabilities describes BoltStore, filters and aggregates are evaluated by gostore over the rows
+func (s BoltStore) Capabilities() Capabilities {
+	c := newCapabilities(s, "SaveAll", "Update", "Replace", "GetByFieldsByField", "BatchInsert")
+	c.FilterOperators = append([]FilterOperator{}, FilterOperators...)
+	c.Aggregates = true
+	return c
+}
+
 func (s BoltStore) CreateDatabase() error {
 	return nil
 }
 
-func (s BoltStore) CreateTable(table string, sample interface{}) error {
-	return nil
+//CreateTable creates the bucket of a table and any index listed in schema["index"]
+func (s BoltStore) CreateTable(table string, schema interface{}) error {
+	s.CreateBucket(table)
+	return s.ensureIndexes(table, schemaIndexes(schema))
 }
 
 func (s BoltStore) GetStore() interface{} {
@@ -50,7 +89,7 @@ func (s BoltStore) GetStore() interface{} {
 }
 
 func (s BoltStore) CreateBucket(bucket string) {
-	s.Db.Update(func(tx *bolt.Tx) error {
+	s.update(func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
 		if err != nil {
 			log.Fatalf("create bucket: %s", err)
@@ -106,254 +145,220 @@ func (s BoltStore) _PrefixGet(prefix []byte, resource string) (v [][]byte, err e
 
 func (s BoltStore) _Save(key []byte, data []byte, resource string) error {
 	s.CreateBucket(resource)
-	err := s.Db.Update(func(tx *bolt.Tx) error {
+	err := s.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(resource))
-		err := b.Put(key, data)
-		return err
+		codec, err := s.tableCodec(tx, resource)
+		if err != nil {
+			return err
+		}
+		if err = boltRowWritten(tx, resource, codec, key, b.Get(key), data); err != nil {
+			return err
+		}
+		return b.Put(key, data)
 	})
 	return err
 }
 
 func (s BoltStore) _Delete(key string, resource string) error {
 	s.CreateBucket(resource)
-	err := s.Db.Update(func(tx *bolt.Tx) error {
+	err := s.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(resource))
-		err := b.Delete([]byte(key))
-		return err
+		codec, err := s.tableCodec(tx, resource)
+		if err != nil {
+			return err
+		}
+		if err = boltRowWritten(tx, resource, codec, []byte(key), b.Get([]byte(key)), nil); err != nil {
+			return err
+		}
+		if err = deleteBoltGeohash(tx, resource, []byte(key)); err != nil {
+			return err
+		}
+		return b.Delete([]byte(key))
 	})
 	return err
 }
 
 func (s BoltStore) _DeleteAll(resource string) error {
 	s.CreateBucket(resource)
-	err := s.Db.Update(func(tx *bolt.Tx) error {
+	err := s.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(resource))
 		c := b.Cursor()
 		for k, _ := c.First(); k != nil; k, _ = c.Next() {
 			b.Delete(k)
 		}
-		return nil
+		for _, name := range [][]byte{boltGeoBucket(resource), boltGeoKeysBucket(resource)} {
+			if tx.Bucket(name) != nil {
+				if err := tx.DeleteBucket(name); err != nil {
+					return err
+				}
+			}
+		}
+		return clearBoltIndexes(tx, resource)
 	})
 	return err
 }
 
-func newBoltRows(rows [][][]byte) BoltRows {
-	total := len(rows)
-	closed := make(chan bool)
-	retrieved := make(chan string)
-	nextItem := make(chan interface{})
-	ci := 0
-	b := BoltRows{nextItem: nextItem, closed: closed, retrieved: retrieved}
-	go func() {
-	OUTER:
-		for {
-			select {
-			case <-closed:
-				logger.Info("newBoltRows closed")
-				break OUTER
-				return
-			case item := <-nextItem:
-				// logger.Info("current index", "ci", ci, "total", total)
-				if ci == total {
-					b.lastError = ErrEOF
-					// logger.Info("break bolt rows loop")
-					break OUTER
-					return
-				} else {
-					current := rows[ci]
-					if err := json.Unmarshal(current[1], item); err != nil {
-						logger.Warn(err.Error())
-						b.lastError = err
-						retrieved <- ""
-						break OUTER
-						return
-					} else {
-						retrieved <- string(current[0])
-						ci++
-					}
-				}
-			}
-		}
-		b.Close()
-	}()
-	return b
+//newBoltRows iterates over rows read by a query, newest first
+func newBoltRows(rows [][][]byte, codec Codec) *BoltRows {
+	return &BoltRows{rows: rows, codec: codec}
 }
 
-//New Api
+//newBoltCursorRows iterates lazily over a bucket, newest first. The rows own tx and roll it back
+//once they are exhausted or closed
+func newBoltCursorRows(tx *bolt.Tx, b *bolt.Bucket, codec Codec) *BoltRows {
+	return &BoltRows{tx: tx, cursor: b.Cursor(), codec: codec}
+}
+
+//boltRow copies a key and value out of a transaction, they are only valid for its life
+func boltRow(k, v []byte) [][]byte {
+	return [][]byte{append([]byte{}, k...), append([]byte{}, v...)}
+}
+
+//BoltRows iterates over the rows of a bolt table. It is not safe for concurrent use.
+//Rows read from a cursor hold a read transaction, which blocks Close of the database and
+//growth of the file, until they are exhausted or closed
 type BoltRows struct {
 	rows      [][][]byte
 	i         int
-	length    int
-	retrieved chan string
-	closed    chan bool
-	nextItem  chan interface{}
+	tx        *bolt.Tx
+	cursor    *bolt.Cursor
+	codec     Codec
 	lastError error
-	isClosed  bool
-	sync.RWMutex
+	closed    bool
+}
+
+//next returns the next key and value, it closes the rows once there are none left
+func (s *BoltRows) next() (k, v []byte) {
+	if s.closed || s.lastError != nil {
+		return nil, nil
+	}
+	if s.cursor != nil {
+		if s.i == 0 {
+			k, v = s.cursor.Last()
+		} else {
+			k, v = s.cursor.Prev()
+		}
+		s.i++
+	} else if s.i < len(s.rows) {
+		k, v = s.rows[s.i][0], s.rows[s.i][1]
+		s.i++
+	}
+	if k == nil {
+		s.Close()
+	}
+	return
 }
 
-func (s BoltRows) Next(dst interface{}) (bool, error) {
+//Next decodes the next row into dst and exposes its key as the id
+func (s *BoltRows) Next(dst interface{}) (bool, error) {
 	if s.lastError != nil {
 		return false, s.lastError
 	}
-	//NOTE: Consider saving id in bolt data
-	var _dst map[string]interface{}
-	s.nextItem <- &_dst
-	key := <-s.retrieved
-	if key == "" {
+	k, v := s.next()
+	if k == nil {
 		return false, nil
 	}
-	_dst["id"] = key
-	_data, _ := json.Marshal(&_dst)
-	json.Unmarshal(_data, dst)
+	if err := s.codec.Unmarshal(v, dst); err != nil {
+		logger.Warn("cannot decode bolt row", "key", string(k), "err", err)
+		s.lastError = err
+		s.Close()
+		return false, err
+	}
+	setRowKey(dst, string(k))
 	return true, nil
 }
-func (s BoltRows) NextRaw() ([]byte, bool) {
-	return nil, false
+
+//NextRaw returns the next row as stored, encoded with the codec of its table
+func (s *BoltRows) NextRaw() ([]byte, bool) {
+	k, v := s.next()
+	if k == nil {
+		return nil, false
+	}
+	return append([]byte{}, v...), true
 }
 
-func (s BoltRows) LastError() error {
+//LastError returns the error which stopped the iteration, it is nil when the rows were exhausted
+func (s *BoltRows) LastError() error {
 	return s.lastError
 }
-func (s BoltRows) Close() {
-	// s.rows = nil
-	// s.closed <- true
-	logger.Info("close bolt rows")
-	close(s.closed)
-	close(s.retrieved)
-	close(s.nextItem)
-	// s.isClosed = true
+
+//Close releases the rows and their transaction, it may be called more than once
+func (s *BoltRows) Close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.rows = nil
+	s.cursor = nil
+	if s.tx != nil {
+		if err := s.tx.Rollback(); err != nil && s.lastError == nil {
+			s.lastError = err
+		}
+		s.tx = nil
+	}
 }
 
 func (s BoltStore) All(count int, skip int, store string) (ObjectRows, error) {
-	_rows, err := s._GetAll(count, skip, store)
+	_rows, err := s._GetRange(nil, nil, count, skip, store)
 	// logger.Info("retrieved rows", "rows", _rows)
 	if err != nil {
 		return nil, err
 	}
-	return newBoltRows(_rows), nil
+	codec, err := s.readCodec(store)
+	if err != nil {
+		return nil, err
+	}
+	return newBoltRows(_rows, codec), nil
 }
 
-func (s BoltStore) _GetAll(count int, skip int, resource string) (objs [][][]byte, err error) {
+//_GetRange reads count rows after skipping skip rows with keys between lower and upper, newest
+//first. Both bounds are exclusive and nil bounds are open
+func (s BoltStore) _GetRange(lower, upper []byte, count int, skip int, resource string) (objs [][][]byte, err error) {
 	s.CreateBucket(resource)
-	err = s.Db.View(func(tx *bolt.Tx) error {
-		c := tx.Bucket([]byte(resource)).Cursor()
-		var skip_lim int = 1
-
-		var lim int = 0
-		//Skip a certain amount
-		if skip > 0 {
-			//make sure we hit the database once
-			var target_count int = skip - 1
-			for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
-				if skip_lim >= target_count {
-					break
-				}
-				skip_lim++
+	err = s.view(func(tx *bolt.Tx) error {
+		skipped := 0
+		return scanBucket(tx.Bucket([]byte(resource)), lower, upper, func(k, v []byte) (bool, error) {
+			if err := s.ctxErr(); err != nil {
+				return false, err
 			}
-		} else {
-			//no skip needed. Get first item
-			k, v := c.Last()
-			if k == nil {
-				return err
-			}
-			objs = append(objs, [][]byte{k, v})
-			lim++
-			if lim == count {
-				// logger.Info("count reached", "lim", lim, "count", count)
-				return nil
-			}
-		}
-		//Get next items after skipping or getting first item
-		for k, v := c.Prev(); k != nil; k, v = c.Prev() {
-			objs = append(objs, [][]byte{k, v})
-			lim++
-			if lim == count {
-				// logger.Info("count reached", "lim", lim, "count", count)
-				break
+			if skipped < skip {
+				skipped++
+				return true, nil
 			}
-		}
-		return err
+			objs = append(objs, boltRow(k, v))
+			return count < 1 || len(objs) < count, nil
+		})
 	})
-	logger.Info("_GetAll done")
 	return
 }
 
-func (s BoltStore) _GetAllAfter(key []byte, count int, skip int, resource string) (objs [][][]byte, err error) {
+//_GetAfter reads count rows after skipping skip rows with keys greater than key, oldest first
+func (s BoltStore) _GetAfter(key []byte, count int, skip int, resource string) (objs [][][]byte, err error) {
 	s.CreateBucket(resource)
-	err = s.Db.View(func(tx *bolt.Tx) error {
+	err = s.view(func(tx *bolt.Tx) error {
 		c := tx.Bucket([]byte(resource)).Cursor()
-		var lim int = 0
-		if skip > 0 {
-			var skip_lim int = 1
-			var target_count int = skip - 1
-			for k, _ := c.Seek(key); k != nil; k, _ = c.Next() {
-				log.Println("Skipped ", string(k), "Current lim is ", skip_lim, " target count is ", target_count)
-				if skip_lim >= target_count {
-					break
-				}
-				skip_lim++
-			}
-		} else {
-			//no skip needed. Get first item
-			k, v := c.Seek(key)
-			if k != nil {
-				objs = append(objs, [][]byte{k, v})
-				lim++
-			} else {
-				return err
-			}
-			if lim == count {
-				return nil
-			}
-		}
-		for k, v := c.Next(); k != nil; k, v = c.Next() {
-			objs = append(objs, [][]byte{k, v})
-			lim++
-			if lim == count {
-				break
-			}
+		k, v := c.Seek(key)
+		if k != nil && bytes.Equal(k, key) {
+			k, v = c.Next()
 		}
-		return err
-	})
-	return
-}
-
-func (s BoltStore) _GetAllBefore(key []byte, count int, skip int, resource string) (objs [][][]byte, err error) {
-	s.CreateBucket(resource)
-	err = s.Db.View(func(tx *bolt.Tx) error {
-		c := tx.Bucket([]byte(resource)).Cursor()
-		var lim int = 0
-		if skip > 0 {
-			var skip_lim int = 1
-			var target_count int = skip - 1
-			for k, _ := c.Seek(key); k != nil; k, _ = c.Prev() {
-				if skip_lim >= target_count {
-					break
-				}
-				skip_lim++
-			}
-		} else {
-			//no skip needed. Get first item
-			k, v := c.Seek(key)
-			if k != nil {
-				objs = append(objs, [][]byte{k, v})
-				lim++
-			} else {
+		for skipped := 0; k != nil; k, v = c.Next() {
+			if err := s.ctxErr(); err != nil {
 				return err
 			}
-			if lim == count {
-				return nil
+			if v == nil {
+				//nested bucket
+				continue
 			}
-		}
-		for k, v := c.Prev(); k != nil; k, v = c.Prev() {
-			objs = append(objs, [][]byte{k, v})
-			lim++
-			if lim == count {
+			if skipped < skip {
+				skipped++
+				continue
+			}
+			objs = append(objs, boltRow(k, v))
+			if count > 0 && len(objs) == count {
 				break
 			}
 		}
-		return err
+		return nil
 	})
 	return
 }
@@ -361,7 +366,7 @@ func (s BoltStore) _GetAllBefore(key []byte, count int, skip int, resource strin
 func (s BoltStore) _Filter(prefix []byte, count int, skip int, resource string) (objs [][][]byte, err error) {
 	s.CreateBucket(resource)
 	b_prefix := []byte(prefix)
-	err = s.Db.View(func(tx *bolt.Tx) error {
+	err = s.view(func(tx *bolt.Tx) error {
 		var lim int = 1
 		c := tx.Bucket([]byte(resource)).Cursor()
 		if skip > 0 {
@@ -377,7 +382,7 @@ func (s BoltStore) _Filter(prefix []byte, count int, skip int, resource string)
 			//no skip needed. Get first item
 			k, v := c.Seek(b_prefix)
 			if k != nil {
-				objs = append(objs, [][]byte{k, v})
+				objs = append(objs, boltRow(k, v))
 			} else {
 				return err
 			}
@@ -387,7 +392,7 @@ func (s BoltStore) _Filter(prefix []byte, count int, skip int, resource string)
 		}
 
 		for k, v := c.Next(); bytes.HasPrefix(k, b_prefix); k, v = c.Next() {
-			objs = append(objs, [][]byte{k, v})
+			objs = append(objs, boltRow(k, v))
 			lim++
 			if lim == count {
 				break
@@ -401,7 +406,7 @@ func (s BoltStore) _Filter(prefix []byte, count int, skip int, resource string)
 func (s BoltStore) FilterSuffix(suffix []byte, count int, resource string) (objs [][]byte, err error) {
 	s.CreateBucket(resource)
 	b_prefix := []byte(suffix)
-	err = s.Db.View(func(tx *bolt.Tx) error {
+	err = s.view(func(tx *bolt.Tx) error {
 		var lim int = 1
 		c := tx.Bucket([]byte(resource)).Cursor()
 		for k, v := c.Seek(b_prefix); bytes.HasPrefix(k, b_prefix); k, v = c.Next() {
@@ -423,7 +428,7 @@ func (s BoltStore) StreamFilter(key []byte, count int, resource string) chan []b
 	ch := make(chan []byte)
 	go func() {
 		b_prefix := []byte(key)
-		s.Db.View(func(tx *bolt.Tx) error {
+		s.view(func(tx *bolt.Tx) error {
 			var lim int = 1
 			c := tx.Bucket([]byte(resource)).Cursor()
 			for k, v := c.Seek(b_prefix); bytes.HasPrefix(k, b_prefix); k, v = c.Next() {
@@ -446,7 +451,7 @@ func (s BoltStore) StreamAll(count int, resource string) chan [][]byte {
 	//Uses channels to stream filtered keys
 	ch := make(chan [][]byte)
 	go func() {
-		s.Db.View(func(tx *bolt.Tx) error {
+		s.view(func(tx *bolt.Tx) error {
 			var lim int = 1
 			c := tx.Bucket([]byte(resource)).Cursor()
 			for k, v := c.Last(); k != nil; k, v = c.Prev() {
@@ -465,7 +470,7 @@ func (s BoltStore) StreamAll(count int, resource string) chan [][]byte {
 
 func (s BoltStore) Stats(bucket string) (data map[string]interface{}, err error) {
 	data = make(map[string]interface{})
-	err = s.Db.View(func(tx *bolt.Tx) error {
+	err = s.view(func(tx *bolt.Tx) error {
 		v := tx.Bucket([]byte(bucket)).Stats()
 		data["total_count"] = v.KeyN
 		return nil
@@ -473,34 +478,79 @@ func (s BoltStore) Stats(bucket string) (data map[string]interface{}, err error)
 	return
 }
 
-func (s BoltStore) AllCursor(store string) (ObjectRows, error) { return nil, ErrNotImplemented }
+//AllCursor reads every row of a table newest first without loading them up front. The rows hold a
+//read transaction and must be exhausted or closed
+func (s BoltStore) AllCursor(store string) (ObjectRows, error) {
+	s.CreateBucket(store)
+	if err := s.ctxErr(); err != nil {
+		return nil, err
+	}
+	tx, err := s.Db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := s.tableCodec(tx, store)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	b := tx.Bucket([]byte(store))
+	if b == nil {
+		tx.Rollback()
+		return nil, ErrNotFound
+	}
+	return newBoltCursorRows(tx, b, codec), nil
+}
 
 func (s BoltStore) AllWithinRange(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
-	return nil, ErrNotImplemented
+	return s.FilterGetAll(filter, count, skip, store, opts)
 }
+
+//Since returns rows with keys greater than id, oldest first
 func (s BoltStore) Since(id string, count int, skip int, store string) (ObjectRows, error) {
-	_rows, err := s._GetAllAfter([]byte(id), count, skip, store)
+	_rows, err := s._GetAfter([]byte(id), count, skip, store)
 	if err != nil {
 		return nil, err
 	}
-	return newBoltRows(_rows), nil
+	codec, err := s.readCodec(store)
+	if err != nil {
+		return nil, err
+	}
+	return newBoltRows(_rows, codec), nil
 } //Get all recent items from a key
+
+//Before returns rows with keys less than id, newest first
 func (s BoltStore) Before(id string, count int, skip int, store string) (ObjectRows, error) {
-	_rows, err := s._GetAllBefore([]byte(id), count, skip, store)
+	_rows, err := s._GetRange(nil, []byte(id), count, skip, store)
 	if err != nil {
 		return nil, err
 	}
-	return newBoltRows(_rows), nil
+	codec, err := s.readCodec(store)
+	if err != nil {
+		return nil, err
+	}
+	return newBoltRows(_rows, codec), nil
 } //Get all existing items before a key
 
+//FilterSince returns rows with keys greater than id which match the filter, newest first
 func (s BoltStore) FilterSince(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
-	return nil, ErrNotImplemented
+	_rows, codec, err := s.filterRows(store, filter, opts, []byte(id), nil, count, skip)
+	if err != nil {
+		return nil, err
+	}
+	return newBoltRows(_rows, codec), nil
 } //Get all recent items from a key
+
+//FilterBefore returns rows with keys less than id which match the filter, newest first
 func (s BoltStore) FilterBefore(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
-	return nil, ErrNotImplemented
+	_rows, codec, err := s.filterRows(store, filter, opts, nil, []byte(id), count, skip)
+	if err != nil {
+		return nil, err
+	}
+	return newBoltRows(_rows, codec), nil
 } //Get all existing items before a key
 func (s BoltStore) FilterBeforeCount(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (int64, error) {
-	return 0, ErrNotImplemented
+	return s.filterCount(store, filter, opts, nil, []byte(id))
 } //Get all existing items before a key
 
 func (s BoltStore) Get(key string, store string, dst interface{}) error {
@@ -508,19 +558,22 @@ func (s BoltStore) Get(key string, store string, dst interface{}) error {
 	if err != nil {
 		return err
 	}
-	if err := json.Unmarshal(data[1], dst); err != nil {
+	codec, err := s.readCodec(store)
+	if err != nil {
+		return err
+	}
+	if err := codec.Unmarshal(data[1], dst); err != nil {
 		return err
 	}
 	return nil
 }
 func (s BoltStore) Save(key, store string, src interface{}) (string, error) {
-	data, err := json.Marshal(src)
+	err := s.update(func(tx *bolt.Tx) error {
+		return s.putRow(tx, store, []byte(key), src)
+	})
 	if err != nil {
 		return "", err
 	}
-	if err := s._Save([]byte(key), data, store); err != nil {
-		return "", err
-	}
 	return key, nil
 }
 func (s BoltStore) SaveAll(store string, src ...interface{}) (keys []string, err error) {
@@ -534,47 +587,343 @@ func (s BoltStore) Delete(key string, store string) error {
 
 //Filter
 func (s BoltStore) FilterUpdate(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
-	return ErrNotImplemented
+	_, err := s.FilterUpdateResult(filter, src, store, opts, WriteOptions{})
+	return err
 }
 func (s BoltStore) FilterReplace(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
-	return ErrNotImplemented
+	replacement, err := toDoc(src)
+	if err != nil {
+		return err
+	}
+	_, err = s.filterWrite(store, filter, opts, false, func(doc map[string]interface{}) map[string]interface{} {
+		return replacement
+	})
+	return err
 }
+
+//FilterGet retrieves the newest row which matches the filter
 func (s BoltStore) FilterGet(filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
-	return ErrNotImplemented
+	_rows, codec, err := s.filterRows(store, filter, opts, nil, nil, 1, 0)
+	if err != nil {
+		return err
+	}
+	if len(_rows) == 0 {
+		return ErrNotFound
+	}
+	return codec.Unmarshal(_rows[0][1], dst)
 }
 func (s BoltStore) FilterGetAll(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
-	return nil, ErrNotImplemented
+	_rows, codec, err := s.filterRows(store, filter, opts, nil, nil, count, skip)
+	if err != nil {
+		return nil, err
+	}
+	return newBoltRows(_rows, codec), nil
 }
 func (s BoltStore) FilterDelete(filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
-	return ErrNotImplemented
+	_, err := s.FilterDeleteResult(filter, store, opts)
+	return err
 }
 func (s BoltStore) FilterCount(filter map[string]interface{}, store string, opts ObjectStoreOptions) (int64, error) {
-	// if data, err := s.Stats(store); err != nil {
-	// 	return 0, err
-	// } else {
-	// 	logger.Info("FilterCount", "data", data)
-	// 	return data["count"].(int64), nil
-	// }
-	return 0, ErrNotImplemented
+	return s.filterCount(store, filter, opts, nil, nil)
+}
+
+//Query retrieves matching rows like FilterGetAll and computes the aggregates over every matching row
+func (s BoltStore) Query(filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error) {
+	agg, err := NewAggregator(aggregates)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = s.prepareFilter(store, opts); err != nil {
+		return nil, nil, err
+	}
+	var objs [][][]byte
+	var codec Codec
+	matched := 0
+	err = s.view(func(tx *bolt.Tx) (err error) {
+		if codec, err = s.tableCodec(tx, store); err != nil {
+			return
+		}
+		return s.scanFilter(tx, store, codec, filter, nil, nil, func(k, v []byte, doc map[string]interface{}) (bool, error) {
+			agg.Add(doc)
+			if matched >= skip && (count < 1 || len(objs) < count) {
+				objs = append(objs, boltRow(k, v))
+			}
+			matched++
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return newBoltRows(objs, codec), agg.Result(), nil
+}
+
+//scanBucket walks a bucket from the newest key to the oldest. Both bounds are exclusive and a nil
+//bound leaves that side open. The scan stops when fn returns false
+func scanBucket(b *bolt.Bucket, lower, upper []byte, fn func(k, v []byte) (bool, error)) error {
+	c := b.Cursor()
+	var k, v []byte
+	if upper == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Seek(upper)
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+	}
+	for ; k != nil; k, v = c.Prev() {
+		if lower != nil && bytes.Compare(k, lower) <= 0 {
+			break
+		}
+		if v == nil {
+			//nested bucket
+			continue
+		}
+		next, err := fn(k, v)
+		if err != nil || !next {
+			return err
+		}
+	}
+	return nil
+}
+
+//decodeBoltDoc decodes a stored row, the key is exposed as the id field like rows returned by Next
+func decodeBoltDoc(codec Codec, k, v []byte) (doc map[string]interface{}, err error) {
+	if err = codec.Unmarshal(v, &doc); err != nil {
+		return
+	}
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+	if _, ok := doc["id"]; !ok {
+		doc["id"] = string(k)
+	}
+	return
+}
+
+//toDoc converts a source object into a document map
+func toDoc(src interface{}) (doc map[string]interface{}, err error) {
+	if m, ok := src.(map[string]interface{}); ok {
+		return m, nil
+	}
+	if m, ok := src.(*map[string]interface{}); ok {
+		return *m, nil
+	}
+	data, err := json.Marshal(src)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &doc)
+	return
+}
+
+//scanFilter calls fn for every row matching the filter, newest first. Rows are read through an
+//index when the filter has equality conditions on indexed fields
+func (s BoltStore) scanFilter(tx *bolt.Tx, store string, codec Codec, filter map[string]interface{}, lower, upper []byte, fn func(k, v []byte, doc map[string]interface{}) (bool, error)) error {
+	expr, err := ParseFilter(filter)
+	if err != nil {
+		return err
+	}
+	return s.scanExpr(tx, store, codec, expr, lower, upper, fn)
+}
+
+//scanExpr calls fn for every row matching a parsed filter, like scanFilter
+func (s BoltStore) scanExpr(tx *bolt.Tx, store string, codec Codec, expr *FilterGroup, lower, upper []byte, fn func(k, v []byte, doc map[string]interface{}) (bool, error)) error {
+	match := func(k, v []byte) (bool, error) {
+		if err := s.ctxErr(); err != nil {
+			return false, err
+		}
+		doc, err := decodeBoltDoc(codec, k, v)
+		if err != nil {
+			return false, err
+		}
+		if !expr.Match(doc) {
+			return true, nil
+		}
+		return fn(k, v, doc)
+	}
+	b := tx.Bucket([]byte(store))
+	idxs, err := loadBoltIndexes(tx, store)
+	if err != nil {
+		return err
+	}
+	if idx, prefixes := planBoltIndex(expr, idxs); idx != nil {
+		if ib := tx.Bucket(boltIndexBucket(store, idx.Name)); ib != nil {
+			for _, k := range indexKeys(ib, prefixes, lower, upper) {
+				v := b.Get(k)
+				if v == nil {
+					continue
+				}
+				if next, err := match(k, v); err != nil || !next {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return scanBucket(b, lower, upper, match)
+}
+
+//prepareFilter creates the table bucket and any index requested through opts
+func (s BoltStore) prepareFilter(store string, opts ObjectStoreOptions) error {
+	s.CreateBucket(store)
+	if opts == nil {
+		return nil
+	}
+	return s.ensureIndexes(store, opts.GetIndexes())
+}
+
+//filterRows retrieves matching rows newest first with the codec they are encoded with. A count less
+//than 1 retrieves all matches after skip
+func (s BoltStore) filterRows(store string, filter map[string]interface{}, opts ObjectStoreOptions, lower, upper []byte, count, skip int) (objs [][][]byte, codec Codec, err error) {
+	if err = s.prepareFilter(store, opts); err != nil {
+		return
+	}
+	err = s.view(func(tx *bolt.Tx) (err error) {
+		if codec, err = s.tableCodec(tx, store); err != nil {
+			return
+		}
+		skipped := 0
+		return s.scanFilter(tx, store, codec, filter, lower, upper, func(k, v []byte, doc map[string]interface{}) (bool, error) {
+			if skipped < skip {
+				skipped++
+				return true, nil
+			}
+			//bolt reuses k and v after the transaction closes
+			objs = append(objs, boltRow(k, v))
+			return count < 1 || len(objs) < count, nil
+		})
+	})
+	return
+}
+
+func (s BoltStore) filterCount(store string, filter map[string]interface{}, opts ObjectStoreOptions, lower, upper []byte) (cnt int64, err error) {
+	if err = s.prepareFilter(store, opts); err != nil {
+		return
+	}
+	err = s.view(func(tx *bolt.Tx) error {
+		codec, err := s.tableCodec(tx, store)
+		if err != nil {
+			return err
+		}
+		return s.scanFilter(tx, store, codec, filter, lower, upper, func(k, v []byte, doc map[string]interface{}) (bool, error) {
+			cnt++
+			return true, nil
+		})
+	})
+	return
+}
+
+//filterWrite rewrites every matching row with the document returned by change, a nil document deletes the row.
+//A dry run only counts the rows
+func (s BoltStore) filterWrite(store string, filter map[string]interface{}, opts ObjectStoreOptions, dryRun bool, change func(doc map[string]interface{}) map[string]interface{}) (result WriteResult, err error) {
+	if err = s.prepareFilter(store, opts); err != nil {
+		return
+	}
+	err = s.update(func(tx *bolt.Tx) error {
+		result = WriteResult{}
+		codec, err := s.tableCodec(tx, store)
+		if err != nil {
+			return err
+		}
+		var keys [][]byte
+		var docs []map[string]interface{}
+		//collect changes first, modifying a bucket invalidates its cursors
+		err = s.scanFilter(tx, store, codec, filter, nil, nil, func(k, v []byte, doc map[string]interface{}) (bool, error) {
+			result.Matched++
+			changed, modified, err := changeDoc(doc, change)
+			switch {
+			case err != nil:
+				return false, err
+			case changed == nil:
+				result.Deleted++
+			case !modified:
+				result.Unchanged++
+				return true, nil
+			default:
+				result.Updated++
+			}
+			keys = append(keys, append([]byte{}, k...))
+			docs = append(docs, changed)
+			return true, nil
+		})
+		if err != nil || dryRun {
+			return err
+		}
+		b := tx.Bucket([]byte(store))
+		for i, k := range keys {
+			var data []byte
+			if docs[i] != nil {
+				if data, err = codec.Marshal(docs[i]); err != nil {
+					return err
+				}
+			}
+			if err = boltRowWritten(tx, store, codec, k, b.Get(k), data); err != nil {
+				return err
+			}
+			if data == nil {
+				if err = deleteBoltGeohash(tx, store, k); err == nil {
+					err = b.Delete(k)
+				}
+			} else {
+				err = b.Put(k, data)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
 }
 
 //Misc gets
-func (s BoltStore) GetByField(name, val, store string, dst interface{}) error { return nil }
+//GetByField retrieves the newest row whose field equals val, the field may be a nested path
+func (s BoltStore) GetByField(name, val, store string, dst interface{}) error {
+	s.CreateBucket(store)
+	expr := fieldFilter(name, val)
+	var found []byte
+	var codec Codec
+	err := s.view(func(tx *bolt.Tx) (err error) {
+		if codec, err = s.tableCodec(tx, store); err != nil {
+			return
+		}
+		return s.scanExpr(tx, store, codec, expr, nil, nil, func(k, v []byte, doc map[string]interface{}) (bool, error) {
+			found = append([]byte{}, v...)
+			return false, nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if found == nil {
+		return ErrNotFound
+	}
+	return codec.Unmarshal(found, dst)
+}
+
 func (s BoltStore) GetByFieldsByField(name, val, store string, fields []string, dst interface{}) (err error) {
 	return ErrNotImplemented
 }
 
+//BatchFilterDelete removes rows matching any of the filters
 func (s BoltStore) BatchFilterDelete(filter []map[string]interface{}, store string, opts ObjectStoreOptions) (err error) {
-	return ErrNotImplemented
+	_, err = s.BatchFilterDeleteResult(filter, store, opts)
+	return
 }
 
+//BatchDelete removes rows by key, keys which do not exist are ignored
 func (s BoltStore) BatchDelete(ids []interface{}, store string, opts ObjectStoreOptions) (err error) {
-	return ErrNotImplemented
+	_, err = s.BatchDeleteResult(ids, store, opts)
+	return
 }
 
-//BatchUpdate updates multiple rows by id
+//BatchUpdate updates multiple rows by id, nothing is updated when a row does not exist
 func (s BoltStore) BatchUpdate(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) (err error) {
-	return ErrNotImplemented
+	_, err = s.batchUpdate(ids, data, store, true)
+	return
 }
 
 func (s BoltStore) BatchFilterUpdate(filter []map[string]interface{}, updateData map[string]interface{}, store string, opts ObjectStoreOptions) (err error) {
@@ -597,4 +946,11 @@ func (s BoltStore) BatchFilterUpdate(filter []map[string]interface{}, updateData
 func (s BoltStore) BatchInsert(data []interface{}, store string, opts ObjectStoreOptions) (keys []string, err error) {
 	return nil, ErrNotImplemented
 }
-func (s BoltStore) Close() {}
+
+//Close ends the change feeds of the store and closes the bolt database
+func (s BoltStore) Close() {
+	if s.Db != nil {
+		closeLocal(s.Db)
+		s.Db.Close()
+	}
+}
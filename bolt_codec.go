@@ -0,0 +1,89 @@
+package gostore
+
+import (
+	"github.com/boltdb/bolt"
+)
+
+// boltCodecKey is the key in the meta bucket recording the codec of a table
+func boltCodecKey(store string) []byte {
+	return []byte("codec." + store)
+}
+
+// WithCodec returns a copy of the store which encodes rows with c. A table keeps the codec it was
+// first written with, using it through a store with another codec fails with ErrCodecMismatch
+func (s BoltStore) WithCodec(c Codec) BoltStore {
+	s.codec = c
+	return s
+}
+
+// Codec returns the codec of the store, JSONCodec unless another was set with WithCodec
+func (s BoltStore) Codec() Codec {
+	if s.codec == nil {
+		return JSONCodec
+	}
+	return s.codec
+}
+
+// tableCodec returns the codec the rows of a table are encoded with and records it when a
+// writable transaction first uses the table. Tables with rows but no codec were written before
+// codecs were recorded and hold JSON
+func (s BoltStore) tableCodec(tx *bolt.Tx, store string) (Codec, error) {
+	codec := s.Codec()
+	name, recorded := "", false
+	if meta := tx.Bucket(boltMetaBucket); meta != nil {
+		if v := meta.Get(boltCodecKey(store)); v != nil {
+			name, recorded = string(v), true
+		}
+	}
+	if !recorded {
+		name = codec.Name()
+		if b := tx.Bucket([]byte(store)); b != nil {
+			if k, _ := b.Cursor().First(); k != nil {
+				name = JSONCodec.Name()
+			}
+		}
+	}
+	if name != codec.Name() {
+		logger.Warn("table codec differs from store codec", "table", store, "tableCodec", name, "storeCodec", codec.Name())
+		return nil, ErrCodecMismatch
+	}
+	if !recorded && tx.Writable() {
+		meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+		if err != nil {
+			return nil, err
+		}
+		if err = meta.Put(boltCodecKey(store), []byte(name)); err != nil {
+			return nil, err
+		}
+	}
+	return codec, nil
+}
+
+// readCodec returns the codec of a table in a read transaction of its own
+func (s BoltStore) readCodec(store string) (codec Codec, err error) {
+	err = s.view(func(tx *bolt.Tx) (err error) {
+		codec, err = s.tableCodec(tx, store)
+		return
+	})
+	return
+}
+
+// putRow encodes and writes a row, updating the indexes of its table
+func (s BoltStore) putRow(tx *bolt.Tx, store string, key []byte, src interface{}) error {
+	codec, err := s.tableCodec(tx, store)
+	if err != nil {
+		return err
+	}
+	data, err := codec.Marshal(src)
+	if err != nil {
+		return err
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(store))
+	if err != nil {
+		return err
+	}
+	if err = boltRowWritten(tx, store, codec, key, b.Get(key), data); err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
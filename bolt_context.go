@@ -0,0 +1,168 @@
+package gostore
+
+import (
+	"context"
+
+	"github.com/boltdb/bolt"
+)
+
+// withContext returns a copy of the store whose transactions and scans fail once ctx is done.
+// Rows returned by AllCursor keep their read transaction until they are closed
+func (s BoltStore) withContext(ctx context.Context) BoltStore {
+	s.ctx = ctx
+	return s
+}
+
+// ctxErr returns the error of the context the store is bound to once it is done
+func (s BoltStore) ctxErr() error {
+	if s.ctx == nil {
+		return nil
+	}
+	return s.ctx.Err()
+}
+
+// view runs a read transaction unless the context of the store is done
+func (s BoltStore) view(fn func(*bolt.Tx) error) error {
+	if err := s.ctxErr(); err != nil {
+		return err
+	}
+	return s.Db.View(fn)
+}
+
+// update runs a read-write transaction unless the context of the store is done
+func (s BoltStore) update(fn func(*bolt.Tx) error) error {
+	if err := s.ctxErr(); err != nil {
+		return err
+	}
+	return s.Db.Update(fn)
+}
+
+func (s BoltStore) CreateDatabaseContext(ctx context.Context) error {
+	return s.withContext(ctx).CreateDatabase()
+}
+
+func (s BoltStore) CreateTableContext(ctx context.Context, table string, sample interface{}) error {
+	return s.withContext(ctx).CreateTable(table, sample)
+}
+
+func (s BoltStore) StatsContext(ctx context.Context, store string) (map[string]interface{}, error) {
+	return s.withContext(ctx).Stats(store)
+}
+
+func (s BoltStore) AllContext(ctx context.Context, count int, skip int, store string) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).All(count, skip, store)
+	return contextRows(ctx, rows, err)
+}
+
+func (s BoltStore) AllCursorContext(ctx context.Context, store string) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).AllCursor(store)
+	return contextRows(ctx, rows, err)
+}
+
+func (s BoltStore) AllWithinRangeContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).AllWithinRange(filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (s BoltStore) SinceContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).Since(id, count, skip, store)
+	return contextRows(ctx, rows, err)
+}
+
+func (s BoltStore) BeforeContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).Before(id, count, skip, store)
+	return contextRows(ctx, rows, err)
+}
+
+func (s BoltStore) FilterSinceContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).FilterSince(id, filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (s BoltStore) FilterBeforeContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).FilterBefore(id, filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (s BoltStore) FilterBeforeCountContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.withContext(ctx).FilterBeforeCount(id, filter, count, skip, store, opts)
+}
+
+func (s BoltStore) GetContext(ctx context.Context, key string, store string, dst interface{}) error {
+	return s.withContext(ctx).Get(key, store, dst)
+}
+
+func (s BoltStore) SaveContext(ctx context.Context, key, store string, src interface{}) (string, error) {
+	return s.withContext(ctx).Save(key, store, src)
+}
+
+func (s BoltStore) SaveAllContext(ctx context.Context, store string, src ...interface{}) ([]string, error) {
+	return s.withContext(ctx).SaveAll(store, src...)
+}
+
+func (s BoltStore) UpdateContext(ctx context.Context, key string, store string, src interface{}) error {
+	return s.withContext(ctx).Update(key, store, src)
+}
+
+func (s BoltStore) ReplaceContext(ctx context.Context, key string, store string, src interface{}) error {
+	return s.withContext(ctx).Replace(key, store, src)
+}
+
+func (s BoltStore) DeleteContext(ctx context.Context, key string, store string) error {
+	return s.withContext(ctx).Delete(key, store)
+}
+
+func (s BoltStore) FilterUpdateContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).FilterUpdate(filter, src, store, opts)
+}
+
+func (s BoltStore) FilterReplaceContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).FilterReplace(filter, src, store, opts)
+}
+
+func (s BoltStore) FilterGetContext(ctx context.Context, filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).FilterGet(filter, store, dst, opts)
+}
+
+func (s BoltStore) FilterGetAllContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).FilterGetAll(filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (s BoltStore) QueryContext(ctx context.Context, filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error) {
+	rows, agg, err := s.withContext(ctx).Query(filter, aggregates, count, skip, store, opts)
+	rows, err = contextRows(ctx, rows, err)
+	return rows, agg, err
+}
+
+func (s BoltStore) FilterDeleteContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).FilterDelete(filter, store, opts)
+}
+
+func (s BoltStore) FilterCountContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.withContext(ctx).FilterCount(filter, store, opts)
+}
+
+func (s BoltStore) GetByFieldContext(ctx context.Context, name, val, store string, dst interface{}) error {
+	return s.withContext(ctx).GetByField(name, val, store, dst)
+}
+
+func (s BoltStore) GetByFieldsByFieldContext(ctx context.Context, name, val, store string, fields []string, dst interface{}) error {
+	return s.withContext(ctx).GetByFieldsByField(name, val, store, fields, dst)
+}
+
+func (s BoltStore) BatchDeleteContext(ctx context.Context, ids []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).BatchDelete(ids, store, opts)
+}
+
+func (s BoltStore) BatchUpdateContext(ctx context.Context, ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).BatchUpdate(ids, data, store, opts)
+}
+
+func (s BoltStore) BatchFilterDeleteContext(ctx context.Context, filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).BatchFilterDelete(filter, store, opts)
+}
+
+func (s BoltStore) BatchInsertContext(ctx context.Context, data []interface{}, store string, opts ObjectStoreOptions) ([]string, error) {
+	return s.withContext(ctx).BatchInsert(data, store, opts)
+}
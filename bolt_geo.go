@@ -0,0 +1,140 @@
+package gostore
+
+import (
+	"bytes"
+
+	"github.com/boltdb/bolt"
+)
+
+// boltGeoBucket maps geohash+0x00+key to key for the rows of a table saved with SaveWithGeo
+func boltGeoBucket(store string) []byte {
+	return []byte("_geo." + store)
+}
+
+// boltGeoKeysBucket maps the key of a row to its geohash so the entry can be replaced
+func boltGeoKeysBucket(store string) []byte {
+	return []byte("_geokeys." + store)
+}
+
+// putBoltGeohash records the geohash of a row, replacing any previous one
+func putBoltGeohash(tx *bolt.Tx, store string, key []byte, hash string) error {
+	gb, err := tx.CreateBucketIfNotExists(boltGeoBucket(store))
+	if err != nil {
+		return err
+	}
+	kb, err := tx.CreateBucketIfNotExists(boltGeoKeysBucket(store))
+	if err != nil {
+		return err
+	}
+	if err = deleteBoltGeohash(tx, store, key); err != nil {
+		return err
+	}
+	if err = gb.Put(append(append([]byte(hash), indexSep), key...), key); err != nil {
+		return err
+	}
+	return kb.Put(key, []byte(hash))
+}
+
+// deleteBoltGeohash removes the geohash of a row if it has one
+func deleteBoltGeohash(tx *bolt.Tx, store string, key []byte) error {
+	gb, kb := tx.Bucket(boltGeoBucket(store)), tx.Bucket(boltGeoKeysBucket(store))
+	if gb == nil || kb == nil {
+		return nil
+	}
+	hash := kb.Get(key)
+	if hash == nil {
+		return nil
+	}
+	if err := gb.Delete(append(append(append([]byte{}, hash...), indexSep), key...)); err != nil {
+		return err
+	}
+	return kb.Delete(key)
+}
+
+// saveGeo writes a row and its geohash in one transaction
+func (s BoltStore) saveGeo(tx *bolt.Tx, key, store string, src interface{}, field string) error {
+	doc, err := toDoc(src)
+	if err != nil {
+		return err
+	}
+	lon, lat, ok := locationOf(doc[field])
+	if !ok {
+		return ErrInvalidLocation
+	}
+	k := []byte(key)
+	if err = s.putRow(tx, store, k, src); err != nil {
+		return err
+	}
+	return putBoltGeohash(tx, store, k, encodeGeohash(lat, lon, geohashPrecision))
+}
+
+// SaveWithGeo saves src and indexes the geohash of its location field
+func (s BoltStore) SaveWithGeo(key, store string, src interface{}, field string) (string, error) {
+	err := s.update(func(tx *bolt.Tx) error {
+		return s.saveGeo(tx, key, store, src, field)
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// SaveWithGeoTX saves src and indexes the geohash of its location field in a transaction
+func (s BoltStore) SaveWithGeoTX(key, store string, src interface{}, field string, txn Transaction) error {
+	tx, err := boltTx(txn)
+	if err != nil {
+		return err
+	}
+	return s.saveGeo(tx, key, store, src, field)
+}
+
+// GeoQuery retrieves rows saved with SaveWithGeo within distance (e.g "5km", "300m") of a point,
+// nearest first. Rows in the geohash cells around the point are refined by their exact distance
+// and must match query. Each row has the distance in meters in its _distance field
+func (s BoltStore) GeoQuery(lon, lat float64, distance string, query map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	q, err := newGeohashQuery(lon, lat, distance, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	var codec Codec
+	err = s.view(func(tx *bolt.Tx) (err error) {
+		if codec, err = s.tableCodec(tx, store); err != nil {
+			return
+		}
+		b, gb := tx.Bucket([]byte(store)), tx.Bucket(boltGeoBucket(store))
+		if b == nil || gb == nil {
+			return nil
+		}
+		c := gb.Cursor()
+		for _, cell := range q.cells() {
+			prefix := []byte(cell)
+			for k, key := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, key = c.Next() {
+				if err := s.ctxErr(); err != nil {
+					return err
+				}
+				v := b.Get(key)
+				if v == nil {
+					continue
+				}
+				doc, err := decodeBoltDoc(codec, key, v)
+				if err != nil {
+					return err
+				}
+				q.add(string(key), doc)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var objs [][][]byte
+	for _, m := range q.results(count, skip) {
+		data, err := codec.Marshal(m.doc)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, [][]byte{[]byte(m.key), data})
+	}
+	return newBoltRows(objs, codec), nil
+}
@@ -0,0 +1,375 @@
+package gostore
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"github.com/dustin/gojson"
+)
+
+// boltMetaBucket holds gostore metadata such as index definitions for every table
+var boltMetaBucket = []byte("_gostore")
+
+// indexSep separates index values and the primary key in an index entry
+const indexSep = 0x00
+
+// boltIndex is a secondary index over one or more fields of a table. An index entry is
+// stored as value[0x00value...]0x00key in a bucket of its own
+type boltIndex struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+}
+
+func boltIndexesKey(store string) []byte {
+	return []byte("indexes." + store)
+}
+
+func boltIndexBucket(store, name string) []byte {
+	return []byte("_index." + store + "." + name)
+}
+
+// newBoltIndexes follows the rethinkdb convention where an index without fields indexes the
+// field with the same name and a compound index lists its fields, e.g name_id: [name, id]
+func newBoltIndexes(indexes map[string][]string) []boltIndex {
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	idxs := make([]boltIndex, len(names))
+	for i, name := range names {
+		fields := indexes[name]
+		if len(fields) == 0 {
+			fields = []string{name}
+		}
+		idxs[i] = boltIndex{name, fields}
+	}
+	return idxs
+}
+
+// schemaIndexes reads the index definitions of a CreateTable schema
+func schemaIndexes(schema interface{}) map[string][]string {
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	indexes := make(map[string][]string)
+	switch ix := s["index"].(type) {
+	case map[string][]string:
+		return ix
+	case map[string]interface{}:
+		for name, _vals := range ix {
+			var fields []string
+			switch vals := _vals.(type) {
+			case []string:
+				fields = vals
+			case []interface{}:
+				for _, v := range vals {
+					if f, ok := v.(string); ok {
+						fields = append(fields, f)
+					}
+				}
+			}
+			indexes[name] = fields
+		}
+	}
+	return indexes
+}
+
+func loadBoltIndexes(tx *bolt.Tx, store string) (idxs []boltIndex, err error) {
+	meta := tx.Bucket(boltMetaBucket)
+	if meta == nil {
+		return
+	}
+	if data := meta.Get(boltIndexesKey(store)); data != nil {
+		err = json.Unmarshal(data, &idxs)
+	}
+	return
+}
+
+// ensureIndexes creates any missing index of a table and builds it from the existing rows
+func (s BoltStore) ensureIndexes(store string, indexes map[string][]string) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	wanted := newBoltIndexes(indexes)
+	missing := false
+	err := s.view(func(tx *bolt.Tx) error {
+		existing, err := loadBoltIndexes(tx, store)
+		if err != nil {
+			return err
+		}
+		missing = len(mergeBoltIndexes(existing, wanted)) != len(existing)
+		return nil
+	})
+	if err != nil || !missing {
+		return err
+	}
+	return s.update(func(tx *bolt.Tx) error {
+		codec, err := s.tableCodec(tx, store)
+		if err != nil {
+			return err
+		}
+		return createBoltIndexes(tx, store, codec, wanted)
+	})
+}
+
+// createBoltIndexes creates the wanted indexes which do not exist yet in a writable transaction
+func createBoltIndexes(tx *bolt.Tx, store string, codec Codec, wanted []boltIndex) error {
+	existing, err := loadBoltIndexes(tx, store)
+	if err != nil {
+		return err
+	}
+	all := mergeBoltIndexes(existing, wanted)
+	if len(all) == len(existing) {
+		return nil
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(store))
+	if err != nil {
+		return err
+	}
+	for _, idx := range all[len(existing):] {
+		ib, err := tx.CreateBucketIfNotExists(boltIndexBucket(store, idx.Name))
+		if err != nil {
+			return err
+		}
+		err = b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return nil
+			}
+			doc, err := decodeBoltDoc(codec, k, v)
+			if err != nil {
+				return err
+			}
+			if entry := idx.entry(k, doc); entry != nil {
+				return ib.Put(entry, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return meta.Put(boltIndexesKey(store), data)
+}
+
+// mergeBoltIndexes appends the wanted indexes which do not exist yet
+func mergeBoltIndexes(existing, wanted []boltIndex) []boltIndex {
+	all := append([]boltIndex{}, existing...)
+OUTER:
+	for _, w := range wanted {
+		for _, e := range existing {
+			if e.Name == w.Name {
+				continue OUTER
+			}
+		}
+		all = append(all, w)
+	}
+	return all
+}
+
+// indexValue encodes a document value for an index entry, only scalars are indexed
+func indexValue(val interface{}) ([]byte, bool) {
+	switch v := val.(type) {
+	case string:
+		return []byte(v), true
+	case bool:
+		return []byte(strconv.FormatBool(v)), true
+	}
+	if f, ok := toFloat(val); ok {
+		return []byte(strconv.FormatFloat(f, 'g', -1, 64)), true
+	}
+	return nil, false
+}
+
+// filterIndexValue encodes an equality operand the same way indexValue encodes a document value
+func filterIndexValue(v FilterValue) ([]byte, bool) {
+	switch v.Kind {
+	case StringValue:
+		return indexValue(v.Str)
+	case NumberValue:
+		return indexValue(v.Number)
+	case BoolValue:
+		return indexValue(v.Bool)
+	}
+	return nil, false
+}
+
+// entry returns the index entry of a document or nil when one of the indexed fields is missing
+func (idx boltIndex) entry(key []byte, doc map[string]interface{}) []byte {
+	var entry []byte
+	for _, field := range idx.Fields {
+		val, ok := lookupField(doc, splitFieldPath(field))
+		if !ok {
+			return nil
+		}
+		b, ok := indexValue(val)
+		if !ok {
+			return nil
+		}
+		entry = append(append(entry, b...), indexSep)
+	}
+	return append(entry, key...)
+}
+
+func splitFieldPath(field string) []string {
+	path, err := parseFilterPath(nil, field)
+	if err != nil {
+		return []string{field}
+	}
+	return path
+}
+
+// updateBoltIndexes replaces the index entries of the old version of a row with those of the new
+// one. It runs in the transaction which writes the row, a nil value means the row does not exist
+func updateBoltIndexes(tx *bolt.Tx, store string, codec Codec, key, oldValue, newValue []byte) error {
+	idxs, err := loadBoltIndexes(tx, store)
+	if err != nil || len(idxs) == 0 {
+		return err
+	}
+	var oldDoc, newDoc map[string]interface{}
+	if oldValue != nil {
+		if oldDoc, err = decodeBoltDoc(codec, key, oldValue); err != nil {
+			return err
+		}
+	}
+	if newValue != nil {
+		if newDoc, err = decodeBoltDoc(codec, key, newValue); err != nil {
+			return err
+		}
+	}
+	for _, idx := range idxs {
+		ib := tx.Bucket(boltIndexBucket(store, idx.Name))
+		if ib == nil {
+			continue
+		}
+		var oldEntry, newEntry []byte
+		if oldDoc != nil {
+			oldEntry = idx.entry(key, oldDoc)
+		}
+		if newDoc != nil {
+			newEntry = idx.entry(key, newDoc)
+		}
+		if bytes.Equal(oldEntry, newEntry) {
+			continue
+		}
+		if oldEntry != nil {
+			if err = ib.Delete(oldEntry); err != nil {
+				return err
+			}
+		}
+		if newEntry != nil {
+			if err = ib.Put(newEntry, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// clearBoltIndexes empties every index of a table
+func clearBoltIndexes(tx *bolt.Tx, store string) error {
+	idxs, err := loadBoltIndexes(tx, store)
+	if err != nil {
+		return err
+	}
+	for _, idx := range idxs {
+		name := boltIndexBucket(store, idx.Name)
+		if tx.Bucket(name) == nil {
+			continue
+		}
+		if err = tx.DeleteBucket(name); err != nil {
+			return err
+		}
+		if _, err = tx.CreateBucket(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planBoltIndex picks the index which covers the most equality conditions at the root of a filter.
+// It returns the entry prefixes to scan, one for each combination of alternatives
+func planBoltIndex(expr *FilterGroup, idxs []boltIndex) (best *boltIndex, prefixes [][]byte) {
+	eq := make(map[string][][]byte)
+	for _, e := range expr.Exprs {
+		c, ok := e.(*FilterCondition)
+		if !ok || c.Op != OpEq {
+			continue
+		}
+		var vals [][]byte
+		for _, v := range c.Values {
+			b, ok := filterIndexValue(v)
+			if !ok {
+				vals = nil
+				break
+			}
+			vals = append(vals, b)
+		}
+		if vals != nil {
+			eq[c.Field()] = vals
+		}
+	}
+	covered := 0
+	for i, idx := range idxs {
+		n := 0
+		for _, field := range idx.Fields {
+			if _, ok := eq[field]; !ok {
+				break
+			}
+			n++
+		}
+		if n > covered {
+			covered = n
+			best = &idxs[i]
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	prefixes = [][]byte{nil}
+	for _, field := range best.Fields[:covered] {
+		var next [][]byte
+		for _, p := range prefixes {
+			for _, v := range eq[field] {
+				next = append(next, append(append(append([]byte{}, p...), v...), indexSep))
+			}
+		}
+		prefixes = next
+	}
+	return
+}
+
+// indexKeys returns the primary keys of index entries which start with any of the prefixes, newest first
+func indexKeys(ib *bolt.Bucket, prefixes [][]byte, lower, upper []byte) (keys [][]byte) {
+	seen := make(map[string]bool)
+	c := ib.Cursor()
+	for _, prefix := range prefixes {
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if lower != nil && bytes.Compare(v, lower) <= 0 {
+				continue
+			}
+			if upper != nil && bytes.Compare(v, upper) >= 0 {
+				continue
+			}
+			if !seen[string(v)] {
+				seen[string(v)] = true
+				keys = append(keys, append([]byte{}, v...))
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) > 0
+	})
+	return
+}
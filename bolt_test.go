@@ -0,0 +1,354 @@
+package gostore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestBoltStore() (BoltStore, func()) {
+	dir, err := ioutil.TempDir("", "gostore-bolt")
+	if err != nil {
+		panic(err)
+	}
+	store, err := NewBoltObjectStore(filepath.Join(dir, "test.db"))
+	if err != nil {
+		panic(err)
+	}
+	return store, func() {
+		store.Db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func saveBoltThings(store BoltStore) {
+	things := []map[string]interface{}{
+		{"id": "1", "name": "First Thing", "kind": "thing", "rating": 4.5, "food": map[string]interface{}{"type": "egg"}},
+		{"id": "2", "name": "Second Thing", "kind": "thing", "rating": 3, "food": map[string]interface{}{"type": "fish"}},
+		{"id": "3", "name": "First Something", "kind": "something", "rating": 5, "created": "2017-01-02T15:04:05Z"},
+		{"id": "4", "name": "Fourth Fish", "kind": "fish", "rating": 1, "created": "2018-01-02T15:04:05Z"},
+	}
+	for _, thing := range things {
+		if _, err := store.Save(thing["id"].(string), collection, thing); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func rowIds(rows ObjectRows, err error) (ids []string) {
+	if err != nil {
+		panic(err)
+	}
+	for _, row := range rowsToArray(rows) {
+		ids = append(ids, row.(map[string]interface{})["id"].(string))
+	}
+	return
+}
+
+func TestBoltFilterGetAll(t *testing.T) {
+	Convey("Giving a bolt store with some things", t, func() {
+		store, done := newTestBoltStore()
+		defer done()
+		saveBoltThings(store)
+		Convey("Equality alternatives match newest first", func() {
+			So(rowIds(store.FilterGetAll(map[string]interface{}{"kind": "=thing|fish"}, 0, 0, collection, nil)), ShouldResemble, []string{"4", "2", "1"})
+		})
+		Convey("Regex, comparison and nested fields can be combined", func() {
+			So(rowIds(store.FilterGetAll(map[string]interface{}{"name": "~^First", "rating": ">4"}, 0, 0, collection, nil)), ShouldResemble, []string{"3", "1"})
+			So(rowIds(store.FilterGetAll(map[string]interface{}{"food.type": "fish"}, 0, 0, collection, nil)), ShouldResemble, []string{"2"})
+			So(rowIds(store.FilterGetAll(map[string]interface{}{"created": "<2017-06-01T00:00:00Z|dt"}, 0, 0, collection, nil)), ShouldResemble, []string{"3"})
+		})
+		Convey("Or groups match any member", func() {
+			filter := map[string]interface{}{"or": []interface{}{
+				map[string]interface{}{"kind": "fish"},
+				map[string]interface{}{"kind": "thing", "rating": "<4"},
+			}}
+			So(rowIds(store.FilterGetAll(filter, 0, 0, collection, nil)), ShouldResemble, []string{"4", "2"})
+		})
+		Convey("Count and skip shape the result", func() {
+			So(rowIds(store.FilterGetAll(nil, 2, 1, collection, nil)), ShouldResemble, []string{"3", "2"})
+		})
+		Convey("Since and before bound the keys", func() {
+			So(rowIds(store.FilterSince("2", map[string]interface{}{"kind": "~."}, 0, 0, collection, nil)), ShouldResemble, []string{"4", "3"})
+			So(rowIds(store.FilterBefore("3", map[string]interface{}{"kind": "thing"}, 0, 0, collection, nil)), ShouldResemble, []string{"2", "1"})
+			So(rowIds(store.Since("2", 0, 0, collection)), ShouldResemble, []string{"3", "4"})
+			So(rowIds(store.Since("1", 1, 1, collection)), ShouldResemble, []string{"3"})
+			So(rowIds(store.Before("3", 0, 0, collection)), ShouldResemble, []string{"2", "1"})
+		})
+	})
+}
+
+func TestBoltFilterWrites(t *testing.T) {
+	Convey("Giving a bolt store with some things", t, func() {
+		store, done := newTestBoltStore()
+		defer done()
+		saveBoltThings(store)
+		Convey("FilterGet and FilterCount see matching rows", func() {
+			var thing map[string]interface{}
+			So(store.FilterGet(map[string]interface{}{"kind": "thing"}, collection, &thing, nil), ShouldBeNil)
+			So(thing["id"], ShouldEqual, "2")
+			So(store.FilterGet(map[string]interface{}{"kind": "chair"}, collection, &thing, nil), ShouldEqual, ErrNotFound)
+			cnt, err := store.FilterCount(map[string]interface{}{"kind": "thing"}, collection, nil)
+			So(err, ShouldBeNil)
+			So(cnt, ShouldEqual, 2)
+		})
+		Convey("FilterUpdate merges into matching rows only", func() {
+			So(store.FilterUpdate(map[string]interface{}{"kind": "thing"}, map[string]interface{}{"food": map[string]interface{}{"cooked": true}}, collection, nil), ShouldBeNil)
+			So(rowIds(store.FilterGetAll(map[string]interface{}{"food.cooked": true}, 0, 0, collection, nil)), ShouldResemble, []string{"2", "1"})
+			So(rowIds(store.FilterGetAll(map[string]interface{}{"food.type": "egg"}, 0, 0, collection, nil)), ShouldResemble, []string{"1"})
+		})
+		Convey("FilterReplace overwrites matching rows", func() {
+			So(store.FilterReplace(map[string]interface{}{"kind": "fish"}, map[string]interface{}{"kind": "chair"}, collection, nil), ShouldBeNil)
+			var thing map[string]interface{}
+			So(store.Get("4", collection, &thing), ShouldBeNil)
+			So(thing, ShouldResemble, map[string]interface{}{"kind": "chair"})
+		})
+		Convey("FilterDelete removes matching rows", func() {
+			So(store.FilterDelete(map[string]interface{}{"kind": "thing"}, collection, nil), ShouldBeNil)
+			So(rowIds(store.All(0, 0, collection)), ShouldResemble, []string{"4", "3"})
+		})
+		Convey("Invalid filters are reported", func() {
+			_, err := store.FilterCount(map[string]interface{}{"name": "~[a-"}, collection, nil)
+			So(err, ShouldHaveSameTypeAs, &FilterError{})
+		})
+	})
+}
+
+func indexEntries(store BoltStore, name string) (entries []string) {
+	store.Db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltIndexBucket(collection, name)).ForEach(func(k, v []byte) error {
+			entries = append(entries, strings.Replace(string(k), "\x00", "/", -1))
+			return nil
+		})
+	})
+	return
+}
+
+func TestBoltIndexes(t *testing.T) {
+	Convey("Giving a bolt store with an indexed table", t, func() {
+		store, done := newTestBoltStore()
+		defer done()
+		saveBoltThings(store)
+		err := store.CreateTable(collection, map[string]interface{}{
+			"index": map[string]interface{}{"kind": []interface{}{}, "kind_id": []interface{}{"kind", "id"}},
+		})
+		So(err, ShouldBeNil)
+		Convey("Existing rows are indexed", func() {
+			So(indexEntries(store, "kind"), ShouldResemble, []string{"fish/4", "something/3", "thing/1", "thing/2"})
+			So(indexEntries(store, "kind_id"), ShouldResemble, []string{"fish/4/4", "something/3/3", "thing/1/1", "thing/2/2"})
+		})
+		Convey("Saving and deleting keep the indexes in sync", func() {
+			store.Save("2", collection, map[string]interface{}{"id": "2", "kind": "fish"})
+			store.Save("5", collection, map[string]interface{}{"id": "5", "kind": "thing"})
+			store.Delete("1", collection)
+			So(indexEntries(store, "kind"), ShouldResemble, []string{"fish/2", "fish/4", "something/3", "thing/5"})
+			So(rowIds(store.FilterGetAll(map[string]interface{}{"kind": "=fish|thing"}, 0, 0, collection, nil)), ShouldResemble, []string{"5", "4", "2"})
+		})
+		Convey("Filter writes keep the indexes in sync", func() {
+			So(store.FilterUpdate(map[string]interface{}{"kind": "thing"}, map[string]interface{}{"kind": "chair"}, collection, nil), ShouldBeNil)
+			So(indexEntries(store, "kind"), ShouldResemble, []string{"chair/1", "chair/2", "fish/4", "something/3"})
+			So(store.FilterDelete(map[string]interface{}{"kind": "chair", "id": "1"}, collection, nil), ShouldBeNil)
+			So(indexEntries(store, "kind_id"), ShouldResemble, []string{"chair/2/2", "fish/4/4", "something/3/3"})
+		})
+		Convey("Indexed filters still apply every condition", func() {
+			So(rowIds(store.FilterGetAll(map[string]interface{}{"kind": "thing", "rating": ">4"}, 0, 0, collection, nil)), ShouldResemble, []string{"1"})
+			So(rowIds(store.FilterBefore("2", map[string]interface{}{"kind": "thing"}, 0, 0, collection, nil)), ShouldResemble, []string{"1"})
+		})
+		Convey("Indexes requested through options are built on demand", func() {
+			opts := DefaultObjectStoreOptions{Index: map[string][]string{"name": {}}}
+			So(rowIds(store.FilterGetAll(map[string]interface{}{"name": "Second Thing"}, 0, 0, collection, opts)), ShouldResemble, []string{"2"})
+			So(indexEntries(store, "name"), ShouldHaveLength, 4)
+		})
+	})
+}
+
+func saveGeoPlaces(store GeoStore) {
+	places := []map[string]interface{}{
+		{"id": "near", "kind": "shop", "location": map[string]interface{}{"lat": 6.5250, "lon": 3.3800}},
+		{"id": "close", "kind": "shop", "location": []interface{}{3.4000, 6.5300}},
+		{"id": "bar", "kind": "bar", "location": map[string]interface{}{"lat": 6.5260, "lng": 3.3810}},
+		{"id": "far", "kind": "shop", "location": map[string]interface{}{"lat": 6.6000, "lon": 3.5000}},
+	}
+	for _, place := range places {
+		if _, err := store.SaveWithGeo(place["id"].(string), "places", place, "location"); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func TestBoltGeoQuery(t *testing.T) {
+	Convey("Given a bolt store with places saved with their location", t, func() {
+		store, cleanup := newTestBoltStore()
+		defer cleanup()
+		saveGeoPlaces(store)
+		Convey("Places within the distance are returned nearest first", func() {
+			rows, err := store.GeoQuery(3.3792, 6.5244, "5km", nil, 10, 0, "places", nil)
+			So(err, ShouldBeNil)
+			places := rowsToArray(rows)
+			So(len(places), ShouldEqual, 3)
+			var ids []string
+			for _, p := range places {
+				ids = append(ids, p.(map[string]interface{})["id"].(string))
+			}
+			So(ids, ShouldResemble, []string{"near", "bar", "close"})
+			So(places[0].(map[string]interface{})["_distance"], ShouldBeLessThan, 200)
+		})
+		Convey("The query filters the places", func() {
+			ids := rowIds(store.GeoQuery(3.3792, 6.5244, "20km", map[string]interface{}{"kind": "shop"}, 2, 1, "places", nil))
+			So(ids, ShouldResemble, []string{"close", "far"})
+		})
+		Convey("Moved and deleted places follow their new location", func() {
+			_, err := store.SaveWithGeo("far", "places", map[string]interface{}{"id": "far", "location": []interface{}{3.3793, 6.5245}}, "location")
+			So(err, ShouldBeNil)
+			So(store.Delete("near", "places"), ShouldBeNil)
+			ids := rowIds(store.GeoQuery(3.3792, 6.5244, "1km", nil, 0, 0, "places", nil))
+			So(ids, ShouldResemble, []string{"far", "bar"})
+		})
+		Convey("A row without a location is rejected", func() {
+			_, err := store.SaveWithGeo("nowhere", "places", map[string]interface{}{"id": "nowhere"}, "location")
+			So(err, ShouldEqual, ErrInvalidLocation)
+		})
+	})
+}
+
+func transfer(store BoltStore, txn Transaction, from, to string, amount float64) error {
+	var src, dst map[string]interface{}
+	if err := store.GetTX("acc1", from, &src, txn); err != nil {
+		return err
+	}
+	if err := store.GetTX("acc1", to, &dst, txn); err != nil {
+		return err
+	}
+	src["balance"] = src["balance"].(float64) - amount
+	dst["balance"] = dst["balance"].(float64) + amount
+	if err := store.SaveTX("acc1", from, src, txn); err != nil {
+		return err
+	}
+	return store.SaveTX("acc1", to, dst, txn)
+}
+
+func TestBoltTransaction(t *testing.T) {
+	Convey("Given a bolt store with two ledgers", t, func() {
+		store, cleanup := newTestBoltStore()
+		defer cleanup()
+		store.Save("acc1", "ledger_a", map[string]interface{}{"id": "acc1", "balance": 100})
+		store.Save("acc1", "ledger_b", map[string]interface{}{"id": "acc1", "balance": 10})
+		balance := func(ledger string) float64 {
+			var acc map[string]interface{}
+			So(store.Get("acc1", ledger, &acc), ShouldBeNil)
+			return acc["balance"].(float64)
+		}
+		Convey("A committed transfer updates both ledgers", func() {
+			txn := store.UpdateTransaction()
+			defer txn.Discard()
+			So(transfer(store, txn, "ledger_a", "ledger_b", 40), ShouldBeNil)
+			var acc map[string]interface{}
+			So(store.GetTX("acc1", "ledger_b", &acc, txn), ShouldBeNil)
+			So(acc["balance"], ShouldEqual, 50)
+			So(store.FinishTransaction(txn), ShouldBeNil)
+			So(balance("ledger_a"), ShouldEqual, 60)
+			So(balance("ledger_b"), ShouldEqual, 50)
+			So(txn.Commit(), ShouldEqual, bolt.ErrTxClosed)
+		})
+		Convey("A discarded transfer changes nothing", func() {
+			txn := store.UpdateTransaction()
+			defer txn.Discard()
+			So(transfer(store, txn, "ledger_a", "ledger_b", 40), ShouldBeNil)
+			So(store.DeleteTX("acc1", "ledger_a", txn), ShouldBeNil)
+			txn.Discard()
+			So(balance("ledger_a"), ShouldEqual, 100)
+			So(balance("ledger_b"), ShouldEqual, 10)
+		})
+		Convey("A restarted transaction drops earlier writes", func() {
+			txn := store.UpdateTransaction()
+			defer txn.Discard()
+			So(transfer(store, txn, "ledger_a", "ledger_b", 40), ShouldBeNil)
+			So(txn.Restart(), ShouldBeNil)
+			So(transfer(store, txn, "ledger_a", "ledger_b", 5), ShouldBeNil)
+			So(txn.Commit(), ShouldBeNil)
+			So(balance("ledger_a"), ShouldEqual, 95)
+			So(balance("ledger_b"), ShouldEqual, 15)
+		})
+		Convey("Filters, batch inserts and raw values see the writes of the transaction", func() {
+			txn := store.UpdateTransaction()
+			defer txn.Discard()
+			keys, err := store.BatchInsertTX([]interface{}{
+				map[string]interface{}{"id": "acc2", "balance": 7},
+				map[string]interface{}{"balance": 8},
+			}, "ledger_a", nil, txn)
+			So(err, ShouldBeNil)
+			So(keys[0], ShouldEqual, "acc2")
+			So(len(keys[1]), ShouldEqual, 24)
+			var acc map[string]interface{}
+			So(store.FilterGetTX(map[string]interface{}{"balance": 8}, "ledger_a", &acc, nil, txn), ShouldBeNil)
+			So(acc["balance"], ShouldEqual, 8)
+			So(txn.Set([]byte("last"), []byte("acc2")), ShouldBeNil)
+			v, err := txn.Get([]byte("last"))
+			So(err, ShouldBeNil)
+			So(string(v), ShouldEqual, "acc2")
+			So(store.FinishTransaction(txn), ShouldBeNil)
+			So(store.Get("acc2", "ledger_a", &acc), ShouldBeNil)
+		})
+	})
+}
+
+func TestBoltRows(t *testing.T) {
+	Convey("Giving a bolt store with some things", t, func() {
+		store, done := newTestBoltStore()
+		defer done()
+		saveBoltThings(store)
+		Convey("Rows can be closed early and more than once", func() {
+			rows, err := store.All(0, 0, collection)
+			So(err, ShouldBeNil)
+			var row map[string]interface{}
+			ok, err := rows.Next(&row)
+			So(ok, ShouldBeTrue)
+			So(err, ShouldBeNil)
+			rows.Close()
+			rows.Close()
+			ok, err = rows.Next(&row)
+			So(ok, ShouldBeFalse)
+			So(err, ShouldBeNil)
+			So(rows.LastError(), ShouldBeNil)
+		})
+		Convey("Raw rows are returned as stored", func() {
+			rows, err := store.Before("3", 0, 0, collection)
+			So(err, ShouldBeNil)
+			defer rows.Close()
+			raw, ok := rows.NextRaw()
+			So(ok, ShouldBeTrue)
+			So(string(raw), ShouldContainSubstring, `"Second Thing"`)
+			_, ok = rows.NextRaw()
+			So(ok, ShouldBeTrue)
+			_, ok = rows.NextRaw()
+			So(ok, ShouldBeFalse)
+		})
+		Convey("Rows which cannot be decoded stop the iteration", func() {
+			So(store.Db.Update(func(tx *bolt.Tx) error {
+				return tx.Bucket([]byte(collection)).Put([]byte("5"), []byte("{"))
+			}), ShouldBeNil)
+			rows, err := store.All(0, 0, collection)
+			So(err, ShouldBeNil)
+			var row map[string]interface{}
+			ok, err := rows.Next(&row)
+			So(ok, ShouldBeFalse)
+			So(err, ShouldNotBeNil)
+			So(rows.LastError(), ShouldEqual, err)
+		})
+		Convey("A cursor reads every row newest first and releases its transaction", func() {
+			rows, err := store.AllCursor(collection)
+			So(err, ShouldBeNil)
+			So(rowIds(rows, nil), ShouldResemble, []string{"4", "3", "2", "1"})
+			So(rows.(*BoltRows).tx, ShouldBeNil)
+			rows, err = store.AllCursor(collection)
+			So(err, ShouldBeNil)
+			rows.Close()
+			So(rows.(*BoltRows).tx, ShouldBeNil)
+		})
+	})
+}
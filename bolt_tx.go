@@ -0,0 +1,239 @@
+package gostore
+
+import (
+	"github.com/boltdb/bolt"
+)
+
+// BoltTransaction is a Transaction on a writable bolt.Tx which may span several tables. Reads in
+// the transaction see its own writes and nothing is visible to other readers until Commit.
+// Bolt allows a single writer, so other writes block until the transaction is committed or
+// discarded and the BoltStore methods which are not suffixed with TX must not be called on the
+// goroutine which holds it
+type BoltTransaction struct {
+	store BoltStore
+	tx    *bolt.Tx
+}
+
+// BeginTransaction starts a read-write transaction
+func (s BoltStore) BeginTransaction() (*BoltTransaction, error) {
+	tx, err := s.Db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	return &BoltTransaction{store: s, tx: tx}, nil
+}
+
+// Tx returns the underlying bolt transaction or nil once it has been committed or discarded
+func (t *BoltTransaction) Tx() *bolt.Tx {
+	return t.tx
+}
+
+// Restart discards every write made so far and starts a new transaction
+func (t *BoltTransaction) Restart() error {
+	t.Discard()
+	tx, err := t.store.Db.Begin(true)
+	if err != nil {
+		return err
+	}
+	t.tx = tx
+	return nil
+}
+
+// Commit applies every write of the transaction atomically
+func (t *BoltTransaction) Commit() error {
+	if t.tx == nil {
+		return bolt.ErrTxClosed
+	}
+	tx := t.tx
+	t.tx = nil
+	return tx.Commit()
+}
+
+// Discard rolls the transaction back, it is safe to call after Commit
+func (t *BoltTransaction) Discard() {
+	if t.tx != nil {
+		t.tx.Rollback()
+		t.tx = nil
+	}
+}
+
+// Set writes a raw value in the default bucket of the store
+func (t *BoltTransaction) Set(key, value []byte) error {
+	if t.tx == nil {
+		return bolt.ErrTxClosed
+	}
+	b, err := t.tx.CreateBucketIfNotExists(t.store.Bucket)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, value)
+}
+
+// Get reads a raw value from the default bucket of the store
+func (t *BoltTransaction) Get(key []byte) ([]byte, error) {
+	if t.tx == nil {
+		return nil, bolt.ErrTxClosed
+	}
+	b := t.tx.Bucket(t.store.Bucket)
+	if b == nil {
+		return nil, ErrNotFound
+	}
+	v := b.Get(key)
+	if v == nil {
+		return nil, ErrNotFound
+	}
+	//values are only valid for the life of the transaction
+	return append([]byte{}, v...), nil
+}
+
+// Delete removes a raw value from the default bucket of the store
+func (t *BoltTransaction) Delete(key []byte) error {
+	if t.tx == nil {
+		return bolt.ErrTxClosed
+	}
+	b := t.tx.Bucket(t.store.Bucket)
+	if b == nil {
+		return nil
+	}
+	return b.Delete(key)
+}
+
+// boltTx returns the open bolt transaction of txn
+func boltTx(txn Transaction) (*bolt.Tx, error) {
+	t, ok := txn.(*BoltTransaction)
+	if !ok || t == nil {
+		return nil, ErrInvalidTransaction
+	}
+	if t.tx == nil {
+		return nil, bolt.ErrTxClosed
+	}
+	return t.tx, nil
+}
+
+// UpdateTransaction starts a read-write transaction, it returns nil if one cannot be started
+func (s BoltStore) UpdateTransaction() Transaction {
+	t, err := s.BeginTransaction()
+	if err != nil {
+		logger.Warn("cannot start bolt transaction", "err", err)
+		return nil
+	}
+	return t
+}
+
+// FinishTransaction commits a transaction started with UpdateTransaction
+func (s BoltStore) FinishTransaction(txn Transaction) error {
+	if _, err := boltTx(txn); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+// GetTX retrieves a row as seen by the transaction
+func (s BoltStore) GetTX(key string, store string, dst interface{}, txn Transaction) error {
+	tx, err := boltTx(txn)
+	if err != nil {
+		return err
+	}
+	b := tx.Bucket([]byte(store))
+	if b == nil {
+		return ErrNotFound
+	}
+	v := b.Get([]byte(key))
+	if v == nil {
+		return ErrNotFound
+	}
+	codec, err := s.tableCodec(tx, store)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(v, dst)
+}
+
+// SaveTX writes a row in the transaction
+func (s BoltStore) SaveTX(key string, store string, src interface{}, txn Transaction) error {
+	tx, err := boltTx(txn)
+	if err != nil {
+		return err
+	}
+	return s.putRow(tx, store, []byte(key), src)
+}
+
+// DeleteTX removes a row in the transaction
+func (s BoltStore) DeleteTX(key string, store string, txn Transaction) error {
+	tx, err := boltTx(txn)
+	if err != nil {
+		return err
+	}
+	b := tx.Bucket([]byte(store))
+	if b == nil {
+		return nil
+	}
+	codec, err := s.tableCodec(tx, store)
+	if err != nil {
+		return err
+	}
+	k := []byte(key)
+	if err = boltRowWritten(tx, store, codec, k, b.Get(k), nil); err != nil {
+		return err
+	}
+	if err = deleteBoltGeohash(tx, store, k); err != nil {
+		return err
+	}
+	return b.Delete(k)
+}
+
+// FilterGetTX retrieves the newest row matching the filter as seen by the transaction
+func (s BoltStore) FilterGetTX(filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions, txn Transaction) error {
+	tx, err := boltTx(txn)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.CreateBucketIfNotExists([]byte(store)); err != nil {
+		return err
+	}
+	codec, err := s.tableCodec(tx, store)
+	if err != nil {
+		return err
+	}
+	if opts != nil && len(opts.GetIndexes()) > 0 {
+		if err = createBoltIndexes(tx, store, codec, newBoltIndexes(opts.GetIndexes())); err != nil {
+			return err
+		}
+	}
+	var found []byte
+	err = s.scanFilter(tx, store, codec, filter, nil, nil, func(k, v []byte, doc map[string]interface{}) (bool, error) {
+		found = v
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	if found == nil {
+		return ErrNotFound
+	}
+	return codec.Unmarshal(found, dst)
+}
+
+// BatchInsertTX writes rows in the transaction. A row is keyed by its id field, rows without
+// one get a new ObjectId
+func (s BoltStore) BatchInsertTX(data []interface{}, store string, opts ObjectStoreOptions, txn Transaction) (keys []string, err error) {
+	tx, err := boltTx(txn)
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range data {
+		doc, err := toDoc(src)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := doc["id"].(string)
+		if !ok || key == "" {
+			key = NewObjectId().Hex()
+		}
+		if err = s.putRow(tx, store, []byte(key), src); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,51 @@
+package gostore
+
+import (
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+)
+
+// Watch streams the changes made to a table through the stores of this process which share the
+// bolt database. Bolt allows a single process to open a database, so no write is missed. Changes
+// are published once their transaction commits
+func (s BoltStore) Watch(store string, filter map[string]interface{}, opts WatchOptions) (ChangeFeed, error) {
+	return watchLocal(s.Db, store, filter, opts)
+}
+
+// boltRowWritten keeps the indexes of a table in step with the write of a row and publishes the
+// change to the watchers of the table when the transaction commits
+func boltRowWritten(tx *bolt.Tx, store string, codec Codec, key, oldValue, newValue []byte) error {
+	if err := updateBoltIndexes(tx, store, codec, key, oldValue, newValue); err != nil {
+		return err
+	}
+	db := tx.DB()
+	if !watchingLocal(db, store) {
+		return nil
+	}
+	old, err := boltChangeJSON(codec, key, oldValue)
+	if err != nil {
+		return err
+	}
+	new, err := boltChangeJSON(codec, key, newValue)
+	if err != nil {
+		return err
+	}
+	c := changeOf(store, string(key), old, new)
+	tx.OnCommit(func() {
+		publishLocal(db, c)
+	})
+	return nil
+}
+
+// boltChangeJSON converts a stored row to JSON, values are only valid within their transaction
+func boltChangeJSON(codec Codec, key, value []byte) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	doc, err := decodeBoltDoc(codec, key, value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
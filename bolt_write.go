@@ -0,0 +1,154 @@
+package gostore
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// FilterUpdateResult updates the rows matching filter like FilterUpdate and reports the write, a dry
+// run only counts the rows
+func (s BoltStore) FilterUpdateResult(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions, wopts WriteOptions) (WriteResult, error) {
+	update, err := updater(src)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	return s.filterWrite(store, filter, opts, wopts.DryRun, update)
+}
+
+// FilterDeleteResult removes the rows matching filter and reports how many it deleted
+func (s BoltStore) FilterDeleteResult(filter map[string]interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	return s.filterWrite(store, filter, opts, false, func(doc map[string]interface{}) map[string]interface{} {
+		return nil
+	})
+}
+
+// BatchFilterDeleteResult removes rows matching any of the filters and reports how many it deleted
+func (s BoltStore) BatchFilterDeleteResult(filter []map[string]interface{}, store string, opts ObjectStoreOptions) (result WriteResult, err error) {
+	for _, f := range filter {
+		deleted, err := s.FilterDeleteResult(f, store, opts)
+		result.add(deleted)
+		if err != nil {
+			return result, err
+		}
+	}
+	return
+}
+
+// BatchDeleteResult removes rows by key in one transaction, keys which do not exist are skipped
+func (s BoltStore) BatchDeleteResult(ids []interface{}, store string, opts ObjectStoreOptions) (result WriteResult, err error) {
+	s.CreateBucket(store)
+	err = s.update(func(tx *bolt.Tx) error {
+		result = WriteResult{}
+		b := tx.Bucket([]byte(store))
+		codec, err := s.tableCodec(tx, store)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			key, err := batchKey(id)
+			if err != nil {
+				result.fail(fmt.Sprint(id), err)
+				continue
+			}
+			k := []byte(key)
+			old := b.Get(k)
+			if old == nil {
+				result.Skipped++
+				continue
+			}
+			if err = boltRowWritten(tx, store, codec, k, old, nil); err != nil {
+				return err
+			}
+			if err = deleteBoltGeohash(tx, store, k); err != nil {
+				return err
+			}
+			if err = b.Delete(k); err != nil {
+				return err
+			}
+			result.Matched++
+			result.Deleted++
+		}
+		return nil
+	})
+	return
+}
+
+// BatchUpdateResult merges data[i] into the row with ids[i] in one transaction, the keys which have
+// no row fail with ErrNotFound while the other rows are updated
+func (s BoltStore) BatchUpdateResult(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	return s.batchUpdate(ids, data, store, false)
+}
+
+// batchUpdate merges data into rows by key, when strict nothing is updated unless every row exists
+func (s BoltStore) batchUpdate(ids []interface{}, data []interface{}, store string, strict bool) (result WriteResult, err error) {
+	if len(ids) != len(data) {
+		return result, fmt.Errorf("gostore: %d ids and %d documents to update", len(ids), len(data))
+	}
+	updates := make([]func(doc map[string]interface{}) map[string]interface{}, len(data))
+	for i, d := range data {
+		if updates[i], err = updater(d); err != nil {
+			return
+		}
+	}
+	s.CreateBucket(store)
+	err = s.update(func(tx *bolt.Tx) error {
+		result = WriteResult{}
+		b := tx.Bucket([]byte(store))
+		codec, err := s.tableCodec(tx, store)
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(ids))
+		for i, id := range ids {
+			key, err := batchKey(id)
+			if err != nil {
+				if strict {
+					return err
+				}
+				result.fail(fmt.Sprint(id), err)
+				continue
+			}
+			if seen[key] {
+				//a key given twice sees its first update
+				continue
+			}
+			seen[key] = true
+			k := []byte(key)
+			old := b.Get(k)
+			if old == nil {
+				if strict {
+					return ErrNotFound
+				}
+				result.fail(key, ErrNotFound)
+				continue
+			}
+			doc, err := decodeBoltDoc(codec, k, old)
+			if err != nil {
+				return err
+			}
+			result.Matched++
+			doc, changed, err := changeDoc(doc, updates[i])
+			if err != nil {
+				return err
+			}
+			if !changed {
+				result.Unchanged++
+				continue
+			}
+			v, err := codec.Marshal(doc)
+			if err != nil {
+				return err
+			}
+			if err = boltRowWritten(tx, store, codec, k, old, v); err != nil {
+				return err
+			}
+			if err = b.Put(k, v); err != nil {
+				return err
+			}
+			result.Updated++
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,455 @@
+package gostore
+
+import (
+	"container/list"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheOptions configures a CachedStore
+type CacheOptions struct {
+	// Size is the maximum number of cached rows, 1000 when zero
+	Size int
+	// TTL is how long a row stays cached, zero keeps it until it is evicted or invalidated
+	TTL time.Duration
+	// TableTTL overrides TTL for some tables, a negative ttl disables caching of the table
+	TableTTL map[string]time.Duration
+}
+
+// CacheStats counts the lookups served by a CachedStore
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Size      int
+}
+
+// CachedStore serves Get, GetByField and FilterGet from an LRU cache of the rows they returned,
+// every other read goes to the wrapped store. Writes made through the CachedStore invalidate the
+// rows of their table, writes made elsewhere are only seen once cached rows expire, so set a TTL
+// when the database has other writers. Rows are cached whole encoded as JSON and decoded into the
+// destination of every lookup, so destinations are decoded with their json tags
+type CachedStore struct {
+	store ObjectStore
+	cache *objectCache
+}
+
+// NewCachedStore wraps a store with a read-through cache
+func NewCachedStore(store ObjectStore, opts CacheOptions) CachedStore {
+	if opts.Size <= 0 {
+		opts.Size = 1000
+	}
+	return CachedStore{store: store, cache: &objectCache{
+		opts:        opts,
+		lru:         list.New(),
+		tables:      make(map[string]map[string]*list.Element),
+		now:         time.Now,
+		generations: make(map[string]uint64),
+	}}
+}
+
+type objectCache struct {
+	sync.Mutex
+	opts   CacheOptions
+	lru    *list.List
+	tables map[string]map[string]*list.Element
+	stats  map[string]*CacheStats
+	total  CacheStats
+	now    func() time.Time
+	// generations counts the invalidations of every table, a row read before an invalidation
+	// is not cached
+	generations map[string]uint64
+}
+
+type cacheEntry struct {
+	table, key string
+	value      []byte
+	expires    time.Time
+}
+
+func (c *objectCache) ttl(table string) time.Duration {
+	if ttl, ok := c.opts.TableTTL[table]; ok {
+		return ttl
+	}
+	return c.opts.TTL
+}
+
+func (c *objectCache) tableStats(table string) *CacheStats {
+	if c.stats == nil {
+		c.stats = make(map[string]*CacheStats)
+	}
+	s, ok := c.stats[table]
+	if !ok {
+		s = &CacheStats{}
+		c.stats[table] = s
+	}
+	return s
+}
+
+// get returns a cached row, expired rows are dropped. On a miss it returns the generation of the
+// table to pass to put
+func (c *objectCache) get(table, key string) ([]byte, uint64, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if el, ok := c.tables[table][key]; ok {
+		e := el.Value.(*cacheEntry)
+		if e.expires.IsZero() || c.now().Before(e.expires) {
+			c.lru.MoveToFront(el)
+			c.total.Hits++
+			c.tableStats(table).Hits++
+			return e.value, 0, true
+		}
+		c.remove(el)
+	}
+	c.total.Misses++
+	c.tableStats(table).Misses++
+	//the table is tracked from its first miss so clear can bump it
+	generation, ok := c.generations[table]
+	if !ok {
+		c.generations[table] = 0
+	}
+	return nil, generation, false
+}
+
+// put caches a row read while the table was at generation
+func (c *objectCache) put(table, key string, value []byte, generation uint64) {
+	ttl := c.ttl(table)
+	if ttl < 0 {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.generations[table] != generation {
+		return
+	}
+	e := &cacheEntry{table: table, key: key, value: value}
+	if ttl > 0 {
+		e.expires = c.now().Add(ttl)
+	}
+	if el, ok := c.tables[table][key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	if c.tables[table] == nil {
+		c.tables[table] = make(map[string]*list.Element)
+	}
+	c.tables[table][key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.opts.Size {
+		el := c.lru.Back()
+		c.remove(el)
+		c.total.Evictions++
+		c.tableStats(el.Value.(*cacheEntry).table).Evictions++
+	}
+}
+
+// remove drops an entry, the caller holds the lock
+func (c *objectCache) remove(el *list.Element) {
+	e := el.Value.(*cacheEntry)
+	c.lru.Remove(el)
+	delete(c.tables[e.table], e.key)
+}
+
+// invalidate drops the row cached for id and every field and filter lookup of the table, which may
+// now match another row. An empty id drops the whole table
+func (c *objectCache) invalidate(table, id string) {
+	c.Lock()
+	defer c.Unlock()
+	c.generations[table]++
+	for key, el := range c.tables[table] {
+		if id == "" || key == cacheKey("get", id) || !strings.HasPrefix(key, cacheKey("get", "")) {
+			c.remove(el)
+		}
+	}
+}
+
+// clear drops every cached row and bumps the generation of every table, so rows being read while
+// it runs are not cached
+func (c *objectCache) clear() {
+	c.Lock()
+	defer c.Unlock()
+	for table := range c.generations {
+		c.generations[table]++
+	}
+	c.lru.Init()
+	c.tables = make(map[string]map[string]*list.Element)
+}
+
+func (c *objectCache) snapshot(table string) CacheStats {
+	c.Lock()
+	defer c.Unlock()
+	s := c.total
+	if table != "" {
+		s = *c.tableStats(table)
+		s.Size = len(c.tables[table])
+	} else {
+		s.Size = c.lru.Len()
+	}
+	return s
+}
+
+func cacheKey(kind string, parts ...string) string {
+	key := kind
+	for _, p := range parts {
+		key += "\x00" + p
+	}
+	return key
+}
+
+// cached decodes the row cached under key into dst or reads it with load and caches it. The row is
+// loaded into a map and cached whole, so every destination decodes it the same way on a miss and
+// on a hit, whatever fields the destination of the first lookup kept
+func (s CachedStore) cached(table, key string, dst interface{}, load func(row interface{}) error) error {
+	value, generation, ok := s.cache.get(table, key)
+	if ok {
+		return json.Unmarshal(value, dst)
+	}
+	var row map[string]interface{}
+	if err := load(&row); err != nil {
+		return err
+	}
+	value, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	s.cache.put(table, key, value, generation)
+	return json.Unmarshal(value, dst)
+}
+
+// CacheStats returns the statistics of every table, or of one table when table is not empty
+func (s CachedStore) CacheStats(table string) CacheStats {
+	return s.cache.snapshot(table)
+}
+
+// Store returns the wrapped store
+func (s CachedStore) Store() ObjectStore {
+	return s.store
+}
+
+// Capabilities describes the wrapped store, CachedStore exposes the ObjectStore api and the write
+// results of the wrapped store
+func (s CachedStore) Capabilities() Capabilities {
+	return decoratedCapabilities(s.store)
+}
+
+func (s CachedStore) CreateDatabase() error {
+	return s.store.CreateDatabase()
+}
+
+func (s CachedStore) CreateTable(table string, sample interface{}) error {
+	s.cache.invalidate(table, "")
+	return s.store.CreateTable(table, sample)
+}
+
+func (s CachedStore) GetStore() interface{} {
+	return s.store.GetStore()
+}
+
+// Stats adds the cache_hits, cache_misses, cache_evictions and cache_size of a table to the
+// statistics of the wrapped store. Only the cache statistics are returned when the store has none
+func (s CachedStore) Stats(store string) (map[string]interface{}, error) {
+	data, err := s.store.Stats(store)
+	if err != nil && err != ErrNotImplemented {
+		return nil, err
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	stats := s.cache.snapshot(store)
+	data["cache_hits"] = stats.Hits
+	data["cache_misses"] = stats.Misses
+	data["cache_evictions"] = stats.Evictions
+	data["cache_size"] = stats.Size
+	return data, nil
+}
+
+func (s CachedStore) All(count int, skip int, store string) (ObjectRows, error) {
+	return s.store.All(count, skip, store)
+}
+
+func (s CachedStore) AllCursor(store string) (ObjectRows, error) {
+	return s.store.AllCursor(store)
+}
+
+func (s CachedStore) AllWithinRange(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.store.AllWithinRange(filter, count, skip, store, opts)
+}
+
+func (s CachedStore) Since(id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.store.Since(id, count, skip, store)
+}
+
+func (s CachedStore) Before(id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.store.Before(id, count, skip, store)
+}
+
+func (s CachedStore) FilterSince(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.store.FilterSince(id, filter, count, skip, store, opts)
+}
+
+func (s CachedStore) FilterBefore(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.store.FilterBefore(id, filter, count, skip, store, opts)
+}
+
+func (s CachedStore) FilterBeforeCount(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.store.FilterBeforeCount(id, filter, count, skip, store, opts)
+}
+
+// Get reads a row from the cache or the wrapped store
+func (s CachedStore) Get(key string, store string, dst interface{}) error {
+	return s.cached(store, cacheKey("get", key), dst, func(row interface{}) error {
+		return s.store.Get(key, store, row)
+	})
+}
+
+func (s CachedStore) Save(key, store string, src interface{}) (string, error) {
+	key, err := s.store.Save(key, store, src)
+	s.cache.invalidate(store, key)
+	return key, err
+}
+
+func (s CachedStore) SaveAll(store string, src ...interface{}) ([]string, error) {
+	defer s.cache.invalidate(store, "")
+	return s.store.SaveAll(store, src...)
+}
+
+func (s CachedStore) Update(key string, store string, src interface{}) error {
+	defer s.cache.invalidate(store, key)
+	return s.store.Update(key, store, src)
+}
+
+func (s CachedStore) Replace(key string, store string, src interface{}) error {
+	defer s.cache.invalidate(store, key)
+	return s.store.Replace(key, store, src)
+}
+
+func (s CachedStore) Delete(key string, store string) error {
+	defer s.cache.invalidate(store, key)
+	return s.store.Delete(key, store)
+}
+
+func (s CachedStore) FilterUpdate(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	defer s.cache.invalidate(store, "")
+	return s.store.FilterUpdate(filter, src, store, opts)
+}
+
+func (s CachedStore) FilterReplace(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	defer s.cache.invalidate(store, "")
+	return s.store.FilterReplace(filter, src, store, opts)
+}
+
+// FilterGet reads the row matching a filter from the cache or the wrapped store
+func (s CachedStore) FilterGet(filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	key, err := json.Marshal(filter)
+	if err != nil {
+		return s.store.FilterGet(filter, store, dst, opts)
+	}
+	return s.cached(store, cacheKey("filter", string(key)), dst, func(row interface{}) error {
+		return s.store.FilterGet(filter, store, row, opts)
+	})
+}
+
+func (s CachedStore) FilterGetAll(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.store.FilterGetAll(filter, count, skip, store, opts)
+}
+
+func (s CachedStore) Query(filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error) {
+	return s.store.Query(filter, aggregates, count, skip, store, opts)
+}
+
+func (s CachedStore) FilterDelete(filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	defer s.cache.invalidate(store, "")
+	return s.store.FilterDelete(filter, store, opts)
+}
+
+func (s CachedStore) FilterCount(filter map[string]interface{}, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.store.FilterCount(filter, store, opts)
+}
+
+// GetByField reads the row with a field value from the cache or the wrapped store
+func (s CachedStore) GetByField(name, val, store string, dst interface{}) error {
+	return s.cached(store, cacheKey("field", name, val), dst, func(row interface{}) error {
+		return s.store.GetByField(name, val, store, row)
+	})
+}
+
+func (s CachedStore) GetByFieldsByField(name, val, store string, fields []string, dst interface{}) error {
+	return s.store.GetByFieldsByField(name, val, store, fields, dst)
+}
+
+func (s CachedStore) BatchDelete(ids []interface{}, store string, opts ObjectStoreOptions) error {
+	defer s.cache.invalidate(store, "")
+	return s.store.BatchDelete(ids, store, opts)
+}
+
+func (s CachedStore) BatchUpdate(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	defer s.cache.invalidate(store, "")
+	return s.store.BatchUpdate(ids, data, store, opts)
+}
+
+func (s CachedStore) BatchFilterDelete(filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	defer s.cache.invalidate(store, "")
+	return s.store.BatchFilterDelete(filter, store, opts)
+}
+
+func (s CachedStore) BatchInsert(data []interface{}, store string, opts ObjectStoreOptions) ([]string, error) {
+	defer s.cache.invalidate(store, "")
+	return s.store.BatchInsert(data, store, opts)
+}
+
+// Close drops the cache and closes the wrapped store
+func (s CachedStore) Close() {
+	s.cache.clear()
+	s.store.Close()
+}
+
+// The write results of the wrapped store invalidate the rows of their table like the writes above
+
+func (s CachedStore) BatchDeleteResult(ids []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	w, err := writeResultStore(s.store)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	defer s.cache.invalidate(store, "")
+	return w.BatchDeleteResult(ids, store, opts)
+}
+
+func (s CachedStore) BatchUpdateResult(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	w, err := writeResultStore(s.store)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	defer s.cache.invalidate(store, "")
+	return w.BatchUpdateResult(ids, data, store, opts)
+}
+
+func (s CachedStore) BatchFilterDeleteResult(filter []map[string]interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	w, err := writeResultStore(s.store)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	defer s.cache.invalidate(store, "")
+	return w.BatchFilterDeleteResult(filter, store, opts)
+}
+
+func (s CachedStore) FilterDeleteResult(filter map[string]interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	w, err := writeResultStore(s.store)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	defer s.cache.invalidate(store, "")
+	return w.FilterDeleteResult(filter, store, opts)
+}
+
+func (s CachedStore) FilterUpdateResult(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions, wopts WriteOptions) (WriteResult, error) {
+	w, err := writeResultStore(s.store)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	if !wopts.DryRun {
+		defer s.cache.invalidate(store, "")
+	}
+	return w.FilterUpdateResult(filter, src, store, opts, wopts)
+}
@@ -0,0 +1,144 @@
+package gostore
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// countingStore counts the lookups which reach a store
+type countingStore struct {
+	ObjectStore
+	gets *int
+}
+
+func (s countingStore) Get(key string, store string, dst interface{}) error {
+	*s.gets++
+	return s.ObjectStore.Get(key, store, dst)
+}
+
+func (s countingStore) FilterGet(filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	*s.gets++
+	return s.ObjectStore.FilterGet(filter, store, dst, opts)
+}
+
+func TestCachedStore(t *testing.T) {
+	Convey("Giving a cached memory store with some things", t, func() {
+		gets := 0
+		mem := NewMemoryStore()
+		store := NewCachedStore(countingStore{mem, &gets}, CacheOptions{Size: 3, TableTTL: map[string]time.Duration{"uncached": -1}})
+		for _, id := range []string{"1", "2", "3"} {
+			_, err := store.Save(id, collection, map[string]interface{}{"id": id, "kind": "thing"})
+			So(err, ShouldBeNil)
+		}
+		var row map[string]interface{}
+		Convey("Repeated lookups are served from the cache", func() {
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			row = nil
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			So(row["kind"], ShouldEqual, "thing")
+			So(gets, ShouldEqual, 1)
+			So(store.FilterGet(map[string]interface{}{"kind": "thing"}, collection, &row, nil), ShouldBeNil)
+			So(store.FilterGet(map[string]interface{}{"kind": "thing"}, collection, &row, nil), ShouldBeNil)
+			So(row["id"], ShouldEqual, "3")
+			So(gets, ShouldEqual, 2)
+			So(store.CacheStats(collection), ShouldResemble, CacheStats{Hits: 2, Misses: 2, Size: 2})
+			stats, err := store.Stats(collection)
+			So(err, ShouldBeNil)
+			So(stats["cache_hits"], ShouldEqual, 2)
+			So(stats["total_count"], ShouldEqual, 3)
+		})
+		Convey("Missing rows are not cached", func() {
+			So(store.Get("9", collection, &row), ShouldEqual, ErrNotFound)
+			So(store.Get("9", collection, &row), ShouldEqual, ErrNotFound)
+			So(gets, ShouldEqual, 2)
+		})
+		Convey("Writes invalidate the row and the lookups of its table", func() {
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			So(store.Get("2", collection, &row), ShouldBeNil)
+			So(store.FilterGet(map[string]interface{}{"kind": "thing"}, collection, &row, nil), ShouldBeNil)
+			So(store.Update("1", collection, map[string]interface{}{"kind": "chair"}), ShouldBeNil)
+			So(store.CacheStats(collection).Size, ShouldEqual, 1)
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			So(row["kind"], ShouldEqual, "chair")
+			So(store.FilterDelete(map[string]interface{}{"kind": "chair"}, collection, nil), ShouldBeNil)
+			So(store.CacheStats(collection).Size, ShouldEqual, 0)
+			So(store.Get("1", collection, &row), ShouldEqual, ErrNotFound)
+		})
+		Convey("Write results invalidate the rows of their table", func() {
+			_, err := store.BatchUpdateResult([]interface{}{"1"}, []interface{}{map[string]interface{}{"kind": "other"}}, collection, nil)
+			So(err, ShouldEqual, ErrNotImplemented)
+			direct := NewCachedStore(mem, CacheOptions{})
+			So(direct.Get("1", collection, &row), ShouldBeNil)
+			result, err := direct.BatchUpdateResult([]interface{}{"1"}, []interface{}{map[string]interface{}{"kind": "other"}}, collection, nil)
+			So(err, ShouldBeNil)
+			So(result.Updated, ShouldEqual, 1)
+			So(direct.Get("1", collection, &row), ShouldBeNil)
+			So(row["kind"], ShouldEqual, "other")
+			So(direct.CacheStats(collection).Misses, ShouldEqual, 2)
+		})
+		Convey("Rows expire after their ttl", func() {
+			now := time.Now()
+			store.cache.now = func() time.Time { return now }
+			store.cache.opts.TTL = time.Minute
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			So(gets, ShouldEqual, 1)
+			now = now.Add(2 * time.Minute)
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			So(gets, ShouldEqual, 2)
+		})
+		Convey("Tables with a negative ttl are not cached", func() {
+			_, err := store.Save("1", "uncached", map[string]interface{}{"id": "1"})
+			So(err, ShouldBeNil)
+			So(store.Get("1", "uncached", &row), ShouldBeNil)
+			So(store.Get("1", "uncached", &row), ShouldBeNil)
+			So(gets, ShouldEqual, 2)
+		})
+		Convey("The least recently used rows are evicted", func() {
+			for _, id := range []string{"1", "2", "3", "1"} {
+				So(store.Get(id, collection, &row), ShouldBeNil)
+			}
+			So(store.GetByField("kind", "thing", collection, &row), ShouldBeNil)
+			So(store.CacheStats(""), ShouldResemble, CacheStats{Hits: 1, Misses: 4, Evictions: 1, Size: 3})
+			So(store.Get("2", collection, &row), ShouldBeNil)
+			So(gets, ShouldEqual, 4)
+		})
+		Convey("Evictions are counted against the table of the evicted row", func() {
+			_, err := store.Save("1", "other", map[string]interface{}{"id": "1"})
+			So(err, ShouldBeNil)
+			So(store.Get("1", "other", &row), ShouldBeNil)
+			for _, id := range []string{"1", "2", "3"} {
+				So(store.Get(id, collection, &row), ShouldBeNil)
+			}
+			So(store.CacheStats("other").Evictions, ShouldEqual, 1)
+			So(store.CacheStats(collection).Evictions, ShouldEqual, 0)
+		})
+		Convey("Rows read while the cache is cleared are not cached", func() {
+			_, generation, ok := store.cache.get(collection, cacheKey("get", "1"))
+			So(ok, ShouldBeFalse)
+			store.cache.clear()
+			store.cache.put(collection, cacheKey("get", "1"), []byte(`{"id":"1"}`), generation)
+			So(store.CacheStats(collection).Size, ShouldEqual, 0)
+		})
+		Convey("Every destination decodes the whole row", func() {
+			var kind struct {
+				Kind string `json:"kind"`
+			}
+			So(store.Get("1", collection, &kind), ShouldBeNil)
+			So(kind.Kind, ShouldEqual, "thing")
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			So(row, ShouldResemble, map[string]interface{}{"id": "1", "kind": "thing"})
+			So(gets, ShouldEqual, 1)
+		})
+		Convey("Capabilities are those of the wrapped store", func() {
+			c, ok := CapabilitiesOf(NewCachedStore(mem, CacheOptions{}))
+			So(ok, ShouldBeTrue)
+			So(c.Aggregates, ShouldBeTrue)
+			c, _ = CapabilitiesOf(NewCachedStore(BoltStore{}, CacheOptions{}))
+			So(c.Supports("Update"), ShouldBeFalse)
+			So(c.Geo || c.Transactions, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,158 @@
+package gostore
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Capabilities describes what a store supports so an application can refuse to start with a
+// backend which cannot serve its queries instead of getting ErrNotImplemented at runtime
+type Capabilities struct {
+	// Operations lists the ObjectStore methods the store implements, sorted by name
+	Operations []string
+	// FilterOperators lists the operators understood by the filter methods
+	FilterOperators []FilterOperator
+	// Geo is true when the store is a GeoStore
+	Geo bool
+	// Transactions is true when the store is a TransactionStore
+	Transactions bool
+	// Context is true when the store is a ContextObjectStore
+	Context bool
+	// Watch is true when the store is a WatchStore
+	Watch bool
+	// WriteResults is true when the store is a WriteResultStore
+	WriteResults bool
+	// Aggregates is true when Query computes aggregates
+	Aggregates bool
+	// OrderBy is true when the OrderBy option is honoured, otherwise rows come in the
+	// default order of the store
+	OrderBy bool
+}
+
+// CapableStore is a store which describes its capabilities
+type CapableStore interface {
+	Capabilities() Capabilities
+}
+
+// Requirements lists what an application needs from a store
+type Requirements struct {
+	Operations      []string
+	FilterOperators []FilterOperator
+	Geo             bool
+	Transactions    bool
+	Context         bool
+	Watch           bool
+	WriteResults    bool
+	Aggregates      bool
+	OrderBy         bool
+}
+
+// objectStoreOperations are the names of the ObjectStore methods
+var objectStoreOperations = func() []string {
+	t := reflect.TypeOf((*ObjectStore)(nil)).Elem()
+	ops := make([]string, t.NumMethod())
+	for i := range ops {
+		ops[i] = t.Method(i).Name
+	}
+	sort.Strings(ops)
+	return ops
+}()
+
+// newCapabilities describes a store implementing every ObjectStore method except unsupported
+func newCapabilities(store interface{}, unsupported ...string) Capabilities {
+	skip := make(map[string]bool, len(unsupported))
+	for _, op := range unsupported {
+		skip[op] = true
+	}
+	c := Capabilities{}
+	for _, op := range objectStoreOperations {
+		if !skip[op] {
+			c.Operations = append(c.Operations, op)
+		}
+	}
+	_, c.Geo = store.(GeoStore)
+	_, c.Transactions = store.(TransactionStore)
+	_, c.Context = store.(ContextObjectStore)
+	_, c.Watch = store.(WatchStore)
+	_, c.WriteResults = store.(WriteResultStore)
+	return c
+}
+
+// decoratedCapabilities describes a store wrapped by a decorator which only exposes the ObjectStore
+// api, a store which does not describe itself is assumed to implement every operation. Watch looks
+// through decorators so the wrapped store can still be watched, and decorators forward the write
+// results of the wrapped store
+func decoratedCapabilities(store ObjectStore) Capabilities {
+	c, ok := CapabilitiesOf(store)
+	if !ok {
+		c = newCapabilities(store)
+	}
+	c.Geo, c.Transactions, c.Context = false, false, false
+	return c
+}
+
+// CapabilitiesOf returns the capabilities of a store, ok is false when it does not describe them
+func CapabilitiesOf(store interface{}) (c Capabilities, ok bool) {
+	if s, ok := store.(CapableStore); ok {
+		return s.Capabilities(), true
+	}
+	return c, false
+}
+
+// Supports reports whether the store implements an ObjectStore method
+func (c Capabilities) Supports(op string) bool {
+	i := sort.SearchStrings(c.Operations, op)
+	return i < len(c.Operations) && c.Operations[i] == op
+}
+
+// SupportsFilter reports whether the filter methods understand an operator
+func (c Capabilities) SupportsFilter(op FilterOperator) bool {
+	for _, o := range c.FilterOperators {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error listing every requirement the store does not meet. Operations which are
+// not ObjectStore methods are reported too so a misspelt requirement does not go unnoticed
+func (c Capabilities) Check(req Requirements) error {
+	var missing []string
+	for _, op := range req.Operations {
+		if !c.Supports(op) {
+			if i := sort.SearchStrings(objectStoreOperations, op); i == len(objectStoreOperations) || objectStoreOperations[i] != op {
+				missing = append(missing, fmt.Sprintf("%s (unknown operation)", op))
+				continue
+			}
+			missing = append(missing, op)
+		}
+	}
+	for _, op := range req.FilterOperators {
+		if !c.SupportsFilter(op) {
+			missing = append(missing, fmt.Sprintf("filter operator %q", op))
+		}
+	}
+	for _, f := range []struct {
+		name          string
+		need, support bool
+	}{
+		{"geo queries", req.Geo, c.Geo},
+		{"transactions", req.Transactions, c.Transactions},
+		{"contexts", req.Context, c.Context},
+		{"change feeds", req.Watch, c.Watch},
+		{"write results", req.WriteResults, c.WriteResults},
+		{"aggregates", req.Aggregates, c.Aggregates},
+		{"ordering", req.OrderBy, c.OrderBy},
+	} {
+		if f.need && !f.support {
+			missing = append(missing, f.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("gostore: store does not support %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
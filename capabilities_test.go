@@ -0,0 +1,114 @@
+package gostore
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// callUnsupported calls a method of store with zero arguments and returns the error it returns
+func callUnsupported(store interface{}, op string) interface{} {
+	m := reflect.ValueOf(store).MethodByName(op)
+	args := make([]reflect.Value, m.Type().NumIn())
+	for i := range args {
+		args[i] = reflect.Zero(m.Type().In(i))
+	}
+	var out []reflect.Value
+	if m.Type().IsVariadic() {
+		out = m.CallSlice(args)
+	} else {
+		out = m.Call(args)
+	}
+	return out[len(out)-1].Interface()
+}
+
+func TestCapabilities(t *testing.T) {
+	Convey("Giving every backend", t, func() {
+		stores := map[string]ObjectStore{
+			"bolt":     BoltStore{},
+			"rethink":  RethinkStore{},
+			"postgres": PostgresObjectStore{},
+			"scribble": ScribbleStore{},
+		}
+		Convey("Unsupported operations fail with ErrNotImplemented", func() {
+			for name, store := range stores {
+				c, ok := CapabilitiesOf(store)
+				So(ok, ShouldBeTrue)
+				So(len(c.Operations), ShouldBeGreaterThan, 0)
+				for _, op := range objectStoreOperations {
+					if !c.Supports(op) {
+						So(name+"."+op+" "+errString(callUnsupported(store, op)), ShouldEqual, name+"."+op+" "+ErrNotImplemented.Error())
+					}
+				}
+			}
+		})
+		Convey("Geo, transactions and aggregates are described", func() {
+			bolt, _ := CapabilitiesOf(stores["bolt"])
+			So(bolt.Geo && bolt.Transactions && bolt.Aggregates && bolt.Context, ShouldBeTrue)
+			pg, _ := CapabilitiesOf(stores["postgres"])
+			So(pg.Geo, ShouldBeFalse)
+			So(pg.Transactions, ShouldBeTrue)
+			So(pg.Supports("Query") && pg.Aggregates, ShouldBeTrue)
+			So(pg.Supports("AllCursor"), ShouldBeFalse)
+			rethink, _ := CapabilitiesOf(stores["rethink"])
+			So(rethink.Transactions, ShouldBeFalse)
+			So(rethink.SupportsFilter(OpMatch), ShouldBeTrue)
+			scribble, _ := CapabilitiesOf(stores["scribble"])
+			So(scribble.FilterOperators, ShouldBeEmpty)
+			So(scribble.Supports("Get"), ShouldBeTrue)
+			So(bolt.WriteResults && pg.WriteResults && rethink.WriteResults, ShouldBeTrue)
+			So(scribble.WriteResults, ShouldBeFalse)
+		})
+		Convey("Requirements are checked against the capabilities", func() {
+			bolt, _ := CapabilitiesOf(stores["bolt"])
+			So(bolt.Check(Requirements{Operations: []string{"FilterGetAll", "Query"}, FilterOperators: []FilterOperator{OpGt}, Geo: true}), ShouldBeNil)
+			err := bolt.Check(Requirements{Operations: []string{"Update", "Fetch"}, OrderBy: true})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "gostore: store does not support Update, Fetch (unknown operation), ordering")
+		})
+		Convey("Adapters describe the store they wrap", func() {
+			pg := stores["postgres"].(PostgresObjectStore)
+			c, ok := CapabilitiesOf(NewContextAdapter(struct {
+				ObjectStore
+				CapableStore
+			}{pg, pg}))
+			So(ok, ShouldBeTrue)
+			So(c.Supports("AllCursor"), ShouldBeFalse)
+			So(c.Context, ShouldBeTrue)
+			c, _ = CapabilitiesOf(NewContextAdapter(plainStore{pg}))
+			So(c.Supports("AllCursor"), ShouldBeTrue)
+			for _, store := range []CapableStore{NewCachedStore(pg, CacheOptions{}), NewHookedStore(pg), NewRetryStore(pg, RetryOptions{})} {
+				c = store.Capabilities()
+				So(c.WriteResults, ShouldBeTrue)
+				_, ok = store.(WriteResultStore)
+				So(ok, ShouldBeTrue)
+			}
+			c = NewHookedStore(stores["scribble"]).Capabilities()
+			So(c.WriteResults, ShouldBeFalse)
+		})
+	})
+}
+
+func errString(err interface{}) string {
+	if err, ok := err.(error); ok && err != nil {
+		return err.Error()
+	}
+	return "<nil>"
+}
+
+func TestBoltGetByField(t *testing.T) {
+	Convey("Giving a bolt store with some things", t, func() {
+		store, done := newTestBoltStore()
+		defer done()
+		saveBoltThings(store)
+		Convey("The newest row with the field is retrieved", func() {
+			var row map[string]interface{}
+			So(store.GetByField("kind", "thing", collection, &row), ShouldBeNil)
+			So(row["id"], ShouldEqual, "2")
+			So(store.GetByField("food.type", "egg", collection, &row), ShouldBeNil)
+			So(row["id"], ShouldEqual, "1")
+			So(store.GetByField("kind", "=thing|fish", collection, &row), ShouldEqual, ErrNotFound)
+		})
+	})
+}
@@ -0,0 +1,171 @@
+package gostore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/dustin/gojson"
+	"github.com/ugorji/go/codec"
+)
+
+// ErrCodecMismatch is returned when a table was written with another codec than the one of the store
+var ErrCodecMismatch = errors.New("table was written with a different codec")
+
+// Codec encodes the rows of a key-value store. Its name is recorded with every table so rows
+// written with one codec are never decoded with another
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSONCodec encodes rows as JSON, it is the default and the format of tables written before codecs existed
+	JSONCodec Codec = jsonCodec{}
+	// MsgpackCodec encodes rows as MessagePack
+	MsgpackCodec Codec = newMsgpackCodec()
+	// CBORCodec encodes rows as CBOR
+	CBORCodec Codec = newCBORCodec()
+	// GobCodec encodes rows with encoding/gob. Gob only decodes into the type which was encoded, so
+	// rows which are filtered or indexed must be saved as map[string]interface{}
+	GobCodec Codec = gobCodec{}
+)
+
+var codecs = struct {
+	sync.RWMutex
+	byName map[string]Codec
+}{byName: make(map[string]Codec)}
+
+func init() {
+	for _, c := range []Codec{JSONCodec, MsgpackCodec, CBORCodec, GobCodec} {
+		RegisterCodec(c)
+	}
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// RegisterCodec makes a codec available to stores opening tables recorded with its name
+func RegisterCodec(c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.byName[c.Name()] = c
+}
+
+// CodecByName returns a registered codec
+func CodecByName(name string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	c, ok := codecs.byName[name]
+	return c, ok
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// ugorjiCodec decodes documents into map[string]interface{} and strings as strings so rows decode
+// to the same shapes as JSON, struct fields are named by their json tags
+type ugorjiCodec struct {
+	name   string
+	handle codec.Handle
+}
+
+var docMapType = reflect.TypeOf(map[string]interface{}(nil))
+
+func newMsgpackCodec() ugorjiCodec {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	h.MapType = docMapType
+	h.RawToString = true
+	return ugorjiCodec{"msgpack", h}
+}
+
+func newCBORCodec() ugorjiCodec {
+	h := &codec.CborHandle{}
+	h.MapType = docMapType
+	return ugorjiCodec{"cbor", h}
+}
+
+func (c ugorjiCodec) Name() string { return c.name }
+
+func (c ugorjiCodec) Marshal(v interface{}) (data []byte, err error) {
+	err = codec.NewEncoderBytes(&data, c.handle).Encode(v)
+	return
+}
+
+func (c ugorjiCodec) Unmarshal(data []byte, v interface{}) error {
+	return codec.NewDecoderBytes(data, c.handle).Decode(v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	//gob cannot decode into an empty interface, documents are decoded into a map instead
+	if p, ok := v.(*interface{}); ok {
+		var doc map[string]interface{}
+		if err := dec.Decode(&doc); err != nil {
+			return err
+		}
+		*p = doc
+		return nil
+	}
+	return dec.Decode(v)
+}
+
+// setRowKey exposes the key of a row as its id, like the rows of the other stores. dst may be a
+// StoreObj, a map or a pointer to a struct with a string field tagged json:"id" or named Id or ID
+func setRowKey(dst interface{}, key string) {
+	switch d := dst.(type) {
+	case StoreObj:
+		d.SetKey(key)
+		return
+	case map[string]interface{}:
+		d["id"] = key
+		return
+	case *map[string]interface{}:
+		if *d == nil {
+			*d = make(map[string]interface{})
+		}
+		(*d)["id"] = key
+		return
+	case *interface{}:
+		if m, ok := (*d).(map[string]interface{}); ok {
+			m["id"] = key
+		}
+		return
+	}
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	v = v.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "id" || (name == "" && (f.Name == "Id" || f.Name == "ID")) {
+			if fv := v.Field(i); fv.Kind() == reflect.String && fv.CanSet() {
+				fv.SetString(key)
+			}
+			return
+		}
+	}
+}
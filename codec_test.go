@@ -0,0 +1,97 @@
+package gostore
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type codecThing struct {
+	Id     string  `json:"id"`
+	Name   string  `json:"name"`
+	Rating float64 `json:"rating"`
+}
+
+func TestCodecs(t *testing.T) {
+	Convey("Giving the built in codecs", t, func() {
+		doc := map[string]interface{}{"name": "First Thing", "rating": 4.5, "tags": []interface{}{"a", "b"}}
+		for _, name := range []string{"json", "msgpack", "cbor", "gob"} {
+			codec, ok := CodecByName(name)
+			So(ok, ShouldBeTrue)
+			So(codec.Name(), ShouldEqual, name)
+			Convey("Documents round trip through "+name, func() {
+				data, err := codec.Marshal(doc)
+				So(err, ShouldBeNil)
+				var out interface{}
+				So(codec.Unmarshal(data, &out), ShouldBeNil)
+				m, ok := out.(map[string]interface{})
+				So(ok, ShouldBeTrue)
+				So(m["name"], ShouldEqual, "First Thing")
+				So(m["rating"], ShouldEqual, 4.5)
+				So(m["tags"], ShouldResemble, []interface{}{"a", "b"})
+			})
+		}
+		Convey("Struct fields are named by their json tags", func() {
+			data, err := MsgpackCodec.Marshal(codecThing{Name: "thing", Rating: 2})
+			So(err, ShouldBeNil)
+			var m map[string]interface{}
+			So(MsgpackCodec.Unmarshal(data, &m), ShouldBeNil)
+			So(m["name"], ShouldEqual, "thing")
+		})
+		Convey("The key of a row is set on structs and maps", func() {
+			var thing codecThing
+			setRowKey(&thing, "1")
+			So(thing.Id, ShouldEqual, "1")
+			var m map[string]interface{}
+			setRowKey(&m, "2")
+			So(m["id"], ShouldEqual, "2")
+		})
+	})
+}
+
+func TestBoltCodec(t *testing.T) {
+	Convey("Giving a bolt store encoding rows as msgpack", t, func() {
+		json, done := newTestBoltStore()
+		defer done()
+		store := json.WithCodec(MsgpackCodec)
+		saveBoltThings(store)
+		Convey("Rows are filtered, indexed and decoded with the codec", func() {
+			So(store.CreateTable(collection, map[string]interface{}{"index": map[string]interface{}{"kind": []string{"kind"}}}), ShouldBeNil)
+			So(rowIds(store.FilterGetAll(map[string]interface{}{"kind": "thing", "rating": ">4"}, 0, 0, collection, nil)), ShouldResemble, []string{"1"})
+			var thing codecThing
+			So(store.Get("2", collection, &thing), ShouldBeNil)
+			So(thing.Name, ShouldEqual, "Second Thing")
+			rows, err := store.All(1, 0, collection)
+			So(err, ShouldBeNil)
+			defer rows.Close()
+			thing = codecThing{}
+			ok, err := rows.Next(&thing)
+			So(ok, ShouldBeTrue)
+			So(err, ShouldBeNil)
+			So(thing.Id, ShouldEqual, "4")
+			So(thing.Name, ShouldEqual, "Fourth Fish")
+		})
+		Convey("The table refuses stores with another codec", func() {
+			var thing map[string]interface{}
+			So(json.Get("1", collection, &thing), ShouldEqual, ErrCodecMismatch)
+			_, err := json.Save("5", collection, map[string]interface{}{"name": "Fifth"})
+			So(err, ShouldEqual, ErrCodecMismatch)
+		})
+	})
+	Convey("Giving a table written before codecs were recorded", t, func() {
+		store, done := newTestBoltStore()
+		defer done()
+		saveBoltThings(store)
+		So(store.Db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(boltMetaBucket).Delete(boltCodecKey(collection))
+		}), ShouldBeNil)
+		Convey("It is read as JSON", func() {
+			codec, err := store.readCodec(collection)
+			So(err, ShouldBeNil)
+			So(codec.Name(), ShouldEqual, "json")
+			_, err = store.WithCodec(CBORCodec).readCodec(collection)
+			So(err, ShouldEqual, ErrCodecMismatch)
+		})
+	})
+}
@@ -0,0 +1,128 @@
+package gostore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	r "github.com/gorethink/gorethink"
+	"github.com/jinzhu/gorm"
+	"github.com/osiloke/gostore"
+	gostoretesting "github.com/osiloke/gostore/testing"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func tempStore(open func(dir string) (gostore.ObjectStore, error)) gostoretesting.Factory {
+	return func() (gostore.ObjectStore, func()) {
+		dir, err := ioutil.TempDir("", "gostore-conformance")
+		if err != nil {
+			panic(err)
+		}
+		store, err := open(dir)
+		if err != nil {
+			panic(err)
+		}
+		return store, func() {
+			store.Close()
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+func TestBoltConformance(t *testing.T) {
+	gostoretesting.RunConformance(t, tempStore(func(dir string) (gostore.ObjectStore, error) {
+		return gostore.NewBoltObjectStore(filepath.Join(dir, "test.db"))
+	}))
+}
+
+func TestBoltMsgpackConformance(t *testing.T) {
+	gostoretesting.RunConformance(t, tempStore(func(dir string) (gostore.ObjectStore, error) {
+		return gostore.Open("bolt://" + filepath.Join(dir, "test.db") + "?codec=msgpack")
+	}))
+}
+
+func TestScribbleConformance(t *testing.T) {
+	gostoretesting.RunConformance(t, tempStore(func(dir string) (gostore.ObjectStore, error) {
+		return gostore.Open("scribble://" + dir)
+	}))
+}
+
+// TestRethinkConformance needs a rethinkdb server, its address is read from GOSTORE_RETHINKDB
+func TestRethinkConformance(t *testing.T) {
+	address := os.Getenv("GOSTORE_RETHINKDB")
+	if address == "" {
+		t.Skip("GOSTORE_RETHINKDB is not set")
+	}
+	gostoretesting.RunConformance(t, func() (gostore.ObjectStore, func()) {
+		store, err := gostore.NewRethinkObjectStoreAndSession(address, "gostore_conformance")
+		if err != nil {
+			panic(err)
+		}
+		return store, func() {
+			r.DBDrop(store.Database).Exec(store.Session)
+			store.Close()
+		}
+	})
+}
+
+// TestPostgresConformance needs a postgres server, its url is read from GOSTORE_POSTGRES
+func TestPostgresConformance(t *testing.T) {
+	dsn := os.Getenv("GOSTORE_POSTGRES")
+	if dsn == "" {
+		t.Skip("GOSTORE_POSTGRES is not set")
+	}
+	gostoretesting.RunConformance(t, func() (gostore.ObjectStore, func()) {
+		db, err := gorm.Open("postgres", dsn)
+		if err != nil {
+			panic(err)
+		}
+		store := gostore.NewPostgresObjectStore(db, "")
+		drop := func() {
+			db.Exec("DROP TABLE IF EXISTS " + gostoretesting.Table)
+		}
+		drop()
+		return store, func() {
+			drop()
+			store.Close()
+		}
+	})
+}
+
+func TestMemoryConformance(t *testing.T) {
+	gostoretesting.RunConformance(t, func() (gostore.ObjectStore, func()) {
+		store := gostore.NewMemoryStore()
+		return store, store.Close
+	})
+}
+
+func TestCachedConformance(t *testing.T) {
+	gostoretesting.RunConformance(t, func() (gostore.ObjectStore, func()) {
+		store := gostore.NewCachedStore(gostore.NewMemoryStore(), gostore.CacheOptions{})
+		return store, store.Close
+	})
+}
+
+func TestInstrumentedConformance(t *testing.T) {
+	gostoretesting.RunConformance(t, func() (gostore.ObjectStore, func()) {
+		store, err := gostore.NewInstrumentedStore(gostore.NewMemoryStore(), gostore.InstrumentOptions{Registerer: prometheus.NewRegistry()})
+		if err != nil {
+			panic(err)
+		}
+		return store, store.Close
+	})
+}
+
+func TestRetryConformance(t *testing.T) {
+	gostoretesting.RunConformance(t, func() (gostore.ObjectStore, func()) {
+		store := gostore.NewRetryStore(gostore.NewMemoryStore(), gostore.RetryOptions{})
+		return store, store.Close
+	})
+}
+
+func TestHookedConformance(t *testing.T) {
+	gostoretesting.RunConformance(t, func() (gostore.ObjectStore, func()) {
+		store := gostore.NewHookedStore(gostore.NewMemoryStore())
+		return store, store.Close
+	})
+}
@@ -0,0 +1,504 @@
+package gostore
+
+import (
+	"context"
+)
+
+// ContextObjectStore is the ObjectStore api with a context as the first argument of every call
+// which reaches the database. A done context fails calls with its error and stops the ObjectRows
+// they return, a deadline is propagated to the database where the driver supports it
+type ContextObjectStore interface {
+	CreateDatabaseContext(ctx context.Context) error
+	CreateTableContext(ctx context.Context, table string, sample interface{}) error
+	StatsContext(ctx context.Context, store string) (map[string]interface{}, error)
+	AllContext(ctx context.Context, count int, skip int, store string) (ObjectRows, error)
+	AllCursorContext(ctx context.Context, store string) (ObjectRows, error)
+	AllWithinRangeContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error)
+	SinceContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error)
+	BeforeContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error)
+	FilterSinceContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error)
+	FilterBeforeContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error)
+	FilterBeforeCountContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (int64, error)
+	GetContext(ctx context.Context, key string, store string, dst interface{}) error
+	SaveContext(ctx context.Context, key, store string, src interface{}) (string, error)
+	SaveAllContext(ctx context.Context, store string, src ...interface{}) ([]string, error)
+	UpdateContext(ctx context.Context, key string, store string, src interface{}) error
+	ReplaceContext(ctx context.Context, key string, store string, src interface{}) error
+	DeleteContext(ctx context.Context, key string, store string) error
+	FilterUpdateContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error
+	FilterReplaceContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error
+	FilterGetContext(ctx context.Context, filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error
+	FilterGetAllContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error)
+	QueryContext(ctx context.Context, filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error)
+	FilterDeleteContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) error
+	FilterCountContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) (int64, error)
+	GetByFieldContext(ctx context.Context, name, val, store string, dst interface{}) error
+	GetByFieldsByFieldContext(ctx context.Context, name, val, store string, fields []string, dst interface{}) error
+	BatchDeleteContext(ctx context.Context, ids []interface{}, store string, opts ObjectStoreOptions) error
+	BatchUpdateContext(ctx context.Context, ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error
+	BatchFilterDeleteContext(ctx context.Context, filter []map[string]interface{}, store string, opts ObjectStoreOptions) error
+	BatchInsertContext(ctx context.Context, data []interface{}, store string, opts ObjectStoreOptions) ([]string, error)
+
+	GetStore() interface{}
+	Close()
+}
+
+// NewContextRows returns rows which stop once ctx is done. Next then closes rows and fails with the
+// error of ctx, which LastError also returns
+func NewContextRows(ctx context.Context, rows ObjectRows) ObjectRows {
+	return &ctxRows{ObjectRows: rows, ctx: ctx}
+}
+
+// contextRows wraps the rows returned by a call made with ctx
+func contextRows(ctx context.Context, rows ObjectRows, err error) (ObjectRows, error) {
+	if err != nil || rows == nil {
+		return rows, err
+	}
+	return NewContextRows(ctx, rows), nil
+}
+
+type ctxRows struct {
+	ObjectRows
+	ctx    context.Context
+	err    error
+	closed bool
+}
+
+func (r *ctxRows) done() bool {
+	if r.err == nil {
+		if r.err = r.ctx.Err(); r.err != nil {
+			r.Close()
+		}
+	}
+	return r.err != nil
+}
+
+func (r *ctxRows) Next(dst interface{}) (bool, error) {
+	if r.done() {
+		return false, r.err
+	}
+	return r.ObjectRows.Next(dst)
+}
+
+func (r *ctxRows) NextRaw() ([]byte, bool) {
+	if r.done() {
+		return nil, false
+	}
+	return r.ObjectRows.NextRaw()
+}
+
+func (r *ctxRows) LastError() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.ObjectRows.LastError()
+}
+
+func (r *ctxRows) Close() {
+	if !r.closed {
+		r.closed = true
+		r.ObjectRows.Close()
+	}
+}
+
+// NewContextAdapter returns a ContextObjectStore for a store which only implements ObjectStore.
+// Calls fail once their context is done and the rows they return stop, but a call which already
+// reached the database is not cancelled. Stores which implement ContextObjectStore are returned as is
+func NewContextAdapter(store ObjectStore) ContextObjectStore {
+	if s, ok := store.(ContextObjectStore); ok {
+		return s
+	}
+	return contextAdapter{store}
+}
+
+// NewObjectStoreAdapter returns an ObjectStore for callers of the api without contexts, every call
+// is made with context.Background(). Stores which implement ObjectStore are returned as is
+func NewObjectStoreAdapter(store ContextObjectStore) ObjectStore {
+	if s, ok := store.(ObjectStore); ok {
+		return s
+	}
+	return objectStoreAdapter{store}
+}
+
+type contextAdapter struct {
+	store ObjectStore
+}
+
+func (a contextAdapter) GetStore() interface{} {
+	return a.store.GetStore()
+}
+
+func (a contextAdapter) Close() {
+	a.store.Close()
+}
+
+// Capabilities describes the wrapped store, one which does not describe itself is assumed to
+// implement every operation
+func (a contextAdapter) Capabilities() Capabilities {
+	c, ok := CapabilitiesOf(a.store)
+	if !ok {
+		c = newCapabilities(a.store)
+	}
+	c.Context = true
+	return c
+}
+
+func (a contextAdapter) CreateDatabaseContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.CreateDatabase()
+}
+
+func (a contextAdapter) CreateTableContext(ctx context.Context, table string, sample interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.CreateTable(table, sample)
+}
+
+func (a contextAdapter) StatsContext(ctx context.Context, store string) (map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.store.Stats(store)
+}
+
+func (a contextAdapter) AllContext(ctx context.Context, count int, skip int, store string) (ObjectRows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := a.store.All(count, skip, store)
+	return contextRows(ctx, rows, err)
+}
+
+func (a contextAdapter) AllCursorContext(ctx context.Context, store string) (ObjectRows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := a.store.AllCursor(store)
+	return contextRows(ctx, rows, err)
+}
+
+func (a contextAdapter) AllWithinRangeContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := a.store.AllWithinRange(filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (a contextAdapter) SinceContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := a.store.Since(id, count, skip, store)
+	return contextRows(ctx, rows, err)
+}
+
+func (a contextAdapter) BeforeContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := a.store.Before(id, count, skip, store)
+	return contextRows(ctx, rows, err)
+}
+
+func (a contextAdapter) FilterSinceContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := a.store.FilterSince(id, filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (a contextAdapter) FilterBeforeContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := a.store.FilterBefore(id, filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (a contextAdapter) FilterBeforeCountContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return a.store.FilterBeforeCount(id, filter, count, skip, store, opts)
+}
+
+func (a contextAdapter) GetContext(ctx context.Context, key string, store string, dst interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.Get(key, store, dst)
+}
+
+func (a contextAdapter) SaveContext(ctx context.Context, key, store string, src interface{}) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return a.store.Save(key, store, src)
+}
+
+func (a contextAdapter) SaveAllContext(ctx context.Context, store string, src ...interface{}) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.store.SaveAll(store, src...)
+}
+
+func (a contextAdapter) UpdateContext(ctx context.Context, key string, store string, src interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.Update(key, store, src)
+}
+
+func (a contextAdapter) ReplaceContext(ctx context.Context, key string, store string, src interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.Replace(key, store, src)
+}
+
+func (a contextAdapter) DeleteContext(ctx context.Context, key string, store string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.Delete(key, store)
+}
+
+func (a contextAdapter) FilterUpdateContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.FilterUpdate(filter, src, store, opts)
+}
+
+func (a contextAdapter) FilterReplaceContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.FilterReplace(filter, src, store, opts)
+}
+
+func (a contextAdapter) FilterGetContext(ctx context.Context, filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.FilterGet(filter, store, dst, opts)
+}
+
+func (a contextAdapter) FilterGetAllContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := a.store.FilterGetAll(filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (a contextAdapter) QueryContext(ctx context.Context, filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	rows, agg, err := a.store.Query(filter, aggregates, count, skip, store, opts)
+	rows, err = contextRows(ctx, rows, err)
+	return rows, agg, err
+}
+
+func (a contextAdapter) FilterDeleteContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.FilterDelete(filter, store, opts)
+}
+
+func (a contextAdapter) FilterCountContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return a.store.FilterCount(filter, store, opts)
+}
+
+func (a contextAdapter) GetByFieldContext(ctx context.Context, name, val, store string, dst interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.GetByField(name, val, store, dst)
+}
+
+func (a contextAdapter) GetByFieldsByFieldContext(ctx context.Context, name, val, store string, fields []string, dst interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.GetByFieldsByField(name, val, store, fields, dst)
+}
+
+func (a contextAdapter) BatchDeleteContext(ctx context.Context, ids []interface{}, store string, opts ObjectStoreOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.BatchDelete(ids, store, opts)
+}
+
+func (a contextAdapter) BatchUpdateContext(ctx context.Context, ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.BatchUpdate(ids, data, store, opts)
+}
+
+func (a contextAdapter) BatchFilterDeleteContext(ctx context.Context, filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.BatchFilterDelete(filter, store, opts)
+}
+
+func (a contextAdapter) BatchInsertContext(ctx context.Context, data []interface{}, store string, opts ObjectStoreOptions) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.store.BatchInsert(data, store, opts)
+}
+
+type objectStoreAdapter struct {
+	store ContextObjectStore
+}
+
+func (a objectStoreAdapter) GetStore() interface{} {
+	return a.store.GetStore()
+}
+
+func (a objectStoreAdapter) Close() {
+	a.store.Close()
+}
+
+func (a objectStoreAdapter) Capabilities() Capabilities {
+	c, ok := CapabilitiesOf(a.store)
+	if !ok {
+		c = newCapabilities(a.store)
+	}
+	return c
+}
+
+func (a objectStoreAdapter) CreateDatabase() error {
+	return a.store.CreateDatabaseContext(context.Background())
+}
+
+func (a objectStoreAdapter) CreateTable(table string, sample interface{}) error {
+	return a.store.CreateTableContext(context.Background(), table, sample)
+}
+
+func (a objectStoreAdapter) Stats(store string) (map[string]interface{}, error) {
+	return a.store.StatsContext(context.Background(), store)
+}
+
+func (a objectStoreAdapter) All(count int, skip int, store string) (ObjectRows, error) {
+	return a.store.AllContext(context.Background(), count, skip, store)
+}
+
+func (a objectStoreAdapter) AllCursor(store string) (ObjectRows, error) {
+	return a.store.AllCursorContext(context.Background(), store)
+}
+
+func (a objectStoreAdapter) AllWithinRange(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return a.store.AllWithinRangeContext(context.Background(), filter, count, skip, store, opts)
+}
+
+func (a objectStoreAdapter) Since(id string, count int, skip int, store string) (ObjectRows, error) {
+	return a.store.SinceContext(context.Background(), id, count, skip, store)
+}
+
+func (a objectStoreAdapter) Before(id string, count int, skip int, store string) (ObjectRows, error) {
+	return a.store.BeforeContext(context.Background(), id, count, skip, store)
+}
+
+func (a objectStoreAdapter) FilterSince(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return a.store.FilterSinceContext(context.Background(), id, filter, count, skip, store, opts)
+}
+
+func (a objectStoreAdapter) FilterBefore(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return a.store.FilterBeforeContext(context.Background(), id, filter, count, skip, store, opts)
+}
+
+func (a objectStoreAdapter) FilterBeforeCount(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (int64, error) {
+	return a.store.FilterBeforeCountContext(context.Background(), id, filter, count, skip, store, opts)
+}
+
+func (a objectStoreAdapter) Get(key string, store string, dst interface{}) error {
+	return a.store.GetContext(context.Background(), key, store, dst)
+}
+
+func (a objectStoreAdapter) Save(key, store string, src interface{}) (string, error) {
+	return a.store.SaveContext(context.Background(), key, store, src)
+}
+
+func (a objectStoreAdapter) SaveAll(store string, src ...interface{}) ([]string, error) {
+	return a.store.SaveAllContext(context.Background(), store, src...)
+}
+
+func (a objectStoreAdapter) Update(key string, store string, src interface{}) error {
+	return a.store.UpdateContext(context.Background(), key, store, src)
+}
+
+func (a objectStoreAdapter) Replace(key string, store string, src interface{}) error {
+	return a.store.ReplaceContext(context.Background(), key, store, src)
+}
+
+func (a objectStoreAdapter) Delete(key string, store string) error {
+	return a.store.DeleteContext(context.Background(), key, store)
+}
+
+func (a objectStoreAdapter) FilterUpdate(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return a.store.FilterUpdateContext(context.Background(), filter, src, store, opts)
+}
+
+func (a objectStoreAdapter) FilterReplace(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return a.store.FilterReplaceContext(context.Background(), filter, src, store, opts)
+}
+
+func (a objectStoreAdapter) FilterGet(filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	return a.store.FilterGetContext(context.Background(), filter, store, dst, opts)
+}
+
+func (a objectStoreAdapter) FilterGetAll(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return a.store.FilterGetAllContext(context.Background(), filter, count, skip, store, opts)
+}
+
+func (a objectStoreAdapter) Query(filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error) {
+	return a.store.QueryContext(context.Background(), filter, aggregates, count, skip, store, opts)
+}
+
+func (a objectStoreAdapter) FilterDelete(filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return a.store.FilterDeleteContext(context.Background(), filter, store, opts)
+}
+
+func (a objectStoreAdapter) FilterCount(filter map[string]interface{}, store string, opts ObjectStoreOptions) (int64, error) {
+	return a.store.FilterCountContext(context.Background(), filter, store, opts)
+}
+
+func (a objectStoreAdapter) GetByField(name, val, store string, dst interface{}) error {
+	return a.store.GetByFieldContext(context.Background(), name, val, store, dst)
+}
+
+func (a objectStoreAdapter) GetByFieldsByField(name, val, store string, fields []string, dst interface{}) error {
+	return a.store.GetByFieldsByFieldContext(context.Background(), name, val, store, fields, dst)
+}
+
+func (a objectStoreAdapter) BatchDelete(ids []interface{}, store string, opts ObjectStoreOptions) error {
+	return a.store.BatchDeleteContext(context.Background(), ids, store, opts)
+}
+
+func (a objectStoreAdapter) BatchUpdate(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	return a.store.BatchUpdateContext(context.Background(), ids, data, store, opts)
+}
+
+func (a objectStoreAdapter) BatchFilterDelete(filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return a.store.BatchFilterDeleteContext(context.Background(), filter, store, opts)
+}
+
+func (a objectStoreAdapter) BatchInsert(data []interface{}, store string, opts ObjectStoreOptions) ([]string, error) {
+	return a.store.BatchInsertContext(context.Background(), data, store, opts)
+}
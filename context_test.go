@@ -0,0 +1,130 @@
+package gostore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	r "github.com/gorethink/gorethink"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// plainStore only implements ObjectStore
+type plainStore struct {
+	ObjectStore
+}
+
+// contextOnlyStore only implements ContextObjectStore
+type contextOnlyStore struct {
+	ContextObjectStore
+}
+
+func TestBoltContext(t *testing.T) {
+	Convey("Giving a bolt store with some things", t, func() {
+		store, done := newTestBoltStore()
+		defer done()
+		saveBoltThings(store)
+		var row map[string]interface{}
+		Convey("Calls succeed while the context is live", func() {
+			So(store.GetContext(context.Background(), "1", collection, &row), ShouldBeNil)
+			So(row["name"], ShouldEqual, "First Thing")
+			So(rowIds(store.FilterGetAllContext(context.Background(), map[string]interface{}{"kind": "thing"}, 0, 0, collection, nil)), ShouldResemble, []string{"2", "1"})
+		})
+		Convey("Calls fail once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			So(store.GetContext(ctx, "1", collection, &row), ShouldEqual, context.Canceled)
+			_, err := store.SaveContext(ctx, "5", collection, map[string]interface{}{"name": "Fifth"})
+			So(err, ShouldEqual, context.Canceled)
+			_, err = store.FilterGetAllContext(ctx, nil, 0, 0, collection, nil)
+			So(err, ShouldEqual, context.Canceled)
+			ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+			defer cancel()
+			_, err = store.FilterCountContext(ctx, nil, collection, nil)
+			So(err, ShouldResemble, context.DeadlineExceeded)
+		})
+		Convey("Rows stop and release their transaction when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			rows, err := store.AllCursorContext(ctx, collection)
+			So(err, ShouldBeNil)
+			ok, err := rows.Next(&row)
+			So(ok, ShouldBeTrue)
+			So(err, ShouldBeNil)
+			cancel()
+			ok, err = rows.Next(&row)
+			So(ok, ShouldBeFalse)
+			So(err, ShouldEqual, context.Canceled)
+			So(rows.LastError(), ShouldEqual, context.Canceled)
+			So(rows.(*ctxRows).ObjectRows.(*BoltRows).tx, ShouldBeNil)
+			rows.Close()
+		})
+	})
+}
+
+func TestContextAdapters(t *testing.T) {
+	Convey("Giving a bolt store with some things", t, func() {
+		store, done := newTestBoltStore()
+		defer done()
+		saveBoltThings(store)
+		var row map[string]interface{}
+		Convey("Stores which support contexts are not wrapped", func() {
+			So(NewContextAdapter(store), ShouldResemble, store)
+			So(NewObjectStoreAdapter(store), ShouldResemble, store)
+		})
+		Convey("A store without contexts checks the context around its calls", func() {
+			adapted := NewContextAdapter(plainStore{store})
+			So(adapted.GetContext(context.Background(), "2", collection, &row), ShouldBeNil)
+			So(row["name"], ShouldEqual, "Second Thing")
+			ctx, cancel := context.WithCancel(context.Background())
+			So(adapted.GetContext(ctx, "2", collection, &row), ShouldBeNil)
+			rows, err := adapted.AllContext(ctx, 0, 0, collection)
+			So(err, ShouldBeNil)
+			cancel()
+			So(adapted.GetContext(ctx, "2", collection, &row), ShouldEqual, context.Canceled)
+			ok, err := rows.Next(&row)
+			So(ok, ShouldBeFalse)
+			So(err, ShouldEqual, context.Canceled)
+		})
+		Convey("A store with only contexts serves callers of ObjectStore", func() {
+			adapted := NewObjectStoreAdapter(contextOnlyStore{store})
+			So(adapted.Get("3", collection, &row), ShouldBeNil)
+			So(row["name"], ShouldEqual, "First Something")
+			So(rowIds(adapted.Before("3", 0, 0, collection)), ShouldResemble, []string{"2", "1"})
+		})
+	})
+}
+
+func TestRethinkContext(t *testing.T) {
+	Convey("Giving a rethink store", t, func() {
+		mock := r.NewMock()
+		mock.On(r.DB("gostore_test").Table("things").Get("4")).Return(map[string]interface{}{"id": "4", "name": "Fourth"}, nil)
+		store := RethinkStore{mock, "gostore_test"}
+		var row map[string]interface{}
+		Convey("Queries run with the context", func() {
+			So(store.GetContext(context.Background(), "4", collection, &row), ShouldBeNil)
+			So(row["name"], ShouldEqual, "Fourth")
+		})
+		Convey("Queries are not sent once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			So(store.GetContext(ctx, "4", collection, &row), ShouldEqual, context.Canceled)
+			So(store.DeleteContext(ctx, "4", collection), ShouldEqual, context.Canceled)
+		})
+	})
+}
+
+func TestScribbleContext(t *testing.T) {
+	Convey("Giving a scribble store", t, func() {
+		store := NewScribbleStore("/tmp/scribble.context.test.json")
+		Convey("Calls fail once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			_, err := store.SaveContext(ctx, "1", collection, map[string]interface{}{"name": "First"})
+			So(err, ShouldBeNil)
+			cancel()
+			var row map[string]interface{}
+			So(store.GetContext(ctx, "1", collection, &row), ShouldEqual, context.Canceled)
+			So(store.DeleteContext(context.Background(), "1", collection), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,79 @@
+package gostore
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOpen(t *testing.T) {
+	Convey("Giving the registered drivers", t, func() {
+		So(Drivers(), ShouldResemble, []string{"bolt", "memory", "postgres", "postgresql", "rethinkdb", "scribble"})
+		dir, err := ioutil.TempDir("", "gostore-open")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		Convey("A bolt url opens a bolt store with its codec", func() {
+			store, err := Open("bolt://" + filepath.Join(dir, "app.db") + "?codec=msgpack")
+			So(err, ShouldBeNil)
+			defer store.Close()
+			bs, ok := store.(BoltStore)
+			So(ok, ShouldBeTrue)
+			So(bs.Codec().Name(), ShouldEqual, "msgpack")
+			_, err = store.Save("1", collection, map[string]interface{}{"name": "First Thing"})
+			So(err, ShouldBeNil)
+			var row map[string]interface{}
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			So(row["name"], ShouldEqual, "First Thing")
+			_, err = Open("bolt://" + filepath.Join(dir, "other.db") + "?codec=yaml")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("A scribble url opens a scribble store", func() {
+			store, err := Open("scribble://" + filepath.Join(dir, "scribble"))
+			So(err, ShouldBeNil)
+			_, ok := store.(*ScribbleStore)
+			So(ok, ShouldBeTrue)
+		})
+		Convey("A memory url opens an empty memory store", func() {
+			store, err := Open("memory://")
+			So(err, ShouldBeNil)
+			_, ok := store.(MemoryStore)
+			So(ok, ShouldBeTrue)
+		})
+		Convey("Urls without a path or database are refused", func() {
+			_, err := Open("bolt://")
+			So(err, ShouldNotBeNil)
+			_, err = Open("rethinkdb://localhost:28015")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Unknown schemes are refused", func() {
+			_, err := Open("mongodb://localhost/app")
+			So(err.Error(), ShouldContainSubstring, `unknown driver "mongodb"`)
+		})
+	})
+	Convey("Giving a driver registered by an application", t, func() {
+		var opened *url.URL
+		Register("test-memory", DriverFunc(func(u *url.URL) (ObjectStore, error) {
+			opened = u
+			return ScribbleStore{}, nil
+		}))
+		defer func() {
+			drivers.Lock()
+			delete(drivers.byScheme, "test-memory")
+			drivers.Unlock()
+		}()
+		Convey("Open hands it the parsed url", func() {
+			_, err := Open("TEST-MEMORY://host/app?x=1")
+			So(err, ShouldBeNil)
+			So(opened.Host, ShouldEqual, "host")
+			So(opened.Query().Get("x"), ShouldEqual, "1")
+		})
+		Convey("A scheme cannot be registered twice", func() {
+			So(func() { Register("test-memory", DriverFunc(nil)) }, ShouldPanic)
+			So(func() { Register("other", nil) }, ShouldPanic)
+		})
+	})
+}
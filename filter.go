@@ -0,0 +1,444 @@
+package gostore
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/now"
+)
+
+// FilterOperator is the comparison a FilterCondition performs on a field
+type FilterOperator string
+
+const (
+	//OpEq matches when the field equals any of the operands, "=a|b", "=2017-01-01|dt" or "a"
+	OpEq FilterOperator = "="
+	//OpMatch matches when the field matches any of the regex operands, "~a|b"
+	OpMatch FilterOperator = "~"
+	//OpGt matches when the field is greater than the operand, ">5" or ">2017-01-01|dt"
+	OpGt FilterOperator = ">"
+	//OpLt matches when the field is less than the operand, "<5" or "<2017-01-01|dt"
+	OpLt FilterOperator = "<"
+	//OpExists matches when the field is set to a truthy value, ""
+	OpExists FilterOperator = "exists"
+)
+
+// FilterOperators lists every operator understood by the filter parser
+var FilterOperators = []FilterOperator{OpEq, OpMatch, OpGt, OpLt, OpExists}
+
+// GroupOperator joins the expressions of a FilterGroup
+type GroupOperator string
+
+const (
+	AndGroup GroupOperator = "and"
+	OrGroup  GroupOperator = "or"
+)
+
+// FilterValueKind is the type of a parsed filter operand
+type FilterValueKind int
+
+const (
+	StringValue FilterValueKind = iota
+	NumberValue
+	BoolValue
+	TimeValue
+	NullValue
+)
+
+func (k FilterValueKind) String() string {
+	switch k {
+	case StringValue:
+		return "string"
+	case NumberValue:
+		return "number"
+	case BoolValue:
+		return "bool"
+	case TimeValue:
+		return "time"
+	case NullValue:
+		return "null"
+	}
+	return "unknown"
+}
+
+// FilterValue is a typed operand of a FilterCondition. Raw holds the operand as it
+// appeared in the filter, the remaining fields hold the value for its Kind
+type FilterValue struct {
+	Kind   FilterValueKind
+	Raw    string
+	Str    string
+	Number float64
+	Bool   bool
+	Time   time.Time
+
+	re *regexp.Regexp
+}
+
+// Interface returns the operand as a native go value
+func (v FilterValue) Interface() interface{} {
+	switch v.Kind {
+	case NumberValue:
+		return v.Number
+	case BoolValue:
+		return v.Bool
+	case TimeValue:
+		return v.Time
+	case NullValue:
+		return nil
+	}
+	return v.Str
+}
+
+func (v FilterValue) String() string {
+	switch v.Kind {
+	case StringValue:
+		return strconv.Quote(v.Str)
+	case TimeValue:
+		return v.Time.UTC().Format(time.RFC3339)
+	case NullValue:
+		return "null"
+	}
+	return v.Raw
+}
+
+// FilterExpr is a node in a parsed filter tree, either a *FilterCondition or a *FilterGroup
+type FilterExpr interface {
+	// Match reports whether a decoded document satisfies the expression
+	Match(doc map[string]interface{}) bool
+	String() string
+	filterExpr()
+}
+
+// FilterCondition compares the field at Path against Values. Multiple values are alternatives,
+// the condition holds when any of them matches
+type FilterCondition struct {
+	Path   []string
+	Op     FilterOperator
+	Values []FilterValue
+}
+
+func (c *FilterCondition) filterExpr() {}
+
+// Field returns the dotted field path of the condition
+func (c *FilterCondition) Field() string {
+	return strings.Join(c.Path, ".")
+}
+
+func (c *FilterCondition) String() string {
+	if c.Op == OpExists {
+		return c.Field()
+	}
+	vals := make([]string, len(c.Values))
+	for i, v := range c.Values {
+		vals[i] = v.String()
+	}
+	return fmt.Sprintf("%s %s %s", c.Field(), c.Op, strings.Join(vals, " | "))
+}
+
+// FilterGroup joins expressions with a logical and/or. An empty and group matches everything
+type FilterGroup struct {
+	Op    GroupOperator
+	Exprs []FilterExpr
+}
+
+func (g *FilterGroup) filterExpr() {}
+
+func (g *FilterGroup) String() string {
+	exprs := make([]string, len(g.Exprs))
+	for i, e := range g.Exprs {
+		exprs[i] = e.String()
+	}
+	return "(" + strings.Join(exprs, " "+string(g.Op)+" ") + ")"
+}
+
+// FilterError describes why a filter could not be parsed
+type FilterError struct {
+	Key    string
+	Value  interface{}
+	Reason string
+}
+
+func (e *FilterError) Error() string {
+	if e.Value != nil {
+		return fmt.Sprintf("invalid filter %q (%v): %s", e.Key, e.Value, e.Reason)
+	}
+	return fmt.Sprintf("invalid filter %q: %s", e.Key, e.Reason)
+}
+
+// ParseFilter turns a gostore filter map into an expression tree. The root of the tree is always an
+// and group. Currently supported filters:
+// field: "value" matches when field equals value, bars included
+// field: "=a|b" matches when field equals one of the alternatives, "=value|dt" when it equals a date
+// field: "~a|b" matches when field matches one of the regular expressions
+// field: ">value" or "<value" compares against a number or string, "value|dt" compares against a date
+// field: "" matches when the field is truthy
+// field: true, 5 or nil matches when the field equals the typed value
+// "a.b": ... or "a": {"b": ...} targets the nested field b of a
+// "or": {...} matches when any of the entries match
+// "or": [{...}, {...}] matches when all entries of any of the maps match, "and" works the same way
+func ParseFilter(filter map[string]interface{}) (*FilterGroup, error) {
+	exprs, err := parseFilterMap(nil, filter)
+	if err != nil {
+		return nil, err
+	}
+	return &FilterGroup{Op: AndGroup, Exprs: exprs}, nil
+}
+
+// fieldFilter matches rows whose field equals val as a string, unlike a filter map val is never
+// parsed so GetByField can look up values starting with an operator
+func fieldFilter(name, val string) *FilterGroup {
+	return &FilterGroup{Op: AndGroup, Exprs: []FilterExpr{&FilterCondition{
+		Path:   splitFieldPath(name),
+		Op:     OpEq,
+		Values: []FilterValue{{Kind: StringValue, Raw: val, Str: val}},
+	}}}
+}
+
+// ValidateFilter checks that a filter can be parsed without building a store query
+func ValidateFilter(filter map[string]interface{}) error {
+	_, err := ParseFilter(filter)
+	return err
+}
+
+func sortedFilterKeys(filter map[string]interface{}) []string {
+	keys := make([]string, 0, len(filter))
+	for k := range filter {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func parseFilterMap(prefix []string, filter map[string]interface{}) (exprs []FilterExpr, err error) {
+	for _, key := range sortedFilterKeys(filter) {
+		var expr FilterExpr
+		if expr, err = parseFilterEntry(prefix, key, filter[key]); err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	return
+}
+
+func parseFilterEntry(prefix []string, key string, val interface{}) (FilterExpr, error) {
+	if key == string(OrGroup) || key == string(AndGroup) {
+		return parseFilterGroup(prefix, GroupOperator(key), val)
+	}
+	path, err := parseFilterPath(prefix, key)
+	if err != nil {
+		return nil, err
+	}
+	if sub, ok := val.(map[string]interface{}); ok {
+		if len(sub) == 0 {
+			return nil, &FilterError{Key: key, Reason: "nested filter is empty"}
+		}
+		exprs, err := parseFilterMap(path, sub)
+		if err != nil {
+			return nil, err
+		}
+		return &FilterGroup{Op: AndGroup, Exprs: exprs}, nil
+	}
+	return parseFilterCondition(path, val)
+}
+
+func parseFilterGroup(prefix []string, op GroupOperator, val interface{}) (FilterExpr, error) {
+	group := &FilterGroup{Op: op}
+	switch v := val.(type) {
+	case map[string]interface{}:
+		//each entry of the map is a member of the group
+		exprs, err := parseFilterMap(prefix, v)
+		if err != nil {
+			return nil, err
+		}
+		group.Exprs = exprs
+	case []interface{}:
+		//each map in the list is an and group member of the group
+		for i, element := range v {
+			sub, ok := element.(map[string]interface{})
+			if !ok {
+				return nil, &FilterError{Key: string(op), Value: element, Reason: fmt.Sprintf("element %d is not a filter map", i)}
+			}
+			exprs, err := parseFilterMap(prefix, sub)
+			if err != nil {
+				return nil, err
+			}
+			group.Exprs = append(group.Exprs, &FilterGroup{Op: AndGroup, Exprs: exprs})
+		}
+	case []map[string]interface{}:
+		elements := make([]interface{}, len(v))
+		for i, element := range v {
+			elements[i] = element
+		}
+		return parseFilterGroup(prefix, op, elements)
+	default:
+		return nil, &FilterError{Key: string(op), Value: val, Reason: "expected a filter map or a list of filter maps"}
+	}
+	if len(group.Exprs) == 0 {
+		return nil, &FilterError{Key: string(op), Reason: "group is empty"}
+	}
+	return group, nil
+}
+
+func parseFilterPath(prefix []string, key string) ([]string, error) {
+	trimmed := strings.Trim(key, ".")
+	if trimmed == "" {
+		return nil, &FilterError{Key: key, Reason: "field name is empty"}
+	}
+	parts := strings.Split(trimmed, ".")
+	for _, p := range parts {
+		if p == "" {
+			return nil, &FilterError{Key: key, Reason: "field path contains an empty segment"}
+		}
+	}
+	path := make([]string, 0, len(prefix)+len(parts))
+	path = append(path, prefix...)
+	return append(path, parts...), nil
+}
+
+func parseFilterCondition(path []string, val interface{}) (*FilterCondition, error) {
+	key := strings.Join(path, ".")
+	switch v := val.(type) {
+	case string:
+		return parseFilterString(path, v)
+	case nil:
+		return &FilterCondition{Path: path, Op: OpEq, Values: []FilterValue{{Kind: NullValue, Raw: "null"}}}, nil
+	case bool:
+		return &FilterCondition{Path: path, Op: OpEq, Values: []FilterValue{{Kind: BoolValue, Raw: strconv.FormatBool(v), Bool: v}}}, nil
+	case time.Time:
+		return &FilterCondition{Path: path, Op: OpEq, Values: []FilterValue{{Kind: TimeValue, Raw: v.Format(time.RFC3339), Time: v}}}, nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return nil, &FilterError{Key: key, Value: val, Reason: err.Error()}
+		}
+		return &FilterCondition{Path: path, Op: OpEq, Values: []FilterValue{numberFilterValue(v.String(), f)}}, nil
+	}
+	if f, ok := toFloat(val); ok {
+		return &FilterCondition{Path: path, Op: OpEq, Values: []FilterValue{numberFilterValue(fmt.Sprint(val), f)}}, nil
+	}
+	return nil, &FilterError{Key: key, Value: val, Reason: fmt.Sprintf("unsupported value type %T", val)}
+}
+
+func parseFilterString(path []string, val string) (*FilterCondition, error) {
+	key := strings.Join(path, ".")
+	if val == "" {
+		return &FilterCondition{Path: path, Op: OpExists}, nil
+	}
+	op := OpEq
+	operand := val
+	switch first := FilterOperator(val[:1]); first {
+	case OpEq, OpMatch, OpGt, OpLt:
+		op = first
+		operand = val[1:]
+		if operand == "" {
+			return nil, &FilterError{Key: key, Value: val, Reason: fmt.Sprintf("operator %s has no operand", op)}
+		}
+	}
+	cond := &FilterCondition{Path: path, Op: op}
+	switch {
+	case operand == val:
+		//a value without an operator is a single literal
+		cond.Values = []FilterValue{{Kind: StringValue, Raw: val, Str: val}}
+	case op == OpEq && strings.HasSuffix(operand, "|dt"), op == OpGt, op == OpLt:
+		v, err := parseFilterOperand(operand)
+		if err != nil {
+			return nil, &FilterError{Key: key, Value: val, Reason: err.Error()}
+		}
+		cond.Values = []FilterValue{v}
+	default:
+		for _, alt := range strings.Split(operand, "|") {
+			if alt == "" {
+				return nil, &FilterError{Key: key, Value: val, Reason: "empty alternative"}
+			}
+			v := FilterValue{Kind: StringValue, Raw: alt, Str: alt}
+			if op == OpMatch {
+				re, err := regexp.Compile(alt)
+				if err != nil {
+					return nil, &FilterError{Key: key, Value: val, Reason: err.Error()}
+				}
+				v.re = re
+			}
+			cond.Values = append(cond.Values, v)
+		}
+	}
+	return cond, nil
+}
+
+// parseFilterOperand parses the operand of a comparison or of an equality with a date, a trailing
+// |dt marks a date
+func parseFilterOperand(operand string) (FilterValue, error) {
+	vals := strings.Split(operand, "|")
+	switch len(vals) {
+	case 1:
+		if f, err := strconv.ParseFloat(operand, 64); err == nil {
+			return numberFilterValue(operand, f), nil
+		}
+		return FilterValue{Kind: StringValue, Raw: operand, Str: operand}, nil
+	case 2:
+		if vals[1] != "dt" {
+			return FilterValue{}, fmt.Errorf("unknown operand type %q", vals[1])
+		}
+		t, err := parseFilterTime(vals[0])
+		if err != nil {
+			return FilterValue{}, err
+		}
+		return FilterValue{Kind: TimeValue, Raw: vals[0], Time: t}, nil
+	}
+	return FilterValue{}, fmt.Errorf("comparison accepts a single operand")
+}
+
+// parseFilterTime accepts unix seconds, RFC3339 and anything jinzhu/now can parse
+func parseFilterTime(val string) (time.Time, error) {
+	if it, err := ToInt(val); err == nil {
+		return time.Unix(it, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, nil
+	}
+	if t, err := now.Parse(val); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a date", val)
+}
+
+func numberFilterValue(raw string, f float64) FilterValue {
+	return FilterValue{Kind: NumberValue, Raw: raw, Number: f}
+}
+
+func toFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,176 @@
+package gostore
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Match reports whether all (and) or any (or) of the group members match doc
+func (g *FilterGroup) Match(doc map[string]interface{}) bool {
+	if g.Op == OrGroup {
+		for _, e := range g.Exprs {
+			if e.Match(doc) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, e := range g.Exprs {
+		if !e.Match(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match reports whether the field at the condition path satisfies any of its operands.
+// A missing field never matches, like a rethinkdb filter on a missing field
+func (c *FilterCondition) Match(doc map[string]interface{}) bool {
+	val, ok := lookupField(doc, c.Path)
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case OpExists:
+		if b, ok := val.(bool); ok {
+			return b
+		}
+		return val != nil
+	case OpEq:
+		for _, v := range c.Values {
+			if equalFilterValue(val, v) {
+				return true
+			}
+		}
+	case OpMatch:
+		s, ok := val.(string)
+		if !ok {
+			return false
+		}
+		for _, v := range c.Values {
+			if v.re != nil && v.re.MatchString(s) {
+				return true
+			}
+		}
+	case OpGt:
+		cmp, ok := compareFilterValue(val, c.Values[0])
+		return ok && cmp > 0
+	case OpLt:
+		cmp, ok := compareFilterValue(val, c.Values[0])
+		return ok && cmp < 0
+	}
+	return false
+}
+
+// lookupField walks a dotted field path through nested documents
+func lookupField(doc map[string]interface{}, path []string) (val interface{}, ok bool) {
+	val = doc
+	for _, p := range path {
+		m, isMap := val.(map[string]interface{})
+		if !isMap {
+			return nil, false
+		}
+		if val, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return val, true
+}
+
+func equalFilterValue(val interface{}, v FilterValue) bool {
+	switch v.Kind {
+	case StringValue:
+		s, ok := val.(string)
+		return ok && s == v.Str
+	case NumberValue:
+		f, ok := toFloat(val)
+		return ok && f == v.Number
+	case BoolValue:
+		b, ok := val.(bool)
+		return ok && b == v.Bool
+	case NullValue:
+		return val == nil
+	case TimeValue:
+		t, ok := toTime(val)
+		return ok && t.Equal(v.Time)
+	}
+	return false
+}
+
+// compareFilterValue orders a document value against an operand. Numbers compare numerically,
+// dates compare chronologically and everything else compares as strings
+func compareFilterValue(val interface{}, v FilterValue) (int, bool) {
+	switch v.Kind {
+	case NumberValue:
+		if f, ok := toFloat(val); ok {
+			return compareFloat(f, v.Number), true
+		}
+		if s, ok := val.(string); ok {
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return compareFloat(f, v.Number), true
+			}
+			return strings.Compare(s, v.Raw), true
+		}
+	case TimeValue:
+		if t, ok := toTime(val); ok {
+			switch {
+			case t.Before(v.Time):
+				return -1, true
+			case t.After(v.Time):
+				return 1, true
+			}
+			return 0, true
+		}
+	case StringValue:
+		if s, ok := val.(string); ok {
+			return strings.Compare(s, v.Str), true
+		}
+	}
+	return 0, false
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// toTime reads a document value as a date. Encoded documents store dates as RFC3339 strings,
+// numbers are treated as unix seconds
+func toTime(val interface{}) (time.Time, bool) {
+	switch t := val.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			return parsed, true
+		}
+		return time.Time{}, false
+	}
+	if f, ok := toFloat(val); ok {
+		return time.Unix(int64(f), 0), true
+	}
+	return time.Time{}, false
+}
+
+// mergeDocs deep merges src into dst the way a rethinkdb update merges nested objects
+func mergeDocs(dst, src map[string]interface{}) map[string]interface{} {
+	if dst == nil {
+		dst = make(map[string]interface{}, len(src))
+	}
+	for k, v := range src {
+		if sub, ok := v.(map[string]interface{}); ok {
+			if existing, ok := dst[k].(map[string]interface{}); ok {
+				dst[k] = mergeDocs(existing, sub)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+	return dst
+}
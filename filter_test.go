@@ -0,0 +1,117 @@
+package gostore
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseFilter(t *testing.T) {
+	Convey("Given a filter", t, func() {
+		filter := map[string]interface{}{
+			"kind":   "=thing|fish",
+			"name":   "~^first",
+			"rating": ">4.5",
+			"tags":   "",
+			"active": true,
+		}
+		Convey("Parsing it gives an and group of typed conditions ordered by field", func() {
+			expr, err := ParseFilter(filter)
+			So(err, ShouldBeNil)
+			So(expr.Op, ShouldEqual, AndGroup)
+			So(expr.String(), ShouldEqual, `(active = true and kind = "thing" | "fish" and name ~ "^first" and rating > 4.5 and tags)`)
+
+			rating := expr.Exprs[3].(*FilterCondition)
+			So(rating.Values[0].Kind, ShouldEqual, NumberValue)
+			So(rating.Values[0].Number, ShouldEqual, 4.5)
+			So(expr.Exprs[4].(*FilterCondition).Op, ShouldEqual, OpExists)
+		})
+	})
+}
+
+func TestParseFilterDates(t *testing.T) {
+	Convey("Given a date comparison", t, func() {
+		filter := map[string]interface{}{"created": "<2017-01-02T15:04:05Z|dt", "updated": ">1483369445|dt"}
+		Convey("The operands are parsed as times", func() {
+			expr, err := ParseFilter(filter)
+			So(err, ShouldBeNil)
+			created := expr.Exprs[0].(*FilterCondition)
+			So(created.Values[0].Kind, ShouldEqual, TimeValue)
+			So(created.Values[0].Time.Equal(time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)), ShouldBeTrue)
+			updated := expr.Exprs[1].(*FilterCondition)
+			So(updated.Values[0].Time.Unix(), ShouldEqual, 1483369445)
+		})
+		Convey("An equality with a date is a single time", func() {
+			expr, err := ParseFilter(map[string]interface{}{"created": "=2017-01-02T15:04:05Z|dt"})
+			So(err, ShouldBeNil)
+			created := expr.Exprs[0].(*FilterCondition)
+			So(created.Op, ShouldEqual, OpEq)
+			So(created.Values, ShouldHaveLength, 1)
+			So(created.Values[0].Kind, ShouldEqual, TimeValue)
+			So(created.Match(map[string]interface{}{"created": "2017-01-02T15:04:05Z"}), ShouldBeTrue)
+		})
+	})
+}
+
+func TestParseFilterLiterals(t *testing.T) {
+	Convey("Given values without an operator", t, func() {
+		Convey("A bar is part of the literal", func() {
+			for _, val := range []string{"egg|fish", "egg|", "|dt"} {
+				expr, err := ParseFilter(map[string]interface{}{"food": val})
+				So(err, ShouldBeNil)
+				food := expr.Exprs[0].(*FilterCondition)
+				So(food.Op, ShouldEqual, OpEq)
+				So(food.Values, ShouldResemble, []FilterValue{{Kind: StringValue, Raw: val, Str: val}})
+			}
+		})
+	})
+}
+
+func TestParseFilterNested(t *testing.T) {
+	Convey("Given nested fields and or groups", t, func() {
+		filter := map[string]interface{}{
+			"food.type": "egg",
+			"place":     map[string]interface{}{"city": "lagos"},
+			"or": []interface{}{
+				map[string]interface{}{"food": "~amala|ewedu", "place": "lagos"},
+				map[string]interface{}{"beverage": "coke"},
+			},
+		}
+		Convey("Paths are split and groups keep their members", func() {
+			expr, err := ParseFilter(filter)
+			So(err, ShouldBeNil)
+			So(expr.String(), ShouldEqual, `(food.type = "egg" and ((food ~ "amala" | "ewedu" and place = "lagos") or (beverage = "coke")) and (place.city = "lagos"))`)
+			So(expr.Exprs[0].(*FilterCondition).Path, ShouldResemble, []string{"food", "type"})
+		})
+		Convey("An or map makes each entry an alternative", func() {
+			expr, err := ParseFilter(map[string]interface{}{"or": map[string]interface{}{"a": "1", "b": "2"}})
+			So(err, ShouldBeNil)
+			So(expr.String(), ShouldEqual, `((a = "1" or b = "2"))`)
+		})
+	})
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	Convey("Given invalid filters", t, func() {
+		invalid := []map[string]interface{}{
+			{"name": "~[a-"},
+			{"name": ">"},
+			{"name": "=a||b"},
+			{"created": ">yesterday-ish|dt"},
+			{"created": ">5|int"},
+			{"a..b": "c"},
+			{"or": "a"},
+			{"or": []interface{}{}},
+			{"or": []interface{}{"a"}},
+			{"name": []string{"a"}},
+		}
+		Convey("Each one fails with a FilterError", func() {
+			for _, filter := range invalid {
+				err := ValidateFilter(filter)
+				So(err, ShouldNotBeNil)
+				So(err, ShouldHaveSameTypeAs, &FilterError{})
+			}
+		})
+	})
+}
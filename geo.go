@@ -0,0 +1,91 @@
+package gostore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// geoDistanceField holds the distance in meters of each row returned by GeoQuery
+const geoDistanceField = "_distance"
+
+// distanceUnits maps the units accepted by ParseDistance to meters
+var distanceUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"mi": 1609.344,
+	"ft": 0.3048,
+	"nm": 1852,
+}
+
+// ParseDistance converts a distance such as "5km", "300m" or "2mi" to meters. A number without
+// a unit is taken to be in meters
+func ParseDistance(distance string) (float64, error) {
+	d := strings.ToLower(strings.TrimSpace(distance))
+	i := strings.IndexFunc(d, func(c rune) bool {
+		return c != '.' && (c < '0' || c > '9')
+	})
+	num, unit := d, "m"
+	if i >= 0 {
+		num, unit = d[:i], strings.TrimSpace(d[i:])
+	}
+	factor, ok := distanceUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown distance unit in %q", distance)
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid distance %q", distance)
+	}
+	return f * factor, nil
+}
+
+// locationOf reads a longitude and latitude from a location value. It understands maps with
+// lat/lon (or lng, long, latitude, longitude) keys, geojson points and [lon, lat] pairs
+func locationOf(val interface{}) (lon, lat float64, ok bool) {
+	switch v := val.(type) {
+	case []interface{}:
+		if len(v) != 2 {
+			return
+		}
+		lon, ok1 := toFloat(v[0])
+		lat, ok2 := toFloat(v[1])
+		return lon, lat, ok1 && ok2 && validLocation(lon, lat)
+	case []float64:
+		if len(v) != 2 {
+			return
+		}
+		return v[0], v[1], validLocation(v[0], v[1])
+	case map[string]interface{}:
+		if coords, isPoint := v["coordinates"]; isPoint {
+			return locationOf(coords)
+		}
+		var okLon, okLat bool
+		for _, k := range []string{"lon", "lng", "long", "longitude"} {
+			if lon, okLon = toFloat(v[k]); okLon {
+				break
+			}
+		}
+		for _, k := range []string{"lat", "latitude"} {
+			if lat, okLat = toFloat(v[k]); okLat {
+				break
+			}
+		}
+		return lon, lat, okLon && okLat && validLocation(lon, lat)
+	}
+	return
+}
+
+func validLocation(lon, lat float64) bool {
+	return lon >= -180 && lon <= 180 && lat >= -90 && lat <= 90
+}
+
+// geoLocationField returns the location field configured in opts, "location" by default
+func geoLocationField(opts ObjectStoreOptions) string {
+	if opts != nil {
+		if geo := opts.GetGeoQuery(); geo != nil && geo.LocationField != "" {
+			return geo.LocationField
+		}
+	}
+	return "location"
+}
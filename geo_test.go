@@ -0,0 +1,73 @@
+package gostore
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseDistance(t *testing.T) {
+	Convey("Given distances with units", t, func() {
+		Convey("They are converted to meters", func() {
+			for distance, meters := range map[string]float64{"5km": 5000, "300m": 300, "300": 300, "1.5 KM": 1500, "2mi": 3218.688} {
+				m, err := ParseDistance(distance)
+				So(err, ShouldBeNil)
+				So(m, ShouldAlmostEqual, meters)
+			}
+		})
+		Convey("Unknown units and invalid numbers fail", func() {
+			for _, distance := range []string{"5 parsecs", "km", "1.2.3m", ""} {
+				_, err := ParseDistance(distance)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestLocationOf(t *testing.T) {
+	Convey("Given location values", t, func() {
+		Convey("Maps, geojson points and pairs give a longitude and latitude", func() {
+			for _, loc := range []interface{}{
+				map[string]interface{}{"lat": 6.5, "lon": 3.4},
+				map[string]interface{}{"latitude": 6.5, "lng": 3.4},
+				map[string]interface{}{"type": "Point", "coordinates": []interface{}{3.4, 6.5}},
+				[]interface{}{3.4, 6.5},
+			} {
+				lon, lat, ok := locationOf(loc)
+				So(ok, ShouldBeTrue)
+				So(lon, ShouldEqual, 3.4)
+				So(lat, ShouldEqual, 6.5)
+			}
+		})
+		Convey("Anything else is not a location", func() {
+			for _, loc := range []interface{}{"lagos", []interface{}{1.0}, map[string]interface{}{"lat": 100.0, "lon": 3.4}, nil} {
+				_, _, ok := locationOf(loc)
+				So(ok, ShouldBeFalse)
+			}
+		})
+	})
+}
+
+func TestGeohash(t *testing.T) {
+	Convey("Given a point", t, func() {
+		Convey("Its geohash is encoded with the requested precision", func() {
+			So(encodeGeohash(57.64911, 10.40744, 11), ShouldEqual, "u4pruydqqvj")
+			So(encodeGeohash(57.64911, 10.40744, 5), ShouldEqual, "u4pru")
+		})
+		Convey("The cells around it cover the search radius", func() {
+			cells := geohashCells(10.40744, 57.64911, 2000)
+			So(len(cells), ShouldEqual, 9)
+			So(cells, ShouldContain, "u4pru")
+			for _, cell := range cells {
+				So(len(cell), ShouldEqual, 5)
+			}
+		})
+		Convey("A radius larger than any cell scans everything", func() {
+			So(geohashCells(10.40744, 57.64911, 10000000), ShouldResemble, []string{""})
+		})
+		Convey("Distances are great circle distances in meters", func() {
+			So(haversine(3.3792, 6.5244, 3.3792, 6.5244), ShouldEqual, 0)
+			So(haversine(0, 0, 1, 0), ShouldAlmostEqual, 111195, 1)
+		})
+	})
+}
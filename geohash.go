@@ -0,0 +1,167 @@
+package gostore
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// geohashBase32 is the geohash alphabet
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geohashPrecision is the length of the geohash stored for each row
+const geohashPrecision = 12
+
+// metersPerDegree is the length of a degree of latitude, or of longitude at the equator
+const metersPerDegree = 111320.0
+
+// earthRadius is the mean radius of the earth in meters
+const earthRadius = 6371008.8
+
+// encodeGeohash returns the geohash of a point with the given number of characters
+func encodeGeohash(lat, lon float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	var hash strings.Builder
+	bit, ch, even := 0, 0, true
+	for hash.Len() < precision {
+		rng, val := &latRange, lat
+		if even {
+			rng, val = &lonRange, lon
+		}
+		mid := (rng[0] + rng[1]) / 2
+		ch <<= 1
+		if val >= mid {
+			ch |= 1
+			rng[0] = mid
+		} else {
+			rng[1] = mid
+		}
+		even = !even
+		if bit++; bit == 5 {
+			hash.WriteByte(geohashBase32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return hash.String()
+}
+
+// geohashCellSize returns the height and width in degrees of a geohash cell
+func geohashCellSize(precision int) (latDeg, lonDeg float64) {
+	bits := uint(5 * precision)
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / float64(uint64(1)<<latBits), 360 / float64(uint64(1)<<lonBits)
+}
+
+// geohashCells returns the geohash prefixes covering a circle. The circle lies within the cell of
+// its centre and the eight cells around it, so the precision is chosen to make cells at least as
+// large as the radius. An empty prefix means the circle is too large and every row must be checked
+func geohashCells(lon, lat, meters float64) []string {
+	precision := 0
+	for p := geohashPrecision; p > 0; p-- {
+		latDeg, lonDeg := geohashCellSize(p)
+		if latDeg*metersPerDegree >= meters && lonDeg*metersPerDegree*math.Cos(lat*math.Pi/180) >= meters {
+			precision = p
+			break
+		}
+	}
+	if precision == 0 {
+		return []string{""}
+	}
+	latDeg, lonDeg := geohashCellSize(precision)
+	seen := make(map[string]bool)
+	var cells []string
+	for _, dLat := range []float64{-latDeg, 0, latDeg} {
+		for _, dLon := range []float64{-lonDeg, 0, lonDeg} {
+			cLat := math.Max(-90, math.Min(90, lat+dLat))
+			cLon := lon + dLon
+			if cLon > 180 {
+				cLon -= 360
+			} else if cLon < -180 {
+				cLon += 360
+			}
+			cell := encodeGeohash(cLat, cLon, precision)
+			if !seen[cell] {
+				seen[cell] = true
+				cells = append(cells, cell)
+			}
+		}
+	}
+	sort.Strings(cells)
+	return cells
+}
+
+// haversine returns the great circle distance in meters between two points
+func haversine(lon1, lat1, lon2, lat2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// geohashQuery refines the candidates of a geohash lookup by their exact distance and a filter
+type geohashQuery struct {
+	lon, lat, meters float64
+	field            string
+	expr             FilterExpr
+	matches          []geohashMatch
+}
+
+type geohashMatch struct {
+	key      string
+	doc      map[string]interface{}
+	distance float64
+}
+
+func newGeohashQuery(lon, lat float64, distance string, query map[string]interface{}, opts ObjectStoreOptions) (*geohashQuery, error) {
+	meters, err := ParseDistance(distance)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := ParseFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	return &geohashQuery{lon: lon, lat: lat, meters: meters, field: geoLocationField(opts), expr: expr}, nil
+}
+
+// cells returns the geohash prefixes to scan
+func (q *geohashQuery) cells() []string {
+	return geohashCells(q.lon, q.lat, q.meters)
+}
+
+// add keeps a candidate row when it is within distance and matches the filter
+func (q *geohashQuery) add(key string, doc map[string]interface{}) {
+	lon, lat, ok := locationOf(doc[q.field])
+	if !ok {
+		return
+	}
+	d := haversine(q.lon, q.lat, lon, lat)
+	if d > q.meters || !q.expr.Match(doc) {
+		return
+	}
+	q.matches = append(q.matches, geohashMatch{key, doc, d})
+}
+
+// results returns the matching rows nearest first, each with its distance in meters in the
+// _distance field
+func (q *geohashQuery) results(count, skip int) []geohashMatch {
+	sort.SliceStable(q.matches, func(i, j int) bool {
+		return q.matches[i].distance < q.matches[j].distance
+	})
+	matches := q.matches
+	if skip >= len(matches) {
+		return nil
+	}
+	matches = matches[skip:]
+	if count > 0 && count < len(matches) {
+		matches = matches[:count]
+	}
+	for _, m := range matches {
+		m.doc[geoDistanceField] = m.distance
+	}
+	return matches
+}
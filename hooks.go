@@ -0,0 +1,570 @@
+package gostore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// HookPoint names the moment of a write at which hooks run
+type HookPoint int
+
+const (
+	BeforeSave HookPoint = iota
+	AfterSave
+	BeforeUpdate
+	AfterUpdate
+	BeforeReplace
+	AfterReplace
+	BeforeDelete
+	AfterDelete
+)
+
+var hookPointNames = []string{"BeforeSave", "AfterSave", "BeforeUpdate", "AfterUpdate", "BeforeReplace", "AfterReplace", "BeforeDelete", "AfterDelete"}
+
+func (p HookPoint) String() string {
+	if p < 0 || int(p) >= len(hookPointNames) {
+		return fmt.Sprintf("HookPoint(%d)", int(p))
+	}
+	return hookPointNames[p]
+}
+
+// HookEvent describes a write of one row, or of the rows matching a filter, to its hooks. The
+// before and after hooks of a write receive the same event
+type HookEvent struct {
+	Context context.Context
+	Point   HookPoint
+	Table   string
+	// Key of the row, empty for filter writes and before a Save without a key. After hooks of a
+	// save receive the saved key
+	Key string
+	// Filter selects the rows of FilterUpdate, FilterReplace, FilterDelete and BatchFilterDelete
+	Filter map[string]interface{}
+	// Doc is the document saved, updated or replaced, nil for deletes. Before hooks may modify it
+	// in place or replace it
+	Doc interface{}
+}
+
+// Hook runs at a HookPoint of a write. An error returned by a before hook vetoes the write, one
+// returned by an after hook is returned by the call which made the write
+type Hook func(e *HookEvent) error
+
+// HookedStore runs hooks registered per table around the writes made through it. Batch calls run
+// the before hooks of every row before writing any of them, so a veto leaves the table untouched,
+// and run the after hooks once the batch succeeded. Hooks run in the order they were registered and
+// the first error stops them. Writes made inside transactions or directly on the wrapped store do
+// not run hooks
+type HookedStore struct {
+	store ContextObjectStore
+	inner ObjectStore
+	hooks *hookRegistry
+}
+
+// hookRegistry holds the hooks shared by the copies of a HookedStore
+type hookRegistry struct {
+	sync.RWMutex
+	hooks map[HookPoint][]tableHook
+}
+
+type tableHook struct {
+	table string
+	hook  Hook
+}
+
+// NewHookedStore wraps a store with an empty set of hooks
+func NewHookedStore(store ObjectStore) HookedStore {
+	return HookedStore{
+		store: NewContextAdapter(store),
+		inner: store,
+		hooks: &hookRegistry{hooks: make(map[HookPoint][]tableHook)},
+	}
+}
+
+// On registers hooks to run at point for writes to table, an empty table matches every table.
+// It returns the store so registrations can be chained
+func (s HookedStore) On(point HookPoint, table string, hooks ...Hook) HookedStore {
+	s.hooks.Lock()
+	defer s.hooks.Unlock()
+	for _, hook := range hooks {
+		s.hooks.hooks[point] = append(s.hooks.hooks[point], tableHook{table, hook})
+	}
+	return s
+}
+
+// matching returns the hooks registered at point for table
+func (r *hookRegistry) matching(point HookPoint, table string) (hooks []Hook) {
+	r.RLock()
+	defer r.RUnlock()
+	for _, h := range r.hooks[point] {
+		if h.table == "" || h.table == table {
+			hooks = append(hooks, h.hook)
+		}
+	}
+	return
+}
+
+// fire runs the hooks of point for each event
+func (s HookedStore) fire(point HookPoint, events []*HookEvent) error {
+	for _, e := range events {
+		e.Point = point
+		for _, hook := range s.hooks.matching(point, e.Table) {
+			if err := hook(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// write runs the before hooks of events, the write and then the after hooks
+func (s HookedStore) write(before, after HookPoint, events []*HookEvent, fn func() error) error {
+	if err := s.fire(before, events); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return s.fire(after, events)
+}
+
+// writeResult runs the before hooks of events, a write which reports its result and then the after
+// hooks of the rows it did not fail on
+func (s HookedStore) writeResult(before, after HookPoint, events []*HookEvent, fn func(w WriteResultStore) (WriteResult, error)) (WriteResult, error) {
+	w, err := writeResultStore(s.inner)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	if err := s.fire(before, events); err != nil {
+		return WriteResult{}, err
+	}
+	result, err := fn(w)
+	if err != nil {
+		return result, err
+	}
+	failed := make(map[string]bool, len(result.Failed))
+	for _, f := range result.Failed {
+		failed[f.Key] = true
+	}
+	written := events[:0:0]
+	for _, e := range events {
+		if e.Key == "" || !failed[e.Key] {
+			written = append(written, e)
+		}
+	}
+	return result, s.fire(after, written)
+}
+
+func keyEvents(ctx context.Context, table string, keys []interface{}, docs []interface{}) []*HookEvent {
+	n := len(keys)
+	if len(docs) > n {
+		n = len(docs)
+	}
+	events := make([]*HookEvent, n)
+	for i := range events {
+		events[i] = &HookEvent{Context: ctx, Table: table}
+		if i < len(keys) {
+			events[i].Key = fmt.Sprint(keys[i])
+		}
+		if i < len(docs) {
+			events[i].Doc = docs[i]
+		}
+	}
+	return events
+}
+
+func filterEvent(ctx context.Context, table string, filter map[string]interface{}, doc interface{}) []*HookEvent {
+	return []*HookEvent{{Context: ctx, Table: table, Filter: filter, Doc: doc}}
+}
+
+// eventDocs returns the documents of events after their before hooks
+func eventDocs(events []*HookEvent) []interface{} {
+	docs := make([]interface{}, len(events))
+	for i, e := range events {
+		docs[i] = e.Doc
+	}
+	return docs
+}
+
+// setEventKeys records the keys generated by a save
+func setEventKeys(events []*HookEvent, keys []string) {
+	for i, key := range keys {
+		if i < len(events) {
+			events[i].Key = key
+		}
+	}
+}
+
+// Store returns the wrapped store
+func (s HookedStore) Store() ObjectStore {
+	return s.inner
+}
+
+// Capabilities describes the wrapped store, HookedStore exposes the ObjectStore and
+// ContextObjectStore apis and the write results of the wrapped store
+func (s HookedStore) Capabilities() Capabilities {
+	c := decoratedCapabilities(s.inner)
+	c.Context = true
+	return c
+}
+
+func (s HookedStore) GetStore() interface{} {
+	return s.store.GetStore()
+}
+
+func (s HookedStore) Close() {
+	s.store.Close()
+}
+
+func (s HookedStore) CreateDatabaseContext(ctx context.Context) error {
+	return s.store.CreateDatabaseContext(ctx)
+}
+
+func (s HookedStore) CreateTableContext(ctx context.Context, table string, sample interface{}) error {
+	return s.store.CreateTableContext(ctx, table, sample)
+}
+
+func (s HookedStore) StatsContext(ctx context.Context, store string) (map[string]interface{}, error) {
+	return s.store.StatsContext(ctx, store)
+}
+
+func (s HookedStore) AllContext(ctx context.Context, count int, skip int, store string) (ObjectRows, error) {
+	return s.store.AllContext(ctx, count, skip, store)
+}
+
+func (s HookedStore) AllCursorContext(ctx context.Context, store string) (ObjectRows, error) {
+	return s.store.AllCursorContext(ctx, store)
+}
+
+func (s HookedStore) AllWithinRangeContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.store.AllWithinRangeContext(ctx, filter, count, skip, store, opts)
+}
+
+func (s HookedStore) SinceContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.store.SinceContext(ctx, id, count, skip, store)
+}
+
+func (s HookedStore) BeforeContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.store.BeforeContext(ctx, id, count, skip, store)
+}
+
+func (s HookedStore) FilterSinceContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.store.FilterSinceContext(ctx, id, filter, count, skip, store, opts)
+}
+
+func (s HookedStore) FilterBeforeContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.store.FilterBeforeContext(ctx, id, filter, count, skip, store, opts)
+}
+
+func (s HookedStore) FilterBeforeCountContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.store.FilterBeforeCountContext(ctx, id, filter, count, skip, store, opts)
+}
+
+func (s HookedStore) GetContext(ctx context.Context, key string, store string, dst interface{}) error {
+	return s.store.GetContext(ctx, key, store, dst)
+}
+
+func (s HookedStore) SaveContext(ctx context.Context, key, store string, src interface{}) (string, error) {
+	events := keyEvents(ctx, store, []interface{}{key}, []interface{}{src})
+	var saved string
+	err := s.write(BeforeSave, AfterSave, events, func() (err error) {
+		saved, err = s.store.SaveContext(ctx, key, store, events[0].Doc)
+		events[0].Key = saved
+		return
+	})
+	return saved, err
+}
+
+func (s HookedStore) SaveAllContext(ctx context.Context, store string, src ...interface{}) ([]string, error) {
+	events := keyEvents(ctx, store, nil, src)
+	var keys []string
+	err := s.write(BeforeSave, AfterSave, events, func() (err error) {
+		keys, err = s.store.SaveAllContext(ctx, store, eventDocs(events)...)
+		setEventKeys(events, keys)
+		return
+	})
+	return keys, err
+}
+
+func (s HookedStore) UpdateContext(ctx context.Context, key string, store string, src interface{}) error {
+	events := keyEvents(ctx, store, []interface{}{key}, []interface{}{src})
+	return s.write(BeforeUpdate, AfterUpdate, events, func() error {
+		return s.store.UpdateContext(ctx, key, store, events[0].Doc)
+	})
+}
+
+func (s HookedStore) ReplaceContext(ctx context.Context, key string, store string, src interface{}) error {
+	events := keyEvents(ctx, store, []interface{}{key}, []interface{}{src})
+	return s.write(BeforeReplace, AfterReplace, events, func() error {
+		return s.store.ReplaceContext(ctx, key, store, events[0].Doc)
+	})
+}
+
+func (s HookedStore) DeleteContext(ctx context.Context, key string, store string) error {
+	events := keyEvents(ctx, store, []interface{}{key}, nil)
+	return s.write(BeforeDelete, AfterDelete, events, func() error {
+		return s.store.DeleteContext(ctx, key, store)
+	})
+}
+
+func (s HookedStore) FilterUpdateContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	events := filterEvent(ctx, store, filter, src)
+	return s.write(BeforeUpdate, AfterUpdate, events, func() error {
+		return s.store.FilterUpdateContext(ctx, filter, events[0].Doc, store, opts)
+	})
+}
+
+func (s HookedStore) FilterReplaceContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	events := filterEvent(ctx, store, filter, src)
+	return s.write(BeforeReplace, AfterReplace, events, func() error {
+		return s.store.FilterReplaceContext(ctx, filter, events[0].Doc, store, opts)
+	})
+}
+
+func (s HookedStore) FilterGetContext(ctx context.Context, filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	return s.store.FilterGetContext(ctx, filter, store, dst, opts)
+}
+
+func (s HookedStore) FilterGetAllContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.store.FilterGetAllContext(ctx, filter, count, skip, store, opts)
+}
+
+func (s HookedStore) QueryContext(ctx context.Context, filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error) {
+	return s.store.QueryContext(ctx, filter, aggregates, count, skip, store, opts)
+}
+
+func (s HookedStore) FilterDeleteContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	events := filterEvent(ctx, store, filter, nil)
+	return s.write(BeforeDelete, AfterDelete, events, func() error {
+		return s.store.FilterDeleteContext(ctx, filter, store, opts)
+	})
+}
+
+func (s HookedStore) FilterCountContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.store.FilterCountContext(ctx, filter, store, opts)
+}
+
+func (s HookedStore) GetByFieldContext(ctx context.Context, name, val, store string, dst interface{}) error {
+	return s.store.GetByFieldContext(ctx, name, val, store, dst)
+}
+
+func (s HookedStore) GetByFieldsByFieldContext(ctx context.Context, name, val, store string, fields []string, dst interface{}) error {
+	return s.store.GetByFieldsByFieldContext(ctx, name, val, store, fields, dst)
+}
+
+func (s HookedStore) BatchDeleteContext(ctx context.Context, ids []interface{}, store string, opts ObjectStoreOptions) error {
+	events := keyEvents(ctx, store, ids, nil)
+	return s.write(BeforeDelete, AfterDelete, events, func() error {
+		return s.store.BatchDeleteContext(ctx, ids, store, opts)
+	})
+}
+
+func (s HookedStore) BatchUpdateContext(ctx context.Context, ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	if len(ids) != len(data) {
+		// leave the store to report the mismatch
+		return s.store.BatchUpdateContext(ctx, ids, data, store, opts)
+	}
+	events := keyEvents(ctx, store, ids, data)
+	return s.write(BeforeUpdate, AfterUpdate, events, func() error {
+		return s.store.BatchUpdateContext(ctx, ids, eventDocs(events), store, opts)
+	})
+}
+
+func (s HookedStore) BatchFilterDeleteContext(ctx context.Context, filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	events := make([]*HookEvent, len(filter))
+	for i, f := range filter {
+		events[i] = &HookEvent{Context: ctx, Table: store, Filter: f}
+	}
+	return s.write(BeforeDelete, AfterDelete, events, func() error {
+		return s.store.BatchFilterDeleteContext(ctx, filter, store, opts)
+	})
+}
+
+func (s HookedStore) BatchInsertContext(ctx context.Context, data []interface{}, store string, opts ObjectStoreOptions) ([]string, error) {
+	events := keyEvents(ctx, store, nil, data)
+	var keys []string
+	err := s.write(BeforeSave, AfterSave, events, func() (err error) {
+		keys, err = s.store.BatchInsertContext(ctx, eventDocs(events), store, opts)
+		setEventKeys(events, keys)
+		return
+	})
+	return keys, err
+}
+
+// The ObjectStore api runs hooks with a background context
+
+func (s HookedStore) CreateDatabase() error {
+	return s.CreateDatabaseContext(context.Background())
+}
+
+func (s HookedStore) CreateTable(table string, sample interface{}) error {
+	return s.CreateTableContext(context.Background(), table, sample)
+}
+
+func (s HookedStore) Stats(store string) (map[string]interface{}, error) {
+	return s.StatsContext(context.Background(), store)
+}
+
+func (s HookedStore) All(count int, skip int, store string) (ObjectRows, error) {
+	return s.AllContext(context.Background(), count, skip, store)
+}
+
+func (s HookedStore) AllCursor(store string) (ObjectRows, error) {
+	return s.AllCursorContext(context.Background(), store)
+}
+
+func (s HookedStore) AllWithinRange(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.AllWithinRangeContext(context.Background(), filter, count, skip, store, opts)
+}
+
+func (s HookedStore) Since(id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.SinceContext(context.Background(), id, count, skip, store)
+}
+
+func (s HookedStore) Before(id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.BeforeContext(context.Background(), id, count, skip, store)
+}
+
+func (s HookedStore) FilterSince(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.FilterSinceContext(context.Background(), id, filter, count, skip, store, opts)
+}
+
+func (s HookedStore) FilterBefore(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.FilterBeforeContext(context.Background(), id, filter, count, skip, store, opts)
+}
+
+func (s HookedStore) FilterBeforeCount(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.FilterBeforeCountContext(context.Background(), id, filter, count, skip, store, opts)
+}
+
+func (s HookedStore) Get(key string, store string, dst interface{}) error {
+	return s.GetContext(context.Background(), key, store, dst)
+}
+
+func (s HookedStore) Save(key, store string, src interface{}) (string, error) {
+	return s.SaveContext(context.Background(), key, store, src)
+}
+
+func (s HookedStore) SaveAll(store string, src ...interface{}) ([]string, error) {
+	return s.SaveAllContext(context.Background(), store, src...)
+}
+
+func (s HookedStore) Update(key string, store string, src interface{}) error {
+	return s.UpdateContext(context.Background(), key, store, src)
+}
+
+func (s HookedStore) Replace(key string, store string, src interface{}) error {
+	return s.ReplaceContext(context.Background(), key, store, src)
+}
+
+func (s HookedStore) Delete(key string, store string) error {
+	return s.DeleteContext(context.Background(), key, store)
+}
+
+func (s HookedStore) FilterUpdate(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.FilterUpdateContext(context.Background(), filter, src, store, opts)
+}
+
+func (s HookedStore) FilterReplace(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.FilterReplaceContext(context.Background(), filter, src, store, opts)
+}
+
+func (s HookedStore) FilterGet(filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	return s.FilterGetContext(context.Background(), filter, store, dst, opts)
+}
+
+func (s HookedStore) FilterGetAll(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.FilterGetAllContext(context.Background(), filter, count, skip, store, opts)
+}
+
+func (s HookedStore) Query(filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error) {
+	return s.QueryContext(context.Background(), filter, aggregates, count, skip, store, opts)
+}
+
+func (s HookedStore) FilterDelete(filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.FilterDeleteContext(context.Background(), filter, store, opts)
+}
+
+func (s HookedStore) FilterCount(filter map[string]interface{}, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.FilterCountContext(context.Background(), filter, store, opts)
+}
+
+func (s HookedStore) GetByField(name, val, store string, dst interface{}) error {
+	return s.GetByFieldContext(context.Background(), name, val, store, dst)
+}
+
+func (s HookedStore) GetByFieldsByField(name, val, store string, fields []string, dst interface{}) error {
+	return s.GetByFieldsByFieldContext(context.Background(), name, val, store, fields, dst)
+}
+
+func (s HookedStore) BatchDelete(ids []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.BatchDeleteContext(context.Background(), ids, store, opts)
+}
+
+func (s HookedStore) BatchUpdate(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.BatchUpdateContext(context.Background(), ids, data, store, opts)
+}
+
+func (s HookedStore) BatchFilterDelete(filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.BatchFilterDeleteContext(context.Background(), filter, store, opts)
+}
+
+func (s HookedStore) BatchInsert(data []interface{}, store string, opts ObjectStoreOptions) ([]string, error) {
+	return s.BatchInsertContext(context.Background(), data, store, opts)
+}
+
+// The write results of the wrapped store run the hooks of the writes above with a background
+// context. A dry run runs the before hooks only, nothing is written
+
+func (s HookedStore) BatchDeleteResult(ids []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	events := keyEvents(context.Background(), store, ids, nil)
+	return s.writeResult(BeforeDelete, AfterDelete, events, func(w WriteResultStore) (WriteResult, error) {
+		return w.BatchDeleteResult(ids, store, opts)
+	})
+}
+
+func (s HookedStore) BatchUpdateResult(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	if len(ids) != len(data) {
+		// leave the store to report the mismatch
+		return s.writeResult(BeforeUpdate, AfterUpdate, nil, func(w WriteResultStore) (WriteResult, error) {
+			return w.BatchUpdateResult(ids, data, store, opts)
+		})
+	}
+	events := keyEvents(context.Background(), store, ids, data)
+	return s.writeResult(BeforeUpdate, AfterUpdate, events, func(w WriteResultStore) (WriteResult, error) {
+		return w.BatchUpdateResult(ids, eventDocs(events), store, opts)
+	})
+}
+
+func (s HookedStore) BatchFilterDeleteResult(filter []map[string]interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	events := make([]*HookEvent, len(filter))
+	for i, f := range filter {
+		events[i] = &HookEvent{Context: context.Background(), Table: store, Filter: f}
+	}
+	return s.writeResult(BeforeDelete, AfterDelete, events, func(w WriteResultStore) (WriteResult, error) {
+		return w.BatchFilterDeleteResult(filter, store, opts)
+	})
+}
+
+func (s HookedStore) FilterDeleteResult(filter map[string]interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	events := filterEvent(context.Background(), store, filter, nil)
+	return s.writeResult(BeforeDelete, AfterDelete, events, func(w WriteResultStore) (WriteResult, error) {
+		return w.FilterDeleteResult(filter, store, opts)
+	})
+}
+
+func (s HookedStore) FilterUpdateResult(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions, wopts WriteOptions) (WriteResult, error) {
+	events := filterEvent(context.Background(), store, filter, src)
+	if wopts.DryRun {
+		w, err := writeResultStore(s.inner)
+		if err != nil {
+			return WriteResult{}, err
+		}
+		if err = s.fire(BeforeUpdate, events); err != nil {
+			return WriteResult{}, err
+		}
+		return w.FilterUpdateResult(filter, events[0].Doc, store, opts, wopts)
+	}
+	return s.writeResult(BeforeUpdate, AfterUpdate, events, func(w WriteResultStore) (WriteResult, error) {
+		return w.FilterUpdateResult(filter, events[0].Doc, store, opts, wopts)
+	})
+}
@@ -0,0 +1,105 @@
+package gostore
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHookedStore(t *testing.T) {
+	Convey("Giving a hooked memory store", t, func() {
+		mem := NewMemoryStore()
+		var audit []string
+		stamp := func(e *HookEvent) error {
+			if doc, ok := e.Doc.(map[string]interface{}); ok {
+				doc["stamped"] = true
+			}
+			return nil
+		}
+		record := func(e *HookEvent) error {
+			audit = append(audit, e.Point.String()+" "+e.Table+" "+e.Key)
+			return nil
+		}
+		store := NewHookedStore(mem).
+			On(BeforeSave, "", stamp).
+			On(BeforeUpdate, collection, stamp).
+			On(AfterSave, collection, record).
+			On(AfterUpdate, collection, record).
+			On(AfterDelete, collection, record)
+		var row map[string]interface{}
+		Convey("Before hooks modify the saved document", func() {
+			key, err := store.Save("", collection, map[string]interface{}{"kind": "thing"})
+			So(err, ShouldBeNil)
+			So(mem.Get(key, collection, &row), ShouldBeNil)
+			So(row["stamped"], ShouldEqual, true)
+			So(audit, ShouldResemble, []string{"AfterSave " + collection + " " + key})
+		})
+		Convey("Hooks only run for their table", func() {
+			_, err := store.Save("1", "other", map[string]interface{}{"kind": "thing"})
+			So(err, ShouldBeNil)
+			So(mem.Get("1", "other", &row), ShouldBeNil)
+			So(row["stamped"], ShouldEqual, true)
+			So(audit, ShouldBeEmpty)
+		})
+		Convey("Batch calls run the hooks of every row", func() {
+			keys, err := store.SaveAll(collection, map[string]interface{}{"id": "1"}, map[string]interface{}{"id": "2"})
+			So(err, ShouldBeNil)
+			So(keys, ShouldResemble, []string{"1", "2"})
+			So(store.BatchUpdate([]interface{}{"1", "2"}, []interface{}{map[string]interface{}{"kind": "a"}, map[string]interface{}{"kind": "b"}}, collection, nil), ShouldBeNil)
+			So(store.BatchDelete([]interface{}{"1"}, collection, nil), ShouldBeNil)
+			So(mem.Get("2", collection, &row), ShouldBeNil)
+			So(row["stamped"], ShouldEqual, true)
+			So(row["kind"], ShouldEqual, "b")
+			So(audit, ShouldResemble, []string{
+				"AfterSave " + collection + " 1", "AfterSave " + collection + " 2",
+				"AfterUpdate " + collection + " 1", "AfterUpdate " + collection + " 2",
+				"AfterDelete " + collection + " 1",
+			})
+		})
+		Convey("Write results run the hooks of the rows they wrote", func() {
+			_, err := mem.Save("1", collection, map[string]interface{}{"id": "1"})
+			So(err, ShouldBeNil)
+			result, err := store.BatchUpdateResult([]interface{}{"1", "9"}, []interface{}{map[string]interface{}{"kind": "a"}, map[string]interface{}{"kind": "b"}}, collection, nil)
+			So(err, ShouldBeNil)
+			So(result.Updated, ShouldEqual, 1)
+			So(mem.Get("1", collection, &row), ShouldBeNil)
+			So(row["stamped"], ShouldEqual, true)
+			So(audit, ShouldResemble, []string{"AfterUpdate " + collection + " 1"})
+			_, err = store.FilterUpdateResult(map[string]interface{}{"id": "1"}, map[string]interface{}{"kind": "c"}, collection, nil, WriteOptions{DryRun: true})
+			So(err, ShouldBeNil)
+			So(audit, ShouldHaveLength, 1)
+			_, err = NewHookedStore(NewScribbleStore("/tmp/scribble.hooks.test")).FilterDeleteResult(map[string]interface{}{"id": "1"}, collection, nil)
+			So(err, ShouldEqual, ErrNotImplemented)
+		})
+		Convey("A before hook vetoes the write", func() {
+			veto := errors.New("read only")
+			store.On(BeforeSave, collection, func(e *HookEvent) error {
+				if doc, ok := e.Doc.(map[string]interface{}); ok && doc["id"] == "2" {
+					return veto
+				}
+				return nil
+			})
+			_, err := store.BatchInsert([]interface{}{map[string]interface{}{"id": "1"}, map[string]interface{}{"id": "2"}}, collection, nil)
+			So(err, ShouldEqual, veto)
+			So(mem.Get("1", collection, &row), ShouldEqual, ErrNotFound)
+			So(audit, ShouldBeEmpty)
+		})
+		Convey("Filter writes describe their filter", func() {
+			_, err := mem.Save("1", collection, map[string]interface{}{"id": "1", "kind": "thing"})
+			So(err, ShouldBeNil)
+			var filters []map[string]interface{}
+			store.On(BeforeDelete, collection, func(e *HookEvent) error {
+				filters = append(filters, e.Filter)
+				return nil
+			})
+			So(store.FilterDelete(map[string]interface{}{"kind": "thing"}, collection, nil), ShouldBeNil)
+			So(filters, ShouldResemble, []map[string]interface{}{{"kind": "thing"}})
+			So(audit, ShouldResemble, []string{"AfterDelete " + collection + " "})
+		})
+		Convey("After hooks do not run when the write fails", func() {
+			So(store.Update("9", collection, map[string]interface{}{"kind": "thing"}), ShouldEqual, ErrNotFound)
+			So(audit, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,624 @@
+package gostore
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InstrumentOptions configures an InstrumentedStore
+type InstrumentOptions struct {
+	// Namespace prefixes the metric names, "gostore" when empty
+	Namespace string
+	// Registerer registers the metrics, prometheus.DefaultRegisterer when nil. Stores sharing a
+	// registerer share their metrics
+	Registerer prometheus.Registerer
+	// Buckets are the upper bounds of the latency histogram in seconds, prometheus.DefBuckets when nil
+	Buckets []float64
+	// Tracer starts the spans, opentracing.GlobalTracer() when nil
+	Tracer opentracing.Tracer
+}
+
+// InstrumentedStore records prometheus metrics and opentracing spans for every call to a store:
+//
+//	<namespace>_operation_duration_seconds{operation,table} latency of the calls
+//	<namespace>_operation_errors_total{operation,table,kind} failed calls by error kind
+//	<namespace>_rows_returned_total{operation,table} rows read from the returned ObjectRows
+//
+// The latency of a call returning rows excludes their iteration. Spans are named gostore.<operation>
+// and tagged with the table and the shape of the filter, its fields and operators without values.
+// The context methods start spans as children of the span in their context
+type InstrumentedStore struct {
+	store   ContextObjectStore
+	inner   ObjectStore
+	metrics *storeMetrics
+	tracer  opentracing.Tracer
+}
+
+type storeMetrics struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	rows     *prometheus.CounterVec
+}
+
+// NewInstrumentedStore wraps a store with metrics and tracing
+func NewInstrumentedStore(store ObjectStore, opts InstrumentOptions) (InstrumentedStore, error) {
+	if opts.Namespace == "" {
+		opts.Namespace = "gostore"
+	}
+	if opts.Registerer == nil {
+		opts.Registerer = prometheus.DefaultRegisterer
+	}
+	if opts.Buckets == nil {
+		opts.Buckets = prometheus.DefBuckets
+	}
+	duration, err := registerCollector(opts.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: opts.Namespace,
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of gostore operations.",
+		Buckets:   opts.Buckets,
+	}, []string{"operation", "table"}))
+	if err != nil {
+		return InstrumentedStore{}, err
+	}
+	errs, err := registerCollector(opts.Registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: opts.Namespace,
+		Name:      "operation_errors_total",
+		Help:      "Failed gostore operations by error kind.",
+	}, []string{"operation", "table", "kind"}))
+	if err != nil {
+		return InstrumentedStore{}, err
+	}
+	rows, err := registerCollector(opts.Registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: opts.Namespace,
+		Name:      "rows_returned_total",
+		Help:      "Rows returned by gostore operations.",
+	}, []string{"operation", "table"}))
+	if err != nil {
+		return InstrumentedStore{}, err
+	}
+	m := &storeMetrics{
+		duration: duration.(*prometheus.HistogramVec),
+		errors:   errs.(*prometheus.CounterVec),
+		rows:     rows.(*prometheus.CounterVec),
+	}
+	return InstrumentedStore{
+		store:   NewContextAdapter(store),
+		inner:   store,
+		metrics: m,
+		tracer:  opts.Tracer,
+	}, nil
+}
+
+// registerCollector registers c, or returns the equal collector registered before
+func registerCollector(r prometheus.Registerer, c prometheus.Collector) (prometheus.Collector, error) {
+	if err := r.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// ErrorKind names the kind of an error returned by a store for metrics and logs
+func ErrorKind(err error) string {
+	switch err {
+	case nil:
+		return ""
+	case ErrNotFound:
+		return "not_found"
+	case ErrDuplicatePk:
+		return "duplicate_pk"
+	case ErrNotImplemented:
+		return "not_implemented"
+	case ErrCodecMismatch:
+		return "codec_mismatch"
+	case ErrInvalidTransaction:
+		return "invalid_transaction"
+	case context.Canceled:
+		return "canceled"
+	case context.DeadlineExceeded:
+		return "deadline_exceeded"
+	}
+	if _, ok := err.(*FilterError); ok {
+		return "invalid_filter"
+	}
+	return "other"
+}
+
+// FilterShape describes the fields and operators of a filter without its values, e.g
+// "kind =, or(rating >, name ~)". It is "invalid" when the filter cannot be parsed
+func FilterShape(filter map[string]interface{}) string {
+	expr, err := ParseFilter(filter)
+	if err != nil {
+		return "invalid"
+	}
+	return strings.Join(exprShapes(expr.Exprs), ", ")
+}
+
+func exprShapes(exprs []FilterExpr) []string {
+	shapes := make([]string, 0, len(exprs))
+	for _, e := range exprs {
+		switch e := e.(type) {
+		case *FilterCondition:
+			shapes = append(shapes, e.Field()+" "+string(e.Op))
+		case *FilterGroup:
+			inner := exprShapes(e.Exprs)
+			if len(inner) == 1 {
+				shapes = append(shapes, inner[0])
+			} else {
+				shapes = append(shapes, string(e.Op)+"("+strings.Join(inner, ", ")+")")
+			}
+		}
+	}
+	sort.Strings(shapes)
+	return shapes
+}
+
+// observe starts the span of an operation, the returned function records its outcome
+func (s InstrumentedStore) observe(ctx context.Context, op, table string, filter map[string]interface{}) (context.Context, func(err error)) {
+	tracer := s.tracer
+	if tracer == nil {
+		tracer = opentracing.GlobalTracer()
+	}
+	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, tracer, "gostore."+op)
+	ext.Component.Set(span, "gostore")
+	if table != "" {
+		span.SetTag("db.table", table)
+	}
+	if filter != nil {
+		span.SetTag("db.filter", FilterShape(filter))
+	}
+	start := time.Now()
+	return ctx, func(err error) {
+		s.metrics.duration.WithLabelValues(op, table).Observe(time.Since(start).Seconds())
+		if err != nil {
+			kind := ErrorKind(err)
+			s.metrics.errors.WithLabelValues(op, table, kind).Inc()
+			span.SetTag("error.kind", kind)
+			if err != ErrNotFound {
+				ext.Error.Set(span, true)
+				span.LogFields(otlog.Error(err))
+			}
+		}
+		span.Finish()
+	}
+}
+
+// call records an operation which returns no rows
+func (s InstrumentedStore) call(ctx context.Context, op, table string, filter map[string]interface{}, fn func(ctx context.Context) error) error {
+	ctx, done := s.observe(ctx, op, table, filter)
+	err := fn(ctx)
+	done(err)
+	return err
+}
+
+// get records an operation which reads one row
+func (s InstrumentedStore) get(ctx context.Context, op, table string, filter map[string]interface{}, fn func(ctx context.Context) error) error {
+	err := s.call(ctx, op, table, filter, fn)
+	if err == nil {
+		s.metrics.rows.WithLabelValues(op, table).Inc()
+	}
+	return err
+}
+
+// rows records an operation which returns rows, they count the rows read from them
+func (s InstrumentedStore) rows(ctx context.Context, op, table string, filter map[string]interface{}, fn func(ctx context.Context) (ObjectRows, error)) (ObjectRows, error) {
+	ctx, done := s.observe(ctx, op, table, filter)
+	rows, err := fn(ctx)
+	done(err)
+	if err != nil || rows == nil {
+		return rows, err
+	}
+	return instrumentedRows{rows, s.metrics.rows.WithLabelValues(op, table)}, nil
+}
+
+type instrumentedRows struct {
+	ObjectRows
+	counter prometheus.Counter
+}
+
+func (r instrumentedRows) Next(dst interface{}) (bool, error) {
+	ok, err := r.ObjectRows.Next(dst)
+	if ok {
+		r.counter.Inc()
+	}
+	return ok, err
+}
+
+func (r instrumentedRows) NextRaw() ([]byte, bool) {
+	data, ok := r.ObjectRows.NextRaw()
+	if ok {
+		r.counter.Inc()
+	}
+	return data, ok
+}
+
+// Store returns the wrapped store
+func (s InstrumentedStore) Store() ObjectStore {
+	return s.inner
+}
+
+// Capabilities describes the wrapped store, InstrumentedStore exposes the ObjectStore and
+// ContextObjectStore apis and the write results of the wrapped store
+func (s InstrumentedStore) Capabilities() Capabilities {
+	c := decoratedCapabilities(s.inner)
+	c.Context = true
+	return c
+}
+
+func (s InstrumentedStore) GetStore() interface{} {
+	return s.store.GetStore()
+}
+
+func (s InstrumentedStore) Close() {
+	s.store.Close()
+}
+
+func (s InstrumentedStore) CreateDatabaseContext(ctx context.Context) error {
+	return s.call(ctx, "CreateDatabase", "", nil, func(ctx context.Context) error {
+		return s.store.CreateDatabaseContext(ctx)
+	})
+}
+
+func (s InstrumentedStore) CreateTableContext(ctx context.Context, table string, sample interface{}) error {
+	return s.call(ctx, "CreateTable", table, nil, func(ctx context.Context) error {
+		return s.store.CreateTableContext(ctx, table, sample)
+	})
+}
+
+func (s InstrumentedStore) StatsContext(ctx context.Context, store string) (data map[string]interface{}, err error) {
+	err = s.call(ctx, "Stats", store, nil, func(ctx context.Context) (err error) {
+		data, err = s.store.StatsContext(ctx, store)
+		return
+	})
+	return
+}
+
+func (s InstrumentedStore) AllContext(ctx context.Context, count int, skip int, store string) (ObjectRows, error) {
+	return s.rows(ctx, "All", store, nil, func(ctx context.Context) (ObjectRows, error) {
+		return s.store.AllContext(ctx, count, skip, store)
+	})
+}
+
+func (s InstrumentedStore) AllCursorContext(ctx context.Context, store string) (ObjectRows, error) {
+	return s.rows(ctx, "AllCursor", store, nil, func(ctx context.Context) (ObjectRows, error) {
+		return s.store.AllCursorContext(ctx, store)
+	})
+}
+
+func (s InstrumentedStore) AllWithinRangeContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.rows(ctx, "AllWithinRange", store, filter, func(ctx context.Context) (ObjectRows, error) {
+		return s.store.AllWithinRangeContext(ctx, filter, count, skip, store, opts)
+	})
+}
+
+func (s InstrumentedStore) SinceContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.rows(ctx, "Since", store, nil, func(ctx context.Context) (ObjectRows, error) {
+		return s.store.SinceContext(ctx, id, count, skip, store)
+	})
+}
+
+func (s InstrumentedStore) BeforeContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.rows(ctx, "Before", store, nil, func(ctx context.Context) (ObjectRows, error) {
+		return s.store.BeforeContext(ctx, id, count, skip, store)
+	})
+}
+
+func (s InstrumentedStore) FilterSinceContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.rows(ctx, "FilterSince", store, filter, func(ctx context.Context) (ObjectRows, error) {
+		return s.store.FilterSinceContext(ctx, id, filter, count, skip, store, opts)
+	})
+}
+
+func (s InstrumentedStore) FilterBeforeContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.rows(ctx, "FilterBefore", store, filter, func(ctx context.Context) (ObjectRows, error) {
+		return s.store.FilterBeforeContext(ctx, id, filter, count, skip, store, opts)
+	})
+}
+
+func (s InstrumentedStore) FilterBeforeCountContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (cnt int64, err error) {
+	err = s.call(ctx, "FilterBeforeCount", store, filter, func(ctx context.Context) (err error) {
+		cnt, err = s.store.FilterBeforeCountContext(ctx, id, filter, count, skip, store, opts)
+		return
+	})
+	return
+}
+
+func (s InstrumentedStore) GetContext(ctx context.Context, key string, store string, dst interface{}) error {
+	return s.get(ctx, "Get", store, nil, func(ctx context.Context) error {
+		return s.store.GetContext(ctx, key, store, dst)
+	})
+}
+
+func (s InstrumentedStore) SaveContext(ctx context.Context, key, store string, src interface{}) (saved string, err error) {
+	err = s.call(ctx, "Save", store, nil, func(ctx context.Context) (err error) {
+		saved, err = s.store.SaveContext(ctx, key, store, src)
+		return
+	})
+	return
+}
+
+func (s InstrumentedStore) SaveAllContext(ctx context.Context, store string, src ...interface{}) (keys []string, err error) {
+	err = s.call(ctx, "SaveAll", store, nil, func(ctx context.Context) (err error) {
+		keys, err = s.store.SaveAllContext(ctx, store, src...)
+		return
+	})
+	return
+}
+
+func (s InstrumentedStore) UpdateContext(ctx context.Context, key string, store string, src interface{}) error {
+	return s.call(ctx, "Update", store, nil, func(ctx context.Context) error {
+		return s.store.UpdateContext(ctx, key, store, src)
+	})
+}
+
+func (s InstrumentedStore) ReplaceContext(ctx context.Context, key string, store string, src interface{}) error {
+	return s.call(ctx, "Replace", store, nil, func(ctx context.Context) error {
+		return s.store.ReplaceContext(ctx, key, store, src)
+	})
+}
+
+func (s InstrumentedStore) DeleteContext(ctx context.Context, key string, store string) error {
+	return s.call(ctx, "Delete", store, nil, func(ctx context.Context) error {
+		return s.store.DeleteContext(ctx, key, store)
+	})
+}
+
+func (s InstrumentedStore) FilterUpdateContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.call(ctx, "FilterUpdate", store, filter, func(ctx context.Context) error {
+		return s.store.FilterUpdateContext(ctx, filter, src, store, opts)
+	})
+}
+
+func (s InstrumentedStore) FilterReplaceContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.call(ctx, "FilterReplace", store, filter, func(ctx context.Context) error {
+		return s.store.FilterReplaceContext(ctx, filter, src, store, opts)
+	})
+}
+
+func (s InstrumentedStore) FilterGetContext(ctx context.Context, filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	return s.get(ctx, "FilterGet", store, filter, func(ctx context.Context) error {
+		return s.store.FilterGetContext(ctx, filter, store, dst, opts)
+	})
+}
+
+func (s InstrumentedStore) FilterGetAllContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.rows(ctx, "FilterGetAll", store, filter, func(ctx context.Context) (ObjectRows, error) {
+		return s.store.FilterGetAllContext(ctx, filter, count, skip, store, opts)
+	})
+}
+
+func (s InstrumentedStore) QueryContext(ctx context.Context, filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (rows ObjectRows, agg AggregateResult, err error) {
+	rows, err = s.rows(ctx, "Query", store, filter, func(ctx context.Context) (rows ObjectRows, err error) {
+		rows, agg, err = s.store.QueryContext(ctx, filter, aggregates, count, skip, store, opts)
+		return
+	})
+	return
+}
+
+func (s InstrumentedStore) FilterDeleteContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.call(ctx, "FilterDelete", store, filter, func(ctx context.Context) error {
+		return s.store.FilterDeleteContext(ctx, filter, store, opts)
+	})
+}
+
+func (s InstrumentedStore) FilterCountContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) (cnt int64, err error) {
+	err = s.call(ctx, "FilterCount", store, filter, func(ctx context.Context) (err error) {
+		cnt, err = s.store.FilterCountContext(ctx, filter, store, opts)
+		return
+	})
+	return
+}
+
+func (s InstrumentedStore) GetByFieldContext(ctx context.Context, name, val, store string, dst interface{}) error {
+	return s.get(ctx, "GetByField", store, nil, func(ctx context.Context) error {
+		return s.store.GetByFieldContext(ctx, name, val, store, dst)
+	})
+}
+
+func (s InstrumentedStore) GetByFieldsByFieldContext(ctx context.Context, name, val, store string, fields []string, dst interface{}) error {
+	return s.get(ctx, "GetByFieldsByField", store, nil, func(ctx context.Context) error {
+		return s.store.GetByFieldsByFieldContext(ctx, name, val, store, fields, dst)
+	})
+}
+
+func (s InstrumentedStore) BatchDeleteContext(ctx context.Context, ids []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.call(ctx, "BatchDelete", store, nil, func(ctx context.Context) error {
+		return s.store.BatchDeleteContext(ctx, ids, store, opts)
+	})
+}
+
+func (s InstrumentedStore) BatchUpdateContext(ctx context.Context, ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.call(ctx, "BatchUpdate", store, nil, func(ctx context.Context) error {
+		return s.store.BatchUpdateContext(ctx, ids, data, store, opts)
+	})
+}
+
+func (s InstrumentedStore) BatchFilterDeleteContext(ctx context.Context, filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.call(ctx, "BatchFilterDelete", store, nil, func(ctx context.Context) error {
+		return s.store.BatchFilterDeleteContext(ctx, filter, store, opts)
+	})
+}
+
+func (s InstrumentedStore) BatchInsertContext(ctx context.Context, data []interface{}, store string, opts ObjectStoreOptions) (keys []string, err error) {
+	err = s.call(ctx, "BatchInsert", store, nil, func(ctx context.Context) (err error) {
+		keys, err = s.store.BatchInsertContext(ctx, data, store, opts)
+		return
+	})
+	return
+}
+
+// The ObjectStore api records spans without a parent
+
+func (s InstrumentedStore) CreateDatabase() error {
+	return s.CreateDatabaseContext(context.Background())
+}
+
+func (s InstrumentedStore) CreateTable(table string, sample interface{}) error {
+	return s.CreateTableContext(context.Background(), table, sample)
+}
+
+func (s InstrumentedStore) Stats(store string) (map[string]interface{}, error) {
+	return s.StatsContext(context.Background(), store)
+}
+
+func (s InstrumentedStore) All(count int, skip int, store string) (ObjectRows, error) {
+	return s.AllContext(context.Background(), count, skip, store)
+}
+
+func (s InstrumentedStore) AllCursor(store string) (ObjectRows, error) {
+	return s.AllCursorContext(context.Background(), store)
+}
+
+func (s InstrumentedStore) AllWithinRange(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.AllWithinRangeContext(context.Background(), filter, count, skip, store, opts)
+}
+
+func (s InstrumentedStore) Since(id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.SinceContext(context.Background(), id, count, skip, store)
+}
+
+func (s InstrumentedStore) Before(id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.BeforeContext(context.Background(), id, count, skip, store)
+}
+
+func (s InstrumentedStore) FilterSince(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.FilterSinceContext(context.Background(), id, filter, count, skip, store, opts)
+}
+
+func (s InstrumentedStore) FilterBefore(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.FilterBeforeContext(context.Background(), id, filter, count, skip, store, opts)
+}
+
+func (s InstrumentedStore) FilterBeforeCount(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.FilterBeforeCountContext(context.Background(), id, filter, count, skip, store, opts)
+}
+
+func (s InstrumentedStore) Get(key string, store string, dst interface{}) error {
+	return s.GetContext(context.Background(), key, store, dst)
+}
+
+func (s InstrumentedStore) Save(key, store string, src interface{}) (string, error) {
+	return s.SaveContext(context.Background(), key, store, src)
+}
+
+func (s InstrumentedStore) SaveAll(store string, src ...interface{}) ([]string, error) {
+	return s.SaveAllContext(context.Background(), store, src...)
+}
+
+func (s InstrumentedStore) Update(key string, store string, src interface{}) error {
+	return s.UpdateContext(context.Background(), key, store, src)
+}
+
+func (s InstrumentedStore) Replace(key string, store string, src interface{}) error {
+	return s.ReplaceContext(context.Background(), key, store, src)
+}
+
+func (s InstrumentedStore) Delete(key string, store string) error {
+	return s.DeleteContext(context.Background(), key, store)
+}
+
+func (s InstrumentedStore) FilterUpdate(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.FilterUpdateContext(context.Background(), filter, src, store, opts)
+}
+
+func (s InstrumentedStore) FilterReplace(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.FilterReplaceContext(context.Background(), filter, src, store, opts)
+}
+
+func (s InstrumentedStore) FilterGet(filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	return s.FilterGetContext(context.Background(), filter, store, dst, opts)
+}
+
+func (s InstrumentedStore) FilterGetAll(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.FilterGetAllContext(context.Background(), filter, count, skip, store, opts)
+}
+
+func (s InstrumentedStore) Query(filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error) {
+	return s.QueryContext(context.Background(), filter, aggregates, count, skip, store, opts)
+}
+
+func (s InstrumentedStore) FilterDelete(filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.FilterDeleteContext(context.Background(), filter, store, opts)
+}
+
+func (s InstrumentedStore) FilterCount(filter map[string]interface{}, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.FilterCountContext(context.Background(), filter, store, opts)
+}
+
+func (s InstrumentedStore) GetByField(name, val, store string, dst interface{}) error {
+	return s.GetByFieldContext(context.Background(), name, val, store, dst)
+}
+
+func (s InstrumentedStore) GetByFieldsByField(name, val, store string, fields []string, dst interface{}) error {
+	return s.GetByFieldsByFieldContext(context.Background(), name, val, store, fields, dst)
+}
+
+func (s InstrumentedStore) BatchDelete(ids []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.BatchDeleteContext(context.Background(), ids, store, opts)
+}
+
+func (s InstrumentedStore) BatchUpdate(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.BatchUpdateContext(context.Background(), ids, data, store, opts)
+}
+
+func (s InstrumentedStore) BatchFilterDelete(filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.BatchFilterDeleteContext(context.Background(), filter, store, opts)
+}
+
+func (s InstrumentedStore) BatchInsert(data []interface{}, store string, opts ObjectStoreOptions) ([]string, error) {
+	return s.BatchInsertContext(context.Background(), data, store, opts)
+}
+
+// The write results of the wrapped store are recorded like the writes above
+
+// result records an operation which reports its write
+func (s InstrumentedStore) result(op, table string, filter map[string]interface{}, fn func(w WriteResultStore) (WriteResult, error)) (result WriteResult, err error) {
+	err = s.call(context.Background(), op, table, filter, func(ctx context.Context) error {
+		w, err := writeResultStore(s.inner)
+		if err != nil {
+			return err
+		}
+		result, err = fn(w)
+		return err
+	})
+	return
+}
+
+func (s InstrumentedStore) BatchDeleteResult(ids []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	return s.result("BatchDeleteResult", store, nil, func(w WriteResultStore) (WriteResult, error) {
+		return w.BatchDeleteResult(ids, store, opts)
+	})
+}
+
+func (s InstrumentedStore) BatchUpdateResult(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	return s.result("BatchUpdateResult", store, nil, func(w WriteResultStore) (WriteResult, error) {
+		return w.BatchUpdateResult(ids, data, store, opts)
+	})
+}
+
+func (s InstrumentedStore) BatchFilterDeleteResult(filter []map[string]interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	return s.result("BatchFilterDeleteResult", store, nil, func(w WriteResultStore) (WriteResult, error) {
+		return w.BatchFilterDeleteResult(filter, store, opts)
+	})
+}
+
+func (s InstrumentedStore) FilterDeleteResult(filter map[string]interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	return s.result("FilterDeleteResult", store, filter, func(w WriteResultStore) (WriteResult, error) {
+		return w.FilterDeleteResult(filter, store, opts)
+	})
+}
+
+func (s InstrumentedStore) FilterUpdateResult(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions, wopts WriteOptions) (WriteResult, error) {
+	return s.result("FilterUpdateResult", store, filter, func(w WriteResultStore) (WriteResult, error) {
+		return w.FilterUpdateResult(filter, src, store, opts, wopts)
+	})
+}
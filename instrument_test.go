@@ -0,0 +1,118 @@
+package gostore
+
+import (
+	"context"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// observations counts the latencies recorded for an operation
+func observations(registry *prometheus.Registry, op string) (n uint64) {
+	families, err := registry.Gather()
+	So(err, ShouldBeNil)
+	for _, f := range families {
+		if f.GetName() != "gostore_operation_duration_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "operation" && l.GetValue() == op {
+					n += m.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return
+}
+
+func TestInstrumentedStore(t *testing.T) {
+	Convey("Giving an instrumented memory store with some things", t, func() {
+		registry := prometheus.NewRegistry()
+		tracer := mocktracer.New()
+		store, err := NewInstrumentedStore(NewMemoryStore(), InstrumentOptions{Registerer: registry, Tracer: tracer})
+		So(err, ShouldBeNil)
+		for _, id := range []string{"1", "2", "3"} {
+			_, err := store.Save(id, collection, map[string]interface{}{"id": id, "kind": "thing", "rating": 3})
+			So(err, ShouldBeNil)
+		}
+		tracer.Reset()
+		Convey("Operations record their latency", func() {
+			var row map[string]interface{}
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			So(observations(registry, "Get"), ShouldEqual, 1)
+			So(observations(registry, "Save"), ShouldEqual, 3)
+			So(testutil.ToFloat64(store.metrics.rows.WithLabelValues("Get", collection)), ShouldEqual, 1)
+		})
+		Convey("Write results are recorded", func() {
+			result, err := store.FilterDeleteResult(map[string]interface{}{"id": "1"}, collection, nil)
+			So(err, ShouldBeNil)
+			So(result.Deleted, ShouldEqual, 1)
+			So(observations(registry, "FilterDeleteResult"), ShouldEqual, 1)
+			So(store.Capabilities().WriteResults, ShouldBeTrue)
+		})
+		Convey("Errors are counted by kind", func() {
+			var row map[string]interface{}
+			So(store.Get("9", collection, &row), ShouldEqual, ErrNotFound)
+			_, err := store.Save("1", collection, map[string]interface{}{"id": "1"})
+			So(err, ShouldEqual, ErrDuplicatePk)
+			_, err = store.FilterCount(map[string]interface{}{"rating": []interface{}{}}, collection, nil)
+			So(err, ShouldNotBeNil)
+			So(testutil.ToFloat64(store.metrics.errors.WithLabelValues("Get", collection, "not_found")), ShouldEqual, 1)
+			So(testutil.ToFloat64(store.metrics.errors.WithLabelValues("Save", collection, "duplicate_pk")), ShouldEqual, 1)
+			So(testutil.ToFloat64(store.metrics.errors.WithLabelValues("FilterCount", collection, "invalid_filter")), ShouldEqual, 1)
+			spans := tracer.FinishedSpans()
+			So(spans, ShouldHaveLength, 3)
+			So(spans[0].Tag("error"), ShouldBeNil)
+			So(spans[0].Tag("error.kind"), ShouldEqual, "not_found")
+			So(spans[1].Tag("error"), ShouldEqual, true)
+		})
+		Convey("Rows are counted as they are read", func() {
+			So(rowIds(store.FilterGetAll(map[string]interface{}{"kind": "thing"}, 2, 0, collection, nil)), ShouldResemble, []string{"3", "2"})
+			So(testutil.ToFloat64(store.metrics.rows.WithLabelValues("FilterGetAll", collection)), ShouldEqual, 2)
+		})
+		Convey("Spans describe the table and the shape of the filter", func() {
+			_, err := store.FilterCount(map[string]interface{}{"kind": "thing", "rating": ">2"}, collection, nil)
+			So(err, ShouldBeNil)
+			spans := tracer.FinishedSpans()
+			So(spans, ShouldHaveLength, 1)
+			So(spans[0].OperationName, ShouldEqual, "gostore.FilterCount")
+			So(spans[0].Tag("db.table"), ShouldEqual, collection)
+			So(spans[0].Tag("db.filter"), ShouldEqual, "kind =, rating >")
+		})
+		Convey("Context methods start child spans", func() {
+			parent := tracer.StartSpan("request")
+			ctx := opentracing.ContextWithSpan(context.Background(), parent)
+			var row map[string]interface{}
+			So(store.GetContext(ctx, "1", collection, &row), ShouldBeNil)
+			parent.Finish()
+			spans := tracer.FinishedSpans()
+			So(spans, ShouldHaveLength, 2)
+			So(spans[0].ParentID, ShouldEqual, parent.Context().(mocktracer.MockSpanContext).SpanID)
+		})
+		Convey("Stores sharing a registerer share their metrics", func() {
+			other, err := NewInstrumentedStore(NewMemoryStore(), InstrumentOptions{Registerer: registry, Tracer: tracer})
+			So(err, ShouldBeNil)
+			So(other.metrics.errors, ShouldEqual, store.metrics.errors)
+		})
+		Convey("Capabilities include the context api", func() {
+			caps := store.Capabilities()
+			So(caps.Context, ShouldBeTrue)
+			So(caps.Aggregates, ShouldBeTrue)
+		})
+	})
+}
+
+func TestFilterShape(t *testing.T) {
+	Convey("Filter shapes omit values", t, func() {
+		So(FilterShape(map[string]interface{}{"name": "osiloke", "or": []interface{}{
+			map[string]interface{}{"rating": ">3"},
+			map[string]interface{}{"rating": "<1"},
+		}}), ShouldEqual, "name =, or(rating <, rating >)")
+		So(FilterShape(map[string]interface{}{"rating": []interface{}{}}), ShouldEqual, "invalid")
+	})
+}
@@ -0,0 +1,680 @@
+package gostore
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is an ObjectStore which keeps its tables in memory, it is meant for tests which need
+// realistic storage without a database server. Rows are stored encoded as JSON so callers never
+// share documents with the store. Keys sort like bolt keys and reads return rows newest first.
+// It is safe for concurrent use
+type MemoryStore struct {
+	db *memoryDB
+}
+
+type memoryDB struct {
+	sync.RWMutex
+	tables map[string]*memoryTable
+}
+
+// memoryTable holds the encoded rows of a table and their sorted keys
+type memoryTable struct {
+	db   *memoryDB
+	name string
+	keys []string
+	rows map[string][]byte
+}
+
+func init() {
+	Register("memory", DriverFunc(openMemory))
+}
+
+// openMemory opens memory://, every url opens a new empty store
+func openMemory(u *url.URL) (ObjectStore, error) {
+	return NewMemoryStore(), nil
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() MemoryStore {
+	return MemoryStore{&memoryDB{tables: make(map[string]*memoryTable)}}
+}
+
+// Capabilities describes MemoryStore, it implements every operation
+func (s MemoryStore) Capabilities() Capabilities {
+	c := newCapabilities(s)
+	c.FilterOperators = FilterOperators
+	c.Aggregates = true
+	return c
+}
+
+// table returns a table, it is created when create is true. The caller holds the lock
+func (s MemoryStore) table(name string, create bool) *memoryTable {
+	t, ok := s.db.tables[name]
+	if !ok && create {
+		t = &memoryTable{db: s.db, name: name, rows: make(map[string][]byte)}
+		s.db.tables[name] = t
+	}
+	return t
+}
+
+func (t *memoryTable) put(key string, v []byte) {
+	old, ok := t.rows[key]
+	if !ok {
+		i := sort.SearchStrings(t.keys, key)
+		t.keys = append(t.keys, "")
+		copy(t.keys[i+1:], t.keys[i:])
+		t.keys[i] = key
+	}
+	t.rows[key] = v
+	t.changed(key, old, v)
+}
+
+func (t *memoryTable) delete(key string) bool {
+	old, ok := t.rows[key]
+	if !ok {
+		return false
+	}
+	i := sort.SearchStrings(t.keys, key)
+	t.keys = append(t.keys[:i], t.keys[i+1:]...)
+	delete(t.rows, key)
+	t.changed(key, old, nil)
+	return true
+}
+
+// changed publishes the write of a row to the watchers of the table
+func (t *memoryTable) changed(key string, old, new []byte) {
+	if !watchingLocal(t.db, t.name) {
+		return
+	}
+	if old != nil {
+		old = append([]byte{}, old...)
+	}
+	if new != nil {
+		new = append([]byte{}, new...)
+	}
+	publishLocal(t.db, changeOf(t.name, key, old, new))
+}
+
+// scan walks a table from the newest key to the oldest like scanBucket, both bounds are exclusive
+// and an empty bound leaves that side open
+func (t *memoryTable) scan(lower, upper string, fn func(k string, v []byte) bool) {
+	if t == nil {
+		return
+	}
+	i := len(t.keys) - 1
+	if upper != "" {
+		i = sort.SearchStrings(t.keys, upper) - 1
+	}
+	for ; i >= 0; i-- {
+		k := t.keys[i]
+		if lower != "" && k <= lower {
+			return
+		}
+		if !fn(k, t.rows[k]) {
+			return
+		}
+	}
+}
+
+// match calls fn for every row of a table within the bounds which matches expr, newest first. The
+// caller holds the lock
+func (s MemoryStore) match(store string, expr *FilterGroup, lower, upper string, fn func(k string, v []byte, doc map[string]interface{}) bool) (err error) {
+	s.table(store, false).scan(lower, upper, func(k string, v []byte) bool {
+		var doc map[string]interface{}
+		if doc, err = decodeBoltDoc(JSONCodec, []byte(k), v); err != nil {
+			return false
+		}
+		if !expr.Match(doc) {
+			return true
+		}
+		return fn(k, v, doc)
+	})
+	return
+}
+
+// filterRows reads count matching rows after skip
+func (s MemoryStore) filterRows(store string, filter map[string]interface{}, lower, upper string, count, skip int) (ObjectRows, error) {
+	expr, err := ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	s.db.RLock()
+	defer s.db.RUnlock()
+	var objs [][][]byte
+	skipped := 0
+	err = s.match(store, expr, lower, upper, func(k string, v []byte, doc map[string]interface{}) bool {
+		if skipped < skip {
+			skipped++
+			return true
+		}
+		objs = append(objs, [][]byte{[]byte(k), v})
+		return count < 1 || len(objs) < count
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newBoltRows(objs, JSONCodec), nil
+}
+
+func (s MemoryStore) filterCount(store string, filter map[string]interface{}, lower, upper string) (cnt int64, err error) {
+	expr, err := ParseFilter(filter)
+	if err != nil {
+		return 0, err
+	}
+	s.db.RLock()
+	defer s.db.RUnlock()
+	err = s.match(store, expr, lower, upper, func(k string, v []byte, doc map[string]interface{}) bool {
+		cnt++
+		return true
+	})
+	return
+}
+
+// filterWrite rewrites every matching row with the document returned by change, a nil document
+// deletes the row. A dry run only counts the rows
+func (s MemoryStore) filterWrite(store string, filter map[string]interface{}, dryRun bool, change func(doc map[string]interface{}) map[string]interface{}) (result WriteResult, err error) {
+	expr, err := ParseFilter(filter)
+	if err != nil {
+		return
+	}
+	s.db.Lock()
+	defer s.db.Unlock()
+	changed := make(map[string][]byte)
+	var deleted []string
+	err = s.match(store, expr, "", "", func(k string, v []byte, doc map[string]interface{}) bool {
+		result.Matched++
+		var modified bool
+		if doc, modified, err = changeDoc(doc, change); err != nil {
+			return false
+		}
+		switch {
+		case doc == nil:
+			result.Deleted++
+			deleted = append(deleted, k)
+		case !modified:
+			result.Unchanged++
+		default:
+			result.Updated++
+			changed[k], err = JSONCodec.Marshal(doc)
+		}
+		return err == nil
+	})
+	if err != nil || dryRun {
+		return
+	}
+	t := s.table(store, false)
+	for k, v := range changed {
+		t.put(k, v)
+	}
+	for _, k := range deleted {
+		t.delete(k)
+	}
+	return
+}
+
+// decode decodes a row into dst and exposes its key as the id
+func (s MemoryStore) decode(k string, v []byte, dst interface{}) error {
+	if err := JSONCodec.Unmarshal(v, dst); err != nil {
+		return err
+	}
+	setRowKey(dst, k)
+	return nil
+}
+
+// memoryKey returns key, the id of src when key is empty or a new object id when src has none
+func memoryKey(key string, src interface{}) string {
+	if key != "" {
+		return key
+	}
+	if doc, err := toDoc(src); err == nil {
+		if id, ok := doc["id"].(string); ok && id != "" {
+			return id
+		}
+	}
+	return NewObjectId().Hex()
+}
+
+func (s MemoryStore) CreateDatabase() error {
+	return nil
+}
+
+func (s MemoryStore) CreateTable(table string, sample interface{}) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+	s.table(table, true)
+	return nil
+}
+
+// GetStore returns the store itself, it has no session
+func (s MemoryStore) GetStore() interface{} {
+	return s
+}
+
+func (s MemoryStore) Stats(store string) (map[string]interface{}, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+	t := s.table(store, false)
+	if t == nil {
+		return nil, ErrNotFound
+	}
+	return map[string]interface{}{"total_count": len(t.keys)}, nil
+}
+
+func (s MemoryStore) All(count int, skip int, store string) (ObjectRows, error) {
+	return s.filterRows(store, nil, "", "", count, skip)
+}
+
+// AllCursor reads a snapshot of every row of a table
+func (s MemoryStore) AllCursor(store string) (ObjectRows, error) {
+	return s.filterRows(store, nil, "", "", 0, 0)
+}
+
+func (s MemoryStore) AllWithinRange(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.FilterGetAll(filter, count, skip, store, opts)
+}
+
+// Since returns rows with keys greater than id, newest first
+func (s MemoryStore) Since(id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.filterRows(store, nil, id, "", count, skip)
+}
+
+// Before returns rows with keys less than id, newest first
+func (s MemoryStore) Before(id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.filterRows(store, nil, "", id, count, skip)
+}
+
+// FilterSince returns rows with keys greater than id which match the filter, newest first
+func (s MemoryStore) FilterSince(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.filterRows(store, filter, id, "", count, skip)
+}
+
+// FilterBefore returns rows with keys less than id which match the filter, newest first
+func (s MemoryStore) FilterBefore(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.filterRows(store, filter, "", id, count, skip)
+}
+
+func (s MemoryStore) FilterBeforeCount(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.filterCount(store, filter, "", id)
+}
+
+func (s MemoryStore) Get(key string, store string, dst interface{}) error {
+	s.db.RLock()
+	defer s.db.RUnlock()
+	t := s.table(store, false)
+	if t == nil {
+		return ErrNotFound
+	}
+	v, ok := t.rows[key]
+	if !ok {
+		return ErrNotFound
+	}
+	return s.decode(key, v, dst)
+}
+
+// Save inserts a row, it fails with ErrDuplicatePk when the key exists. An empty key is taken
+// from the id of src or generated
+func (s MemoryStore) Save(key, store string, src interface{}) (string, error) {
+	key = memoryKey(key, src)
+	v, err := JSONCodec.Marshal(src)
+	if err != nil {
+		return "", err
+	}
+	s.db.Lock()
+	defer s.db.Unlock()
+	t := s.table(store, true)
+	if _, ok := t.rows[key]; ok {
+		return "", ErrDuplicatePk
+	}
+	t.put(key, v)
+	return key, nil
+}
+
+// SaveAll inserts every row keyed by its id, nothing is saved when one of the keys exists
+func (s MemoryStore) SaveAll(store string, src ...interface{}) (keys []string, err error) {
+	values := make([][]byte, len(src))
+	keys = make([]string, len(src))
+	for i, row := range src {
+		keys[i] = memoryKey("", row)
+		if values[i], err = JSONCodec.Marshal(row); err != nil {
+			return nil, err
+		}
+	}
+	s.db.Lock()
+	defer s.db.Unlock()
+	t := s.table(store, true)
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if _, ok := t.rows[key]; ok || seen[key] {
+			return nil, ErrDuplicatePk
+		}
+		seen[key] = true
+	}
+	for i, key := range keys {
+		t.put(key, values[i])
+	}
+	return keys, nil
+}
+
+// Update merges src into an existing row
+func (s MemoryStore) Update(key string, store string, src interface{}) error {
+	update, err := toDoc(src)
+	if err != nil {
+		return err
+	}
+	s.db.Lock()
+	defer s.db.Unlock()
+	_, err = s.update(store, key, func(doc map[string]interface{}) map[string]interface{} {
+		return mergeDocs(doc, update)
+	})
+	return err
+}
+
+// update rewrites a row with the document returned by change, the caller holds the lock. A row
+// which the change leaves as it is is not written
+func (s MemoryStore) update(store, key string, change func(doc map[string]interface{}) map[string]interface{}) (changed bool, err error) {
+	t := s.table(store, false)
+	if t == nil {
+		return false, ErrNotFound
+	}
+	v, ok := t.rows[key]
+	if !ok {
+		return false, ErrNotFound
+	}
+	var doc map[string]interface{}
+	if err = JSONCodec.Unmarshal(v, &doc); err != nil {
+		return
+	}
+	if doc, changed, err = changeDoc(doc, change); err != nil || !changed {
+		return
+	}
+	if v, err = JSONCodec.Marshal(doc); err != nil {
+		return
+	}
+	t.put(key, v)
+	return
+}
+
+// Replace overwrites an existing row
+func (s MemoryStore) Replace(key string, store string, src interface{}) error {
+	v, err := JSONCodec.Marshal(src)
+	if err != nil {
+		return err
+	}
+	s.db.Lock()
+	defer s.db.Unlock()
+	t := s.table(store, false)
+	if t == nil {
+		return ErrNotFound
+	}
+	if _, ok := t.rows[key]; !ok {
+		return ErrNotFound
+	}
+	t.put(key, v)
+	return nil
+}
+
+// Delete removes a row, it fails with ErrNotFound when the key does not exist
+func (s MemoryStore) Delete(key string, store string) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+	t := s.table(store, false)
+	if t == nil || !t.delete(key) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s MemoryStore) FilterUpdate(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	_, err := s.FilterUpdateResult(filter, src, store, opts, WriteOptions{})
+	return err
+}
+
+// FilterUpdateResult updates the rows matching filter like FilterUpdate and reports the write, a dry
+// run only counts the rows
+func (s MemoryStore) FilterUpdateResult(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions, wopts WriteOptions) (WriteResult, error) {
+	update, err := updater(src)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	return s.filterWrite(store, filter, wopts.DryRun, update)
+}
+
+func (s MemoryStore) FilterReplace(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	replacement, err := toDoc(src)
+	if err != nil {
+		return err
+	}
+	_, err = s.filterWrite(store, filter, false, func(doc map[string]interface{}) map[string]interface{} {
+		return replacement
+	})
+	return err
+}
+
+// FilterGet retrieves the newest row which matches the filter
+func (s MemoryStore) FilterGet(filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	expr, err := ParseFilter(filter)
+	if err != nil {
+		return err
+	}
+	return s.getExpr(store, expr, dst)
+}
+
+// getExpr decodes the newest row matching expr into dst
+func (s MemoryStore) getExpr(store string, expr *FilterGroup, dst interface{}) error {
+	s.db.RLock()
+	defer s.db.RUnlock()
+	var key string
+	var found []byte
+	err := s.match(store, expr, "", "", func(k string, v []byte, doc map[string]interface{}) bool {
+		key, found = k, v
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if found == nil {
+		return ErrNotFound
+	}
+	return s.decode(key, found, dst)
+}
+
+func (s MemoryStore) FilterGetAll(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.filterRows(store, filter, "", "", count, skip)
+}
+
+// Query retrieves a page of rows like FilterGetAll and computes the aggregates over every row
+// matching the filter
+func (s MemoryStore) Query(filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error) {
+	agg, err := NewAggregator(aggregates)
+	if err != nil {
+		return nil, nil, err
+	}
+	expr, err := ParseFilter(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.db.RLock()
+	defer s.db.RUnlock()
+	var objs [][][]byte
+	matched := 0
+	err = s.match(store, expr, "", "", func(k string, v []byte, doc map[string]interface{}) bool {
+		agg.Add(doc)
+		if matched >= skip && (count < 1 || len(objs) < count) {
+			objs = append(objs, [][]byte{[]byte(k), v})
+		}
+		matched++
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return newBoltRows(objs, JSONCodec), agg.Result(), nil
+}
+
+func (s MemoryStore) FilterDelete(filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	_, err := s.FilterDeleteResult(filter, store, opts)
+	return err
+}
+
+// FilterDeleteResult removes the rows matching filter and reports how many it deleted
+func (s MemoryStore) FilterDeleteResult(filter map[string]interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	return s.filterWrite(store, filter, false, func(doc map[string]interface{}) map[string]interface{} {
+		return nil
+	})
+}
+
+func (s MemoryStore) FilterCount(filter map[string]interface{}, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.filterCount(store, filter, "", "")
+}
+
+// GetByField retrieves the newest row whose field equals val, the field may be a nested path
+func (s MemoryStore) GetByField(name, val, store string, dst interface{}) error {
+	return s.getExpr(store, fieldFilter(name, val), dst)
+}
+
+// GetByFieldsByField retrieves the top level fields of the newest row whose field equals val
+func (s MemoryStore) GetByFieldsByField(name, val, store string, fields []string, dst interface{}) error {
+	var doc map[string]interface{}
+	if err := s.getExpr(store, fieldFilter(name, val), &doc); err != nil {
+		return err
+	}
+	plucked := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if v, ok := doc[f]; ok {
+			plucked[f] = v
+		}
+	}
+	v, err := JSONCodec.Marshal(plucked)
+	if err != nil {
+		return err
+	}
+	return JSONCodec.Unmarshal(v, dst)
+}
+
+// BatchDelete removes rows by key, keys which do not exist are ignored
+func (s MemoryStore) BatchDelete(ids []interface{}, store string, opts ObjectStoreOptions) (err error) {
+	_, err = s.BatchDeleteResult(ids, store, opts)
+	return
+}
+
+// BatchDeleteResult removes rows by key, keys which do not exist are skipped
+func (s MemoryStore) BatchDeleteResult(ids []interface{}, store string, opts ObjectStoreOptions) (result WriteResult, err error) {
+	s.db.Lock()
+	defer s.db.Unlock()
+	t := s.table(store, false)
+	for _, id := range ids {
+		key, err := batchKey(id)
+		switch {
+		case err != nil:
+			result.fail(fmt.Sprint(id), err)
+		case t != nil && t.delete(key):
+			result.Matched++
+			result.Deleted++
+		default:
+			result.Skipped++
+		}
+	}
+	return
+}
+
+// BatchUpdate merges data[i] into the row with ids[i], nothing is updated when a row does not exist
+func (s MemoryStore) BatchUpdate(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	_, err := s.batchUpdate(ids, data, store, true)
+	return err
+}
+
+// BatchUpdateResult merges data[i] into the row with ids[i], the keys which have no row fail with
+// ErrNotFound while the other rows are updated
+func (s MemoryStore) BatchUpdateResult(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	return s.batchUpdate(ids, data, store, false)
+}
+
+// batchUpdate merges data into rows by key, when strict nothing is updated unless every row exists
+func (s MemoryStore) batchUpdate(ids []interface{}, data []interface{}, store string, strict bool) (result WriteResult, err error) {
+	if len(ids) != len(data) {
+		return result, fmt.Errorf("gostore: %d ids and %d documents to update", len(ids), len(data))
+	}
+	updates := make([]func(doc map[string]interface{}) map[string]interface{}, len(data))
+	for i, d := range data {
+		if updates[i], err = updater(d); err != nil {
+			return
+		}
+	}
+	s.db.Lock()
+	defer s.db.Unlock()
+	t := s.table(store, false)
+	if strict {
+		for _, id := range ids {
+			key, _ := id.(string)
+			if t == nil {
+				return result, ErrNotFound
+			}
+			if _, ok := t.rows[key]; !ok {
+				return result, ErrNotFound
+			}
+		}
+	}
+	seen := make(map[string]bool, len(ids))
+	for i, id := range ids {
+		key, err := batchKey(id)
+		if err != nil {
+			result.fail(fmt.Sprint(id), err)
+			continue
+		}
+		if seen[key] {
+			//a key given twice sees its first update
+			continue
+		}
+		seen[key] = true
+		changed, err := s.update(store, key, updates[i])
+		switch {
+		case err == ErrNotFound:
+			result.fail(key, err)
+			continue
+		case err != nil:
+			return result, err
+		case changed:
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+		result.Matched++
+	}
+	return
+}
+
+// BatchFilterDelete removes rows matching any of the filters
+func (s MemoryStore) BatchFilterDelete(filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	_, err := s.BatchFilterDeleteResult(filter, store, opts)
+	return err
+}
+
+// BatchFilterDeleteResult removes rows matching any of the filters and reports how many it deleted
+func (s MemoryStore) BatchFilterDeleteResult(filter []map[string]interface{}, store string, opts ObjectStoreOptions) (result WriteResult, err error) {
+	for _, f := range filter {
+		deleted, err := s.FilterDeleteResult(f, store, opts)
+		result.add(deleted)
+		if err != nil {
+			return result, err
+		}
+	}
+	return
+}
+
+// BatchInsert inserts every row like SaveAll
+func (s MemoryStore) BatchInsert(data []interface{}, store string, opts ObjectStoreOptions) (keys []string, err error) {
+	return s.SaveAll(store, data...)
+}
+
+// Watch streams the changes made to a table through the copies of the store
+func (s MemoryStore) Watch(store string, filter map[string]interface{}, opts WatchOptions) (ChangeFeed, error) {
+	return watchLocal(s.db, store, filter, opts)
+}
+
+// Close ends the change feeds of the store, its rows are kept
+func (s MemoryStore) Close() {
+	closeLocal(s.db)
+}
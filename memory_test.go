@@ -0,0 +1,83 @@
+package gostore
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryStore(t *testing.T) {
+	Convey("Giving a memory store with some things", t, func() {
+		store := NewMemoryStore()
+		things := []interface{}{
+			map[string]interface{}{"id": "1", "name": "First Thing", "kind": "thing", "rating": 4.5},
+			map[string]interface{}{"id": "2", "name": "Second Thing", "kind": "thing", "rating": 3},
+			map[string]interface{}{"id": "3", "name": "First Something", "kind": "something", "rating": 5},
+		}
+		_, err := store.SaveAll(collection, things...)
+		So(err, ShouldBeNil)
+		Convey("Keys are unique", func() {
+			_, err := store.Save("1", collection, map[string]interface{}{"name": "Again"})
+			So(err, ShouldEqual, ErrDuplicatePk)
+			_, err = store.SaveAll(collection, map[string]interface{}{"id": "4"}, map[string]interface{}{"id": "2"})
+			So(err, ShouldEqual, ErrDuplicatePk)
+			var row map[string]interface{}
+			So(store.Get("4", collection, &row), ShouldEqual, ErrNotFound)
+		})
+		Convey("Empty keys are taken from the id or generated", func() {
+			key, err := store.Save("", collection, map[string]interface{}{"id": "9", "name": "Ninth"})
+			So(err, ShouldBeNil)
+			So(key, ShouldEqual, "9")
+			key, err = store.Save("", collection, map[string]interface{}{"name": "Generated"})
+			So(err, ShouldBeNil)
+			So(IsObjectIdHex(key), ShouldBeTrue)
+			var row map[string]interface{}
+			So(store.Get(key, collection, &row), ShouldBeNil)
+			So(row["id"], ShouldEqual, key)
+		})
+		Convey("Writes to missing rows fail with ErrNotFound", func() {
+			So(store.Update("7", collection, map[string]interface{}{"name": "x"}), ShouldEqual, ErrNotFound)
+			So(store.Replace("7", collection, map[string]interface{}{"name": "x"}), ShouldEqual, ErrNotFound)
+			So(store.Delete("7", collection), ShouldEqual, ErrNotFound)
+			So(store.BatchUpdate([]interface{}{"1", "7"}, []interface{}{map[string]interface{}{}, map[string]interface{}{}}, collection, nil), ShouldEqual, ErrNotFound)
+		})
+		Convey("Query aggregates every matching row", func() {
+			rows, agg, err := store.Query(map[string]interface{}{"name": "~^First"}, map[string]interface{}{"kind": map[string]interface{}{"top": true}}, 1, 0, collection, nil)
+			So(rowIds(rows, err), ShouldResemble, []string{"3"})
+			So(agg["kind"].(Match).Top, ShouldResemble, []TermCount{{"something", 1}, {"thing", 1}})
+		})
+		Convey("GetByFieldsByField returns the requested fields", func() {
+			var row map[string]interface{}
+			So(store.GetByFieldsByField("kind", "thing", collection, []string{"name"}, &row), ShouldBeNil)
+			So(row, ShouldResemble, map[string]interface{}{"name": "Second Thing"})
+		})
+		Convey("Stored rows are not shared with callers", func() {
+			thing := things[0].(map[string]interface{})
+			thing["name"] = "Changed"
+			var row map[string]interface{}
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			So(row["name"], ShouldEqual, "First Thing")
+		})
+		Convey("Concurrent writers and readers are safe", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(2)
+				go func(i int) {
+					defer wg.Done()
+					store.Save(fmt.Sprintf("c%02d", i), collection, map[string]interface{}{"kind": "concurrent"})
+				}(i)
+				go func() {
+					defer wg.Done()
+					store.FilterUpdate(map[string]interface{}{"kind": "concurrent"}, map[string]interface{}{"seen": true}, collection, nil)
+					rowIds(store.All(0, 0, collection))
+				}()
+			}
+			wg.Wait()
+			cnt, err := store.FilterCount(map[string]interface{}{"kind": "concurrent"}, collection, nil)
+			So(err, ShouldBeNil)
+			So(cnt, ShouldEqual, 20)
+		})
+	})
+}
@@ -400,6 +400,38 @@ func (_m *ObjectStore) GetStore() interface{} {
 	return r0
 }
 
+// Query provides a mock function with given fields: filter, aggregates, count, skip, store, opts
+func (_m *ObjectStore) Query(filter map[string]interface{}, aggregates map[string]interface{}, count int, skip int, store string, opts gostore.ObjectStoreOptions) (gostore.ObjectRows, gostore.AggregateResult, error) {
+	ret := _m.Called(filter, aggregates, count, skip, store, opts)
+
+	var r0 gostore.ObjectRows
+	if rf, ok := ret.Get(0).(func(map[string]interface{}, map[string]interface{}, int, int, string, gostore.ObjectStoreOptions) gostore.ObjectRows); ok {
+		r0 = rf(filter, aggregates, count, skip, store, opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(gostore.ObjectRows)
+		}
+	}
+
+	var r1 gostore.AggregateResult
+	if rf, ok := ret.Get(1).(func(map[string]interface{}, map[string]interface{}, int, int, string, gostore.ObjectStoreOptions) gostore.AggregateResult); ok {
+		r1 = rf(filter, aggregates, count, skip, store, opts)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(gostore.AggregateResult)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(map[string]interface{}, map[string]interface{}, int, int, string, gostore.ObjectStoreOptions) error); ok {
+		r2 = rf(filter, aggregates, count, skip, store, opts)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // Replace provides a mock function with given fields: key, store, src
 func (_m *ObjectStore) Replace(key string, store string, src interface{}) error {
 	ret := _m.Called(key, store, src)
@@ -0,0 +1,180 @@
+package gostore
+
+import (
+	"encoding/json"
+)
+
+// aggregate counts the rows of a table matching a compiled filter into the aggregates of
+// a Query. The missing, matched and unmatched rows and the ranges of every aggregate are counted
+// by one query, the top terms of an aggregate are grouped by a query of their own
+func (s PostgresObjectStore) aggregate(table, where string, args []interface{}, agg *Aggregator) error {
+	if len(agg.aggs) == 0 {
+		return nil
+	}
+	f := &postgresFilter{}
+	f.write("SELECT ")
+	var counts []*int
+	for i, a := range agg.aggs {
+		if i > 0 {
+			f.write(", ")
+		}
+		c := &FilterCondition{Path: a.field}
+		f.write("count(*) FILTER (WHERE ")
+		f.missing(c)
+		f.write("), count(*) FILTER (WHERE NOT ")
+		f.missing(c)
+		if a.match != nil {
+			f.write(" AND (")
+			f.condition(a.match)
+			f.write(") IS TRUE), count(*) FILTER (WHERE NOT ")
+			f.missing(c)
+			f.write(" AND (")
+			f.condition(a.match)
+			f.write(") IS NOT TRUE")
+		}
+		f.write(")")
+		counts = append(counts, &a.result.Missing, &a.result.Matched)
+		if a.match != nil {
+			counts = append(counts, &a.result.UnMatched)
+		}
+		for i := range a.nums {
+			r := &a.nums[i]
+			var from, to interface{}
+			if r.From != nil {
+				from = *r.From
+			}
+			if r.To != nil {
+				to = *r.To
+			}
+			f.countWithin(func() { f.number(c) }, from, to)
+			counts = append(counts, &r.Count)
+		}
+		for i := range a.dates {
+			r := &a.dates[i]
+			var from, to interface{}
+			if r.From != nil {
+				from = *r.From
+			}
+			if r.To != nil {
+				to = *r.To
+			}
+			f.countWithin(func() { f.time(c) }, from, to)
+			counts = append(counts, &r.Count)
+		}
+	}
+	f.write(" FROM "+s.db.Dialect().Quote(table)+" WHERE "+where, args...)
+	dst := make([]interface{}, len(counts))
+	for i := range dst {
+		dst[i] = new(int64)
+	}
+	if err := s.db.Raw(f.sql.String(), f.args...).Row().Scan(dst...); err != nil {
+		return err
+	}
+	for i, n := range dst {
+		*counts[i] = int(*n.(*int64))
+	}
+	for _, a := range agg.aggs {
+		if a.top > 0 {
+			if err := s.topTerms(table, where, args, a); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// topTerms counts the values of the field of an aggregate, the elements of an array are
+// counted one by one. Values which are not strings, numbers or booleans are counted as other
+func (s PostgresObjectStore) topTerms(table, where string, args []interface{}, a *aggregation) error {
+	c := &FilterCondition{Path: a.field}
+	f := &postgresFilter{}
+	f.write("SELECT term, count(*) FROM " + s.db.Dialect().Quote(table) + ", jsonb_array_elements(CASE WHEN ")
+	f.typeIs(c, "array")
+	f.write(" THEN ")
+	f.field(c, "#>")
+	f.write(" ELSE jsonb_build_array(")
+	f.field(c, "#>")
+	f.write(") END) AS term WHERE NOT ")
+	f.missing(c)
+	f.write(" AND "+where, args...)
+	f.write(" GROUP BY term ORDER BY count(*) DESC, term")
+	rows, err := s.db.Raw(f.sql.String(), f.args...).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var raw []byte
+		var n int
+		if err = rows.Scan(&raw, &n); err != nil {
+			return err
+		}
+		var term interface{}
+		if err = json.Unmarshal(raw, &term); err != nil {
+			return err
+		}
+		b, ok := indexValue(term)
+		if !ok {
+			a.result.Other += n
+			continue
+		}
+		key := string(b)
+		if tc, ok := a.terms[key]; ok {
+			tc.Count += n
+			continue
+		}
+		a.terms[key] = &TermCount{Term: term, Count: n}
+		a.order = append(a.order, key)
+	}
+	return rows.Err()
+}
+
+// countWithin counts the rows whose value lies within [from, to), a nil bound is open and rows
+// without a value are not counted
+func (f *postgresFilter) countWithin(value func(), from, to interface{}) {
+	f.write(", count(*) FILTER (WHERE ")
+	value()
+	f.write(" IS NOT NULL")
+	if from != nil {
+		f.write(" AND ")
+		value()
+		f.write(" >= ?", from)
+	}
+	if to != nil {
+		f.write(" AND ")
+		value()
+		f.write(" < ?", to)
+	}
+	f.write(")")
+}
+
+// missing is true when a field is absent or null, like lookupField
+func (f *postgresFilter) missing(c *FilterCondition) {
+	f.write("(COALESCE(jsonb_typeof")
+	f.field(c, "#>")
+	f.write(", 'null') = 'null')")
+}
+
+// number reads a field which is a JSON number, it is null for other values like toFloat
+func (f *postgresFilter) number(c *FilterCondition) {
+	f.write("(CASE WHEN ")
+	f.typeIs(c, "number")
+	f.write(" THEN ")
+	f.field(c, "#>>")
+	f.write("::numeric END)")
+}
+
+// time reads numbers as unix seconds and strings as dates, it is null for other values like toTime
+func (f *postgresFilter) time(c *FilterCondition) {
+	f.write("(CASE WHEN ")
+	f.typeIs(c, "number")
+	f.write(" THEN to_timestamp(trunc(")
+	f.field(c, "#>>")
+	f.write("::double precision)) WHEN ")
+	f.typeIs(c, "string")
+	f.write(" THEN (CASE WHEN ")
+	f.field(c, "#>>")
+	f.write(" ~ " + postgresTimePattern + " THEN ")
+	f.field(c, "#>>")
+	f.write("::timestamptz END) END)")
+}
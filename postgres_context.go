@@ -0,0 +1,272 @@
+package gostore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// contextTx returns a copy of the store whose queries run in a transaction begun with ctx. gorm
+// cannot pass a context to a single query, instead database/sql rolls the transaction back once
+// ctx is done and the deadline of ctx becomes the statement_timeout of the transaction so postgres
+// cancels a statement which runs past it
+func (s PostgresObjectStore) contextTx(ctx context.Context) (PostgresObjectStore, error) {
+	if err := ctx.Err(); err != nil {
+		return s, err
+	}
+	tx := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: s.isolation})
+	if tx.Error != nil {
+		return s, tx.Error
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := int64(time.Until(deadline) / time.Millisecond)
+		if timeout < 1 {
+			timeout = 1
+		}
+		if err := tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout)).Error; err != nil {
+			tx.Rollback()
+			return s, err
+		}
+	}
+	s.db = tx
+	return s, nil
+}
+
+// runContext calls fn with a copy of the store bound to ctx and commits its transaction unless fn fails
+func (s PostgresObjectStore) runContext(ctx context.Context, fn func(PostgresObjectStore) error) error {
+	ts, err := s.contextTx(ctx)
+	if err != nil {
+		return err
+	}
+	if err = fn(ts); err != nil {
+		ts.db.Rollback()
+		return err
+	}
+	return ts.db.Commit().Error
+}
+
+// rowsContext calls fn with a copy of the store bound to ctx, the transaction ends when the rows are closed
+func (s PostgresObjectStore) rowsContext(ctx context.Context, fn func(PostgresObjectStore) (ObjectRows, error)) (ObjectRows, error) {
+	ts, err := s.contextTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := fn(ts)
+	if err != nil || rows == nil {
+		ts.db.Rollback()
+		return rows, err
+	}
+	return NewContextRows(ctx, &postgresTxRows{rows, ts.db}), nil
+}
+
+// postgresTxRows are rows read in a transaction of their own
+type postgresTxRows struct {
+	ObjectRows
+	tx *gorm.DB
+}
+
+func (r *postgresTxRows) Close() {
+	r.ObjectRows.Close()
+	if r.tx != nil {
+		//the rows only read, committing releases the snapshot like a rollback would
+		r.tx.Commit()
+		r.tx = nil
+	}
+}
+
+func (s PostgresObjectStore) CreateDatabaseContext(ctx context.Context) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.CreateDatabase()
+	})
+}
+
+func (s PostgresObjectStore) CreateTableContext(ctx context.Context, table string, sample interface{}) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.CreateTable(table, sample)
+	})
+}
+
+func (s PostgresObjectStore) StatsContext(ctx context.Context, store string) (stats map[string]interface{}, err error) {
+	err = s.runContext(ctx, func(s PostgresObjectStore) (err error) {
+		stats, err = s.Stats(store)
+		return
+	})
+	return
+}
+
+func (s PostgresObjectStore) AllContext(ctx context.Context, count int, skip int, store string) (ObjectRows, error) {
+	return s.rowsContext(ctx, func(s PostgresObjectStore) (ObjectRows, error) {
+		return s.All(count, skip, store)
+	})
+}
+
+func (s PostgresObjectStore) AllCursorContext(ctx context.Context, store string) (ObjectRows, error) {
+	return s.rowsContext(ctx, func(s PostgresObjectStore) (ObjectRows, error) {
+		return s.AllCursor(store)
+	})
+}
+
+func (s PostgresObjectStore) AllWithinRangeContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.rowsContext(ctx, func(s PostgresObjectStore) (ObjectRows, error) {
+		return s.AllWithinRange(filter, count, skip, store, opts)
+	})
+}
+
+func (s PostgresObjectStore) SinceContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.rowsContext(ctx, func(s PostgresObjectStore) (ObjectRows, error) {
+		return s.Since(id, count, skip, store)
+	})
+}
+
+func (s PostgresObjectStore) BeforeContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.rowsContext(ctx, func(s PostgresObjectStore) (ObjectRows, error) {
+		return s.Before(id, count, skip, store)
+	})
+}
+
+func (s PostgresObjectStore) FilterSinceContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.rowsContext(ctx, func(s PostgresObjectStore) (ObjectRows, error) {
+		return s.FilterSince(id, filter, count, skip, store, opts)
+	})
+}
+
+func (s PostgresObjectStore) FilterBeforeContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.rowsContext(ctx, func(s PostgresObjectStore) (ObjectRows, error) {
+		return s.FilterBefore(id, filter, count, skip, store, opts)
+	})
+}
+
+func (s PostgresObjectStore) FilterBeforeCountContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (cnt int64, err error) {
+	err = s.runContext(ctx, func(s PostgresObjectStore) (err error) {
+		cnt, err = s.FilterBeforeCount(id, filter, count, skip, store, opts)
+		return
+	})
+	return
+}
+
+func (s PostgresObjectStore) GetContext(ctx context.Context, key string, store string, dst interface{}) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.Get(key, store, dst)
+	})
+}
+
+func (s PostgresObjectStore) SaveContext(ctx context.Context, key, store string, src interface{}) (id string, err error) {
+	err = s.runContext(ctx, func(s PostgresObjectStore) (err error) {
+		id, err = s.Save(key, store, src)
+		return
+	})
+	return
+}
+
+func (s PostgresObjectStore) SaveAllContext(ctx context.Context, store string, src ...interface{}) (keys []string, err error) {
+	err = s.runContext(ctx, func(s PostgresObjectStore) (err error) {
+		keys, err = s.SaveAll(store, src...)
+		return
+	})
+	return
+}
+
+func (s PostgresObjectStore) UpdateContext(ctx context.Context, key string, store string, src interface{}) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.Update(key, store, src)
+	})
+}
+
+func (s PostgresObjectStore) ReplaceContext(ctx context.Context, key string, store string, src interface{}) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.Replace(key, store, src)
+	})
+}
+
+func (s PostgresObjectStore) DeleteContext(ctx context.Context, key string, store string) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.Delete(key, store)
+	})
+}
+
+func (s PostgresObjectStore) FilterUpdateContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.FilterUpdate(filter, src, store, opts)
+	})
+}
+
+func (s PostgresObjectStore) FilterReplaceContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.FilterReplace(filter, src, store, opts)
+	})
+}
+
+func (s PostgresObjectStore) FilterGetContext(ctx context.Context, filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.FilterGet(filter, store, dst, opts)
+	})
+}
+
+func (s PostgresObjectStore) FilterGetAllContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.rowsContext(ctx, func(s PostgresObjectStore) (ObjectRows, error) {
+		return s.FilterGetAll(filter, count, skip, store, opts)
+	})
+}
+
+func (s PostgresObjectStore) QueryContext(ctx context.Context, filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (rows ObjectRows, agg AggregateResult, err error) {
+	rows, err = s.rowsContext(ctx, func(s PostgresObjectStore) (rows ObjectRows, err error) {
+		rows, agg, err = s.Query(filter, aggregates, count, skip, store, opts)
+		return
+	})
+	return
+}
+
+func (s PostgresObjectStore) FilterDeleteContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.FilterDelete(filter, store, opts)
+	})
+}
+
+func (s PostgresObjectStore) FilterCountContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) (cnt int64, err error) {
+	err = s.runContext(ctx, func(s PostgresObjectStore) (err error) {
+		cnt, err = s.FilterCount(filter, store, opts)
+		return
+	})
+	return
+}
+
+func (s PostgresObjectStore) GetByFieldContext(ctx context.Context, name, val, store string, dst interface{}) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.GetByField(name, val, store, dst)
+	})
+}
+
+func (s PostgresObjectStore) GetByFieldsByFieldContext(ctx context.Context, name, val, store string, fields []string, dst interface{}) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.GetByFieldsByField(name, val, store, fields, dst)
+	})
+}
+
+func (s PostgresObjectStore) BatchDeleteContext(ctx context.Context, ids []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.BatchDelete(ids, store, opts)
+	})
+}
+
+func (s PostgresObjectStore) BatchUpdateContext(ctx context.Context, ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.BatchUpdate(ids, data, store, opts)
+	})
+}
+
+func (s PostgresObjectStore) BatchFilterDeleteContext(ctx context.Context, filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.runContext(ctx, func(s PostgresObjectStore) error {
+		return s.BatchFilterDelete(filter, store, opts)
+	})
+}
+
+func (s PostgresObjectStore) BatchInsertContext(ctx context.Context, data []interface{}, store string, opts ObjectStoreOptions) (keys []string, err error) {
+	err = s.runContext(ctx, func(s PostgresObjectStore) (err error) {
+		keys, err = s.BatchInsert(data, store, opts)
+		return
+	})
+	return
+}
@@ -0,0 +1,228 @@
+package gostore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// postgresNumberPattern matches strings which compare as numbers, like compareFilterValue. It
+// avoids ? which gorm replaces with parameters
+const postgresNumberPattern = `'^\s*[-+]{0,1}([0-9]+\.{0,1}[0-9]*|\.[0-9]+)([eE][-+]{0,1}[0-9]+){0,1}\s*$'`
+
+// postgresTimePattern matches strings postgres can cast to timestamptz, like the RFC3339 dates toTime accepts
+const postgresTimePattern = `'^\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}'`
+
+// postgresFilter is a parameterised WHERE clause over the raw JSONB column
+type postgresFilter struct {
+	sql  strings.Builder
+	args []interface{}
+}
+
+// compilePostgresFilter translates a filter into SQL which matches the rows FilterExpr.Match matches.
+// Values are always passed as parameters and field paths are read with #> and #>>
+func compilePostgresFilter(filter map[string]interface{}) (string, []interface{}, error) {
+	expr, err := ParseFilter(filter)
+	if err != nil {
+		return "", nil, err
+	}
+	f := &postgresFilter{}
+	f.expr(expr)
+	return f.sql.String(), f.args, nil
+}
+
+func (f *postgresFilter) write(sql string, args ...interface{}) {
+	f.sql.WriteString(sql)
+	f.args = append(f.args, args...)
+}
+
+func (f *postgresFilter) expr(e FilterExpr) {
+	switch e := e.(type) {
+	case *FilterGroup:
+		f.group(e)
+	case *FilterCondition:
+		f.condition(e)
+	}
+}
+
+func (f *postgresFilter) group(g *FilterGroup) {
+	if len(g.Exprs) == 0 {
+		if g.Op == OrGroup {
+			f.write("FALSE")
+		} else {
+			f.write("TRUE")
+		}
+		return
+	}
+	sep := " AND "
+	if g.Op == OrGroup {
+		sep = " OR "
+	}
+	f.write("(")
+	for i, e := range g.Exprs {
+		if i > 0 {
+			f.write(sep)
+		}
+		f.expr(e)
+	}
+	f.write(")")
+}
+
+// field writes the JSONB value (#>) or its text (#>>) at a path. The path is written inline like
+// the expression indexes created by CreateTable so the planner can use them, a path which cannot
+// be written safely is passed as a parameter
+func (f *postgresFilter) field(c *FilterCondition, op string) {
+	if expr, ok := postgresFieldExpr(c.Path, op == "#>>"); ok {
+		f.write(expr)
+		return
+	}
+	f.write("(raw "+op+" ?::text[])", pq.Array(c.Path))
+}
+
+// postgresFieldExpr returns the expression reading a field of raw as text or JSONB. A top level
+// field uses ->> or ->, a nested one #>> or #>. Paths containing ? are refused, gorm would
+// treat it as a parameter
+func postgresFieldExpr(path []string, text bool) (string, bool) {
+	for _, p := range path {
+		if strings.Contains(p, "?") {
+			return "", false
+		}
+	}
+	if len(path) == 1 {
+		op := "->"
+		if text {
+			op = "->>"
+		}
+		return fmt.Sprintf("(raw %s %s)", op, postgresQuote(path[0])), true
+	}
+	elems := make([]string, len(path))
+	for i, p := range path {
+		elems[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(p) + `"`
+	}
+	op := "#>"
+	if text {
+		op = "#>>"
+	}
+	return fmt.Sprintf("(raw %s %s)", op, postgresQuote("{"+strings.Join(elems, ",")+"}")), true
+}
+
+// postgresQuote writes an escape string literal, it reads the same whether standard_conforming_strings
+// is on or off
+func postgresQuote(s string) string {
+	return "E'" + strings.NewReplacer(`\`, `\\`, "'", "''").Replace(s) + "'"
+}
+
+func (f *postgresFilter) typeIs(c *FilterCondition, kind string) {
+	f.write("jsonb_typeof")
+	f.field(c, "#>")
+	f.write(" = '" + kind + "'")
+}
+
+func (f *postgresFilter) condition(c *FilterCondition) {
+	switch c.Op {
+	case OpExists:
+		f.write("(")
+		f.field(c, "#>")
+		f.write(" NOT IN ('null'::jsonb, 'false'::jsonb))")
+		return
+	case OpGt:
+		f.compare(c, ">")
+		return
+	case OpLt:
+		f.compare(c, "<")
+		return
+	}
+	f.write("(")
+	for i, v := range c.Values {
+		if i > 0 {
+			f.write(" OR ")
+		}
+		if c.Op == OpMatch {
+			f.write("(")
+			f.typeIs(c, "string")
+			f.write(" AND ")
+			f.field(c, "#>>")
+			f.write(" ~ ?)", v.Str)
+			continue
+		}
+		f.equal(c, v)
+	}
+	f.write(")")
+}
+
+// equal compares JSONB values so a string never equals a number, like equalFilterValue
+func (f *postgresFilter) equal(c *FilterCondition, v FilterValue) {
+	switch v.Kind {
+	case StringValue:
+		//compare the text first so an expression index on the field applies
+		f.write("(")
+		f.field(c, "#>>")
+		f.write(" = ? AND ", v.Str)
+		f.typeIs(c, "string")
+		f.write(")")
+	case NumberValue:
+		f.field(c, "#>")
+		f.write(" = to_jsonb(?::numeric)", v.Number)
+	case BoolValue:
+		f.field(c, "#>")
+		f.write(" = to_jsonb(?::boolean)", v.Bool)
+	case NullValue:
+		f.field(c, "#>")
+		f.write(" = 'null'::jsonb")
+	case TimeValue:
+		f.timeCompare(c, "=", v)
+	default:
+		f.write("FALSE")
+	}
+}
+
+// compare orders a field against an operand like compareFilterValue. Casts are guarded by CASE
+// so rows whose field has another type do not match instead of failing the query
+func (f *postgresFilter) compare(c *FilterCondition, op string) {
+	v := c.Values[0]
+	switch v.Kind {
+	case NumberValue:
+		f.write("(CASE WHEN ")
+		f.typeIs(c, "number")
+		f.write(" THEN ")
+		f.field(c, "#>>")
+		f.write(fmt.Sprintf("::numeric %s ?", op), v.Number)
+		f.write(" WHEN ")
+		f.typeIs(c, "string")
+		f.write(" THEN (CASE WHEN ")
+		f.field(c, "#>>")
+		f.write(" ~ " + postgresNumberPattern + " THEN ")
+		f.field(c, "#>>")
+		f.write(fmt.Sprintf("::numeric %s ?", op), v.Number)
+		f.write(" ELSE ")
+		f.field(c, "#>>")
+		f.write(fmt.Sprintf(` COLLATE "C" %s ? END) END)`, op), v.Raw)
+	case TimeValue:
+		f.timeCompare(c, op, v)
+	case StringValue:
+		f.write("(CASE WHEN ")
+		f.typeIs(c, "string")
+		f.write(" THEN ")
+		f.field(c, "#>>")
+		f.write(fmt.Sprintf(` COLLATE "C" %s ? END)`, op), v.Str)
+	default:
+		f.write("FALSE")
+	}
+}
+
+// timeCompare reads numbers as unix seconds and strings as dates, like toTime
+func (f *postgresFilter) timeCompare(c *FilterCondition, op string, v FilterValue) {
+	f.write("(CASE WHEN ")
+	f.typeIs(c, "number")
+	f.write(" THEN to_timestamp(")
+	f.field(c, "#>>")
+	f.write(fmt.Sprintf("::double precision) %s ?", op), v.Time)
+	f.write(" WHEN ")
+	f.typeIs(c, "string")
+	f.write(" THEN (CASE WHEN ")
+	f.field(c, "#>>")
+	f.write(" ~ " + postgresTimePattern + " THEN ")
+	f.field(c, "#>>")
+	f.write(fmt.Sprintf("::timestamptz %s ? END) END)", op), v.Time)
+}
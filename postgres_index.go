@@ -0,0 +1,57 @@
+package gostore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// postgresIndexName names an index after its table, postgres index names are unique per schema
+func postgresIndexName(table, name string) string {
+	return `"` + strings.Replace(table+"_"+name+"_idx", `"`, `""`, -1) + `"`
+}
+
+// postgresIndexStatements returns the statements creating the indexes of a CreateTable schema.
+// Like RethinkStore, schema["index"] maps an index name to nothing for an index on the field with
+// that name or to a list of fields for a compound index. Fields are indexed as text with the
+// expressions filters compile to. schema["gin"] adds a GIN index on raw, true for the default
+// operator class or the name of one such as jsonb_path_ops
+func postgresIndexStatements(table string, schema interface{}) (stmts []string, err error) {
+	indexes := schemaIndexes(schema)
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fields := indexes[name]
+		if len(fields) == 0 {
+			fields = []string{name}
+		}
+		exprs := make([]string, len(fields))
+		for i, field := range fields {
+			expr, ok := postgresFieldExpr(splitFieldPath(field), true)
+			if !ok {
+				return nil, fmt.Errorf("cannot index field %q of %s", field, table)
+			}
+			exprs[i] = expr
+		}
+		stmts = append(stmts, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)",
+			postgresIndexName(table, name), table, strings.Join(exprs, ", ")))
+	}
+	s, _ := schema.(map[string]interface{})
+	switch gin := s["gin"].(type) {
+	case bool:
+		if gin {
+			stmts = append(stmts, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (raw)",
+				postgresIndexName(table, "raw_gin"), table))
+		}
+	case string:
+		if gin != "jsonb_ops" && gin != "jsonb_path_ops" {
+			return nil, fmt.Errorf("unknown gin operator class %q", gin)
+		}
+		stmts = append(stmts, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (raw %s)",
+			postgresIndexName(table, "raw_gin"), table, gin))
+	}
+	return
+}
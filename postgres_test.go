@@ -0,0 +1,473 @@
+package gostore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPostgresTransaction(t *testing.T) {
+	Convey("Given postgres errors", t, func() {
+		Convey("Serialization failures and deadlocks can be retried", func() {
+			So(IsSerializationFailure(&pq.Error{Code: "40001"}), ShouldBeTrue)
+			So(IsSerializationFailure(&pq.Error{Code: "40P01"}), ShouldBeTrue)
+			So(IsSerializationFailure(&pq.Error{Code: "23505"}), ShouldBeFalse)
+			So(isUniqueViolation(&pq.Error{Code: "23505"}), ShouldBeTrue)
+			So(IsSerializationFailure(errors.New("40001")), ShouldBeFalse)
+		})
+	})
+	Convey("Given a postgres store", t, func() {
+		store := PostgresObjectStore{}.WithIsolation(sql.LevelSerializable)
+		So(store.isolation, ShouldEqual, sql.LevelSerializable)
+		Convey("Transactions of other stores are rejected", func() {
+			var dst map[string]interface{}
+			So(store.GetTX("1", "things", &dst, &BoltTransaction{}), ShouldEqual, ErrInvalidTransaction)
+			So(store.FinishTransaction(nil), ShouldEqual, ErrInvalidTransaction)
+		})
+		Convey("A finished transaction cannot be used", func() {
+			txn := &PostgresTransaction{}
+			So(store.SaveTX("1", "things", map[string]interface{}{}, txn), ShouldEqual, sql.ErrTxDone)
+			So(txn.Commit(), ShouldEqual, sql.ErrTxDone)
+			txn.Discard()
+		})
+	})
+}
+
+func TestCompilePostgresFilter(t *testing.T) {
+	Convey("Given filters", t, func() {
+		Convey("String alternatives compare the text of a nested field", func() {
+			where, args, err := compilePostgresFilter(map[string]interface{}{"food.type": "=egg|fish"})
+			So(err, ShouldBeNil)
+			So(where, ShouldEqual, `((((raw #>> E'{"food","type"}') = ? AND jsonb_typeof(raw #> E'{"food","type"}') = 'string')`+
+				` OR ((raw #>> E'{"food","type"}') = ? AND jsonb_typeof(raw #> E'{"food","type"}') = 'string')))`)
+			So(args, ShouldResemble, []interface{}{"egg", "fish"})
+		})
+		Convey("Regex conditions only match strings", func() {
+			where, args, err := compilePostgresFilter(map[string]interface{}{"name": "~^First"})
+			So(err, ShouldBeNil)
+			So(where, ShouldEqual, "(((jsonb_typeof(raw -> E'name') = 'string' AND (raw ->> E'name') ~ ?)))")
+			So(args, ShouldResemble, []interface{}{"^First"})
+		})
+		Convey("Numbers and dates are compared behind type guards", func() {
+			where, args, err := compilePostgresFilter(map[string]interface{}{"rating": ">4"})
+			So(err, ShouldBeNil)
+			So(where, ShouldStartWith, "((CASE WHEN jsonb_typeof(raw -> E'rating') = 'number' THEN (raw ->> E'rating')::numeric > ?")
+			So(where, ShouldEndWith, `ELSE (raw ->> E'rating') COLLATE "C" > ? END) END))`)
+			So(args, ShouldResemble, []interface{}{4.0, 4.0, "4"})
+			where, args, err = compilePostgresFilter(map[string]interface{}{"created": "<2018-01-01T00:00:00Z|dt"})
+			So(err, ShouldBeNil)
+			So(where, ShouldContainSubstring, "to_timestamp((raw ->> E'created')::double precision) < ?")
+			So(where, ShouldContainSubstring, "(raw ->> E'created')::timestamptz < ? END) END)")
+			So(args[0], ShouldHaveSameTypeAs, time.Time{})
+		})
+		Convey("Or groups, exists checks and literal values compile", func() {
+			where, args, err := compilePostgresFilter(map[string]interface{}{
+				"or":     map[string]interface{}{"kind": "thing", "rating": 5},
+				"active": true,
+				"photo":  "",
+			})
+			So(err, ShouldBeNil)
+			So(where, ShouldEqual, "(((raw -> E'active') = to_jsonb(?::boolean))"+
+				" AND ((((raw ->> E'kind') = ? AND jsonb_typeof(raw -> E'kind') = 'string')) OR ((raw -> E'rating') = to_jsonb(?::numeric)))"+
+				" AND ((raw -> E'photo') NOT IN ('null'::jsonb, 'false'::jsonb)))")
+			So(args, ShouldResemble, []interface{}{true, "thing", 5.0})
+		})
+		Convey("Field names are quoted and ones gorm would mistake for parameters are passed as parameters", func() {
+			where, args, err := compilePostgresFilter(map[string]interface{}{"it's": "a", "what?": "b"})
+			So(err, ShouldBeNil)
+			So(where, ShouldContainSubstring, "(raw ->> E'it''s') = ?")
+			So(where, ShouldContainSubstring, "(raw #>> ?::text[]) = ?")
+			So(strings.Count(where, "?"), ShouldEqual, len(args))
+			So(args, ShouldContain, pq.Array([]string{"what?"}))
+		})
+		Convey("Hostile field names stay inside their literal", func() {
+			where, _, err := compilePostgresFilter(map[string]interface{}{`x\' OR 1=1 --`: "a"})
+			So(err, ShouldBeNil)
+			So(where, ShouldContainSubstring, `(raw ->> E'x\\'' OR 1=1 --') = ?`)
+			where, _, err = compilePostgresFilter(map[string]interface{}{`a\'.b"`: "a"})
+			So(err, ShouldBeNil)
+			So(where, ShouldContainSubstring, `(raw #>> E'{"a\\\\''","b\\""}') = ?`)
+			stmts, err := postgresIndexStatements("things", map[string]interface{}{"index": map[string][]string{`x\'); DROP TABLE things; --`: nil}})
+			So(err, ShouldBeNil)
+			So(stmts[0], ShouldEndWith, ` ON things ((raw ->> E'x\\''); DROP TABLE things; --'))`)
+		})
+		Convey("An empty filter matches every row", func() {
+			where, args, err := compilePostgresFilter(nil)
+			So(err, ShouldBeNil)
+			So(where, ShouldEqual, "TRUE")
+			So(args, ShouldBeEmpty)
+		})
+		Convey("Invalid filters are rejected", func() {
+			_, _, err := compilePostgresFilter(map[string]interface{}{"rating": ">"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPostgresIndexStatements(t *testing.T) {
+	Convey("Given a CreateTable schema", t, func() {
+		Convey("Single, nested and compound indexes become expression indexes", func() {
+			stmts, err := postgresIndexStatements("things", map[string]interface{}{
+				"index": map[string]interface{}{
+					"kind":      nil,
+					"food_type": []interface{}{"food.type"},
+					"kind_name": []interface{}{"kind", "name"},
+				},
+			})
+			So(err, ShouldBeNil)
+			So(stmts, ShouldResemble, []string{
+				`CREATE INDEX IF NOT EXISTS "things_food_type_idx" ON things ((raw #>> E'{"food","type"}'))`,
+				`CREATE INDEX IF NOT EXISTS "things_kind_idx" ON things ((raw ->> E'kind'))`,
+				`CREATE INDEX IF NOT EXISTS "things_kind_name_idx" ON things ((raw ->> E'kind'), (raw ->> E'name'))`,
+			})
+		})
+		Convey("Index expressions match the compiled filters", func() {
+			stmts, _ := postgresIndexStatements("things", map[string]interface{}{"index": map[string][]string{"kind": nil}})
+			where, _, _ := compilePostgresFilter(map[string]interface{}{"kind": "thing"})
+			So(stmts[0], ShouldContainSubstring, "(raw ->> E'kind')")
+			So(where, ShouldContainSubstring, "(raw ->> E'kind') = ?")
+		})
+		Convey("A gin index can be requested with an operator class", func() {
+			stmts, err := postgresIndexStatements("things", map[string]interface{}{"gin": true})
+			So(err, ShouldBeNil)
+			So(stmts, ShouldResemble, []string{`CREATE INDEX IF NOT EXISTS "things_raw_gin_idx" ON things USING GIN (raw)`})
+			stmts, err = postgresIndexStatements("things", map[string]interface{}{"gin": "jsonb_path_ops"})
+			So(err, ShouldBeNil)
+			So(stmts[0], ShouldEndWith, "USING GIN (raw jsonb_path_ops)")
+			_, err = postgresIndexStatements("things", map[string]interface{}{"gin": "raw); DROP TABLE things; --"})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("No schema creates no index", func() {
+			stmts, err := postgresIndexStatements("things", nil)
+			So(err, ShouldBeNil)
+			So(stmts, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestPostgresWatch(t *testing.T) {
+	Convey("Given a postgres store", t, func() {
+		store := PostgresObjectStore{}
+		Convey("Watching needs a connection string", func() {
+			_, err := store.Watch("things", nil, WatchOptions{})
+			So(err, ShouldEqual, errPostgresNoDSN)
+			So(store.WithDSN("postgres://localhost/test").dsn, ShouldEqual, "postgres://localhost/test")
+		})
+		Convey("Notifications are decoded to changes", func() {
+			c, err := store.notificationChange("user", "_user", `{"op":"UPDATE","id":"1","old":{"kind":"thing"},"new":{"kind":"fish"}}`)
+			So(err, ShouldBeNil)
+			So(c.Type, ShouldEqual, ChangeUpdate)
+			So(c.Table, ShouldEqual, "user")
+			So(c.Key, ShouldEqual, "1")
+			So(string(c.Old), ShouldEqual, `{"kind":"thing"}`)
+			c, err = store.notificationChange("user", "_user", `{"op":"DELETE","id":"1","old":{"kind":"fish"}}`)
+			So(err, ShouldBeNil)
+			So(c.Type, ShouldEqual, ChangeDelete)
+			So(c.New, ShouldBeNil)
+		})
+		Convey("Truncated deletes reach filtered feeds without their old row", func() {
+			expr, err := ParseFilter(map[string]interface{}{"kind": "thing"})
+			So(err, ShouldBeNil)
+			c, err := store.notificationChange("user", "_user", `{"op":"DELETE","id":"1","truncated":true}`)
+			So(err, ShouldBeNil)
+			So(c.Old, ShouldBeNil)
+			So(postgresChangeMatches(expr, c), ShouldBeTrue)
+			c, err = store.notificationChange("user", "_user", `{"op":"DELETE","id":"1","old":{"kind":"fish"}}`)
+			So(err, ShouldBeNil)
+			So(postgresChangeMatches(expr, c), ShouldBeFalse)
+		})
+		Convey("Truncated updates keep their old row and read the new one", func() {
+			store, c := newRecordingStore()
+			change, err := store.notificationChange("user", "_user", `{"op":"UPDATE","id":"1","old":{"kind":"thing"},"truncated":true}`)
+			So(err, ShouldBeNil)
+			So(c.last().SQL, ShouldEqual, `SELECT raw FROM _user WHERE id = $1`)
+			So(string(change.Old), ShouldEqual, `{"kind":"thing"}`)
+			expr, _ := ParseFilter(map[string]interface{}{"kind": "fish"})
+			So(postgresChangeMatches(expr, change), ShouldBeFalse)
+		})
+	})
+}
+
+// recordedStatement is a statement sent to a recordingConnector
+type recordedStatement struct {
+	SQL  string
+	Args []driver.Value
+}
+
+// recordedResult is the result of a query sent to a recordingConnector
+type recordedResult struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+// recordingConnector is a database/sql connector which records the statements it is sent. Queries
+// return the results given to respond in turn, then no rows. Statements affect the numbers of rows
+// given to affect in turn, then none
+type recordingConnector struct {
+	mu         sync.Mutex
+	statements []recordedStatement
+	results    []recordedResult
+	affected   []int64
+}
+
+// newRecordingStore returns a postgres store writing to a recordingConnector
+func newRecordingStore() (PostgresObjectStore, *recordingConnector) {
+	c := &recordingConnector{}
+	db, err := gorm.Open("postgres", sql.OpenDB(c))
+	if err != nil {
+		panic(err)
+	}
+	return PostgresObjectStore{db: db}, c
+}
+
+func (c *recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return recordingConn{c}, nil
+}
+
+func (c *recordingConnector) Driver() driver.Driver {
+	return nil
+}
+
+// respond queues the result of a query
+func (c *recordingConnector) respond(columns []string, rows ...[]driver.Value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results = append(c.results, recordedResult{columns, rows})
+}
+
+// affect queues the number of rows a statement affects
+func (c *recordingConnector) affect(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.affected = append(c.affected, n)
+}
+
+func (c *recordingConnector) record(query string, args []driver.Value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statements = append(c.statements, recordedStatement{strings.Join(strings.Fields(query), " "), args})
+}
+
+// last returns the last statement which was not a transaction boundary
+func (c *recordingConnector) last() recordedStatement {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.statements) - 1; i >= 0; i-- {
+		if stmt := c.statements[i]; stmt.SQL != "BEGIN" && stmt.SQL != "COMMIT" && stmt.SQL != "ROLLBACK" {
+			return stmt
+		}
+	}
+	return recordedStatement{}
+}
+
+type recordingConn struct {
+	c *recordingConnector
+}
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{c.c, query}, nil
+}
+
+func (c recordingConn) Close() error {
+	return nil
+}
+
+func (c recordingConn) Begin() (driver.Tx, error) {
+	c.c.record("BEGIN", nil)
+	return recordingTx{c.c}, nil
+}
+
+type recordingTx struct {
+	c *recordingConnector
+}
+
+func (t recordingTx) Commit() error {
+	t.c.record("COMMIT", nil)
+	return nil
+}
+
+func (t recordingTx) Rollback() error {
+	t.c.record("ROLLBACK", nil)
+	return nil
+}
+
+type recordingStmt struct {
+	c     *recordingConnector
+	query string
+}
+
+func (s recordingStmt) Close() error {
+	return nil
+}
+
+func (s recordingStmt) NumInput() int {
+	return -1
+}
+
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.c.record(s.query, args)
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	if len(s.c.affected) == 0 {
+		return driver.RowsAffected(0), nil
+	}
+	n := s.c.affected[0]
+	s.c.affected = s.c.affected[1:]
+	return driver.RowsAffected(n), nil
+}
+
+func (s recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.c.record(s.query, args)
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	if len(s.c.results) == 0 {
+		return &recordingRows{columns: []string{"raw"}}, nil
+	}
+	result := s.c.results[0]
+	s.c.results = s.c.results[1:]
+	return &recordingRows{result.columns, result.rows}, nil
+}
+
+type recordingRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string {
+	return r.columns
+}
+
+func (r *recordingRows) Close() error {
+	return nil
+}
+
+func (r *recordingRows) Next(dst []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dst, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestPostgresRanges(t *testing.T) {
+	Convey("Given a postgres store", t, func() {
+		store, c := newRecordingStore()
+		Convey("Before excludes the row with id", func() {
+			_, err := store.Before("5", 10, 2, "things")
+			So(err, ShouldBeNil)
+			So(c.last().SQL, ShouldEqual, `SELECT raw FROM "things" WHERE (id < $1) LIMIT 10 OFFSET 2`)
+			So(c.last().Args, ShouldResemble, []driver.Value{"5"})
+			_, err = store.FilterBefore("5", map[string]interface{}{"active": true}, 10, 0, "things", nil)
+			So(err, ShouldBeNil)
+			So(c.last().SQL, ShouldEqual, `SELECT raw FROM "things" WHERE ((((raw -> E'active') = to_jsonb($1::boolean)))) AND (id < $2) LIMIT 10 OFFSET 0`)
+			store.FilterBeforeCount("5", map[string]interface{}{"active": true}, 0, 0, "things", nil)
+			So(c.last().SQL, ShouldEqual, `SELECT count(*) FROM "things" WHERE ((((raw -> E'active') = to_jsonb($1::boolean)))) AND (id < $2)`)
+		})
+		Convey("Since excludes the row with id", func() {
+			_, err := store.Since("5", 0, 0, "things")
+			So(err, ShouldBeNil)
+			So(c.last().SQL, ShouldEqual, `SELECT raw FROM "things" WHERE (id > $1) OFFSET 0`)
+		})
+		Convey("FilterGet reads the newest matching row, in a transaction too", func() {
+			var row map[string]interface{}
+			So(store.FilterGet(map[string]interface{}{"active": true}, "things", &row, nil), ShouldEqual, ErrNotFound)
+			So(c.last().SQL, ShouldEqual, `SELECT raw FROM "things" WHERE ((((raw -> E'active') = to_jsonb($1::boolean)))) ORDER BY id desc LIMIT 1`)
+			txn, err := store.BeginTransaction(nil)
+			So(err, ShouldBeNil)
+			defer txn.Discard()
+			So(store.FilterGetTX(map[string]interface{}{"active": true}, "things", &row, nil, txn), ShouldEqual, ErrNotFound)
+			So(c.last().SQL, ShouldEqual, `SELECT raw FROM "things" WHERE ((((raw -> E'active') = to_jsonb($1::boolean)))) ORDER BY id desc LIMIT 1`)
+		})
+	})
+}
+
+func TestPostgresQuery(t *testing.T) {
+	Convey("Given a postgres store", t, func() {
+		store, c := newRecordingStore()
+		c.respond([]string{"a", "b", "c", "d", "e", "f"}, []driver.Value{int64(1), int64(4), int64(3), int64(0), int64(4), int64(1)})
+		c.respond([]string{"term", "count"},
+			[]driver.Value{[]byte(`"available"`), int64(3)},
+			[]driver.Value{[]byte(`"busy"`), int64(2)},
+			[]driver.Value{[]byte(`{"a":1}`), int64(1)},
+			[]driver.Value{[]byte(`"off"`), int64(1)},
+		)
+		Convey("Aggregates are counted in SQL over the matching rows", func() {
+			rows, aggs, err := store.Query(map[string]interface{}{"kind": "bike"}, map[string]interface{}{
+				"price":  map[string]interface{}{"numberRange": []interface{}{map[string]interface{}{"name": "cheap", "to": 10}}},
+				"status": map[string]interface{}{"match": "=available", "top": 2},
+			}, 10, 0, "riders", nil)
+			So(err, ShouldBeNil)
+			So(rowsToArray(rows), ShouldBeEmpty)
+			cheap := 10.0
+			So(aggs["price"], ShouldResemble, Match{Field: "price", Missing: 1, Matched: 4,
+				NumberRange: []NumberRangeCount{{Name: "cheap", To: &cheap, Count: 3}}})
+			So(aggs["status"], ShouldResemble, Match{Field: "status", Missing: 0, Matched: 4, UnMatched: 1, Other: 2,
+				Top: []TermCount{{Term: "available", Count: 3}, {Term: "busy", Count: 2}}})
+			So(c.statements[0].SQL, ShouldStartWith, `SELECT count(*) FILTER (WHERE (COALESCE(jsonb_typeof(raw -> E'price'), 'null') = 'null')), `)
+			So(c.statements[0].SQL, ShouldEndWith, `FROM "riders" WHERE ((((raw ->> E'kind') = $4 AND jsonb_typeof(raw -> E'kind') = 'string')))`)
+			So(c.statements[0].Args, ShouldResemble, []driver.Value{10.0, "available", "available", "bike"})
+			So(c.statements[1].SQL, ShouldStartWith, `SELECT term, count(*) FROM "riders", jsonb_array_elements(CASE WHEN jsonb_typeof(raw -> E'status') = 'array'`)
+			So(c.statements[1].SQL, ShouldEndWith, `GROUP BY term ORDER BY count(*) DESC, term`)
+			So(c.last().SQL, ShouldEqual, `SELECT raw FROM "riders" WHERE (((((raw ->> E'kind') = $1 AND jsonb_typeof(raw -> E'kind') = 'string')))) LIMIT 10 OFFSET 0`)
+		})
+	})
+}
+
+func TestPostgresUpdate(t *testing.T) {
+	Convey("Given a postgres store", t, func() {
+		store, c := newRecordingStore()
+		Convey("Update merges into the stored row", func() {
+			c.affect(1)
+			So(store.Update("1", "things", map[string]interface{}{"name": "Updated"}), ShouldBeNil)
+			So(c.last().SQL, ShouldEqual, `UPDATE "things" SET "raw" = raw || $1::jsonb WHERE (id = $2)`)
+			So(c.last().Args, ShouldResemble, []driver.Value{`{"name":"Updated"}`, "1"})
+		})
+		Convey("Replace overwrites the stored row", func() {
+			c.affect(1)
+			So(store.Replace("1", "things", map[string]interface{}{"name": "Replaced"}), ShouldBeNil)
+			So(c.last().SQL, ShouldEqual, `UPDATE "things" SET "raw" = $1 WHERE (id = $2)`)
+		})
+		Convey("A missing key is not found", func() {
+			So(store.Update("missing", "things", map[string]interface{}{"name": "Updated"}), ShouldEqual, ErrNotFound)
+			So(store.Replace("missing", "things", map[string]interface{}{"name": "Replaced"}), ShouldEqual, ErrNotFound)
+		})
+		Convey("Values which cannot be encoded fail", func() {
+			So(store.Update("1", "things", map[string]interface{}{"ch": make(chan int)}), ShouldNotBeNil)
+			So(store.Replace("1", "things", func() {}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPostgresBatchUpdate(t *testing.T) {
+	Convey("Given a postgres store", t, func() {
+		store, c := newRecordingStore()
+		c.respond([]string{"id", "raw"}, []driver.Value{"1", []byte(`{"id":"1","name":"First"}`)})
+		Convey("A key given twice sees its first update", func() {
+			result, err := store.BatchUpdateResult([]interface{}{"1", "1"}, []interface{}{
+				map[string]interface{}{"name": "Updated First"},
+				map[string]interface{}{"name": "Updated Again"},
+			}, "things", nil)
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, WriteResult{Matched: 1, Updated: 1})
+			var updates []recordedStatement
+			for _, stmt := range c.statements {
+				if strings.HasPrefix(stmt.SQL, "UPDATE") {
+					updates = append(updates, stmt)
+				}
+			}
+			So(updates, ShouldHaveLength, 1)
+			So(updates[0].Args[0], ShouldContainSubstring, "Updated First")
+		})
+	})
+}
@@ -0,0 +1,247 @@
+package gostore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// postgresTxRetries is the number of times RunTransaction restarts a transaction which failed to serialize
+const postgresTxRetries = 5
+
+// PostgresTransaction is a Transaction on a sql.Tx. Rows read and written through the TX methods
+// of PostgresObjectStore see the writes of the transaction, which are applied on Commit
+type PostgresTransaction struct {
+	db   *gorm.DB
+	tx   *gorm.DB
+	opts *sql.TxOptions
+}
+
+// WithIsolation returns a copy of the store whose transactions run at the given isolation level
+func (s PostgresObjectStore) WithIsolation(level sql.IsolationLevel) PostgresObjectStore {
+	s.isolation = level
+	return s
+}
+
+// BeginTransaction starts a transaction, a nil opts uses the isolation level of the store
+func (s PostgresObjectStore) BeginTransaction(opts *sql.TxOptions) (*PostgresTransaction, error) {
+	if opts == nil {
+		opts = &sql.TxOptions{Isolation: s.isolation}
+	}
+	t := &PostgresTransaction{db: s.db, opts: opts}
+	if err := t.begin(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *PostgresTransaction) begin() error {
+	tx := t.db.BeginTx(context.Background(), t.opts)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	t.tx = tx
+	return nil
+}
+
+// Restart rolls the transaction back and starts a new one with the same options, it is how
+// a transaction which failed to serialize is retried
+func (t *PostgresTransaction) Restart() error {
+	t.Discard()
+	return t.begin()
+}
+
+// Commit applies the transaction
+func (t *PostgresTransaction) Commit() error {
+	if t.tx == nil {
+		return sql.ErrTxDone
+	}
+	tx := t.tx
+	t.tx = nil
+	return tx.Commit().Error
+}
+
+// Discard rolls the transaction back, it is safe to call after Commit
+func (t *PostgresTransaction) Discard() {
+	if t.tx != nil {
+		t.tx.Rollback()
+		t.tx = nil
+	}
+}
+
+// Set is not supported, postgres rows belong to a table
+func (t *PostgresTransaction) Set(key, value []byte) error {
+	return ErrNotImplemented
+}
+
+// Get is not supported, postgres rows belong to a table
+func (t *PostgresTransaction) Get(key []byte) ([]byte, error) {
+	return nil, ErrNotImplemented
+}
+
+// Delete is not supported, postgres rows belong to a table
+func (t *PostgresTransaction) Delete(key []byte) error {
+	return ErrNotImplemented
+}
+
+// IsSerializationFailure reports whether err aborted a transaction which can be restarted,
+// either a serialization failure or a deadlock
+func IsSerializationFailure(err error) bool {
+	if pqErr, ok := err.(*pq.Error); ok {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
+
+// isUniqueViolation reports whether err was caused by a duplicate key
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+// postgresTx returns the open gorm transaction of txn
+func postgresTx(txn Transaction) (*gorm.DB, error) {
+	t, ok := txn.(*PostgresTransaction)
+	if !ok || t == nil {
+		return nil, ErrInvalidTransaction
+	}
+	if t.tx == nil {
+		return nil, sql.ErrTxDone
+	}
+	return t.tx, nil
+}
+
+// RunTransaction runs fn in a transaction and commits it. The transaction is rolled back when fn
+// fails and restarted, running fn again, when it fails to serialize
+func (s PostgresObjectStore) RunTransaction(fn func(txn Transaction) error) error {
+	t, err := s.BeginTransaction(nil)
+	if err != nil {
+		return err
+	}
+	defer t.Discard()
+	for attempt := 1; ; attempt++ {
+		err = fn(t)
+		if err == nil {
+			err = t.Commit()
+		}
+		if err == nil || !IsSerializationFailure(err) || attempt == postgresTxRetries {
+			return err
+		}
+		logger.Debug("restarting transaction", "attempt", attempt, "err", err)
+		if err = t.Restart(); err != nil {
+			return err
+		}
+	}
+}
+
+// UpdateTransaction starts a transaction at the isolation level of the store, it returns nil if
+// one cannot be started
+func (s PostgresObjectStore) UpdateTransaction() Transaction {
+	t, err := s.BeginTransaction(nil)
+	if err != nil {
+		logger.Warn("cannot start postgres transaction", "err", err)
+		return nil
+	}
+	return t
+}
+
+// FinishTransaction commits a transaction, it is rolled back if the commit fails
+func (s PostgresObjectStore) FinishTransaction(txn Transaction) error {
+	if _, err := postgresTx(txn); err != nil {
+		return err
+	}
+	err := txn.Commit()
+	if err != nil {
+		txn.Discard()
+	}
+	return err
+}
+
+func (s PostgresObjectStore) GetTX(key string, store string, dst interface{}, txn Transaction) error {
+	tx, err := postgresTx(txn)
+	if err != nil {
+		return err
+	}
+	var row []byte
+	err = tx.Table(safeStoreName(store)).Select("raw").Where("id = ?", key).Row().Scan(&row)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(row, dst)
+}
+
+// SaveTX inserts a row or replaces the row with the same key in the transaction
+func (s PostgresObjectStore) SaveTX(key string, store string, src interface{}, txn Transaction) error {
+	tx, err := postgresTx(txn)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return tx.Exec(fmt.Sprintf(`INSERT INTO %s (id, raw) VALUES (?, ?)
+                ON CONFLICT (id) DO UPDATE SET raw = EXCLUDED.raw`, safeStoreName(store)), key, string(data)).Error
+}
+
+func (s PostgresObjectStore) DeleteTX(key string, store string, txn Transaction) error {
+	tx, err := postgresTx(txn)
+	if err != nil {
+		return err
+	}
+	return tx.Table(safeStoreName(store)).Where("id = ?", key).Delete(&Storage{}).Error
+}
+
+func (s PostgresObjectStore) FilterGetTX(filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions, txn Transaction) error {
+	tx, err := postgresTx(txn)
+	if err != nil {
+		return err
+	}
+	query, err := s.filterQuery(tx, store, filter)
+	if err != nil {
+		return err
+	}
+	var row []byte
+	err = query.Select("raw").Order("id desc").Limit(1).Row().Scan(&row)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(row, dst)
+}
+
+// BatchInsertTX inserts rows in the transaction. A row is keyed by its id field, rows without
+// one get a new ObjectId
+func (s PostgresObjectStore) BatchInsertTX(data []interface{}, store string, opts ObjectStoreOptions, txn Transaction) (keys []string, err error) {
+	tx, err := postgresTx(txn)
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range data {
+		doc, err := toDoc(src)
+		if err != nil {
+			return nil, err
+		}
+		id, ok := doc["id"].(string)
+		if !ok || id == "" {
+			id = NewObjectId().Hex()
+		}
+		raw, err := json.Marshal(src)
+		if err != nil {
+			return nil, err
+		}
+		item := Storage{id, string(raw)}
+		if err = tx.Table(safeStoreName(store)).Create(&item).Error; err != nil {
+			return nil, err
+		}
+		keys = append(keys, id)
+	}
+	return keys, nil
+}
@@ -0,0 +1,162 @@
+package gostore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// errPostgresNoDSN is returned by Watch on a store which does not know how to open a connection
+var errPostgresNoDSN = errors.New("gostore: watching a postgres store needs its connection string, see WithDSN")
+
+// postgresNotifyFunction notifies the channel named by the first argument of its trigger of the
+// writes to a table. A notification is limited to 8000 bytes, the rows of a change which does not
+// fit are left out and the listener reads the new row itself. An update keeps its old row when it
+// fits alone, an oversized delete is sent without it
+const postgresNotifyFunction = `CREATE OR REPLACE FUNCTION gostore_notify() RETURNS trigger AS $$
+DECLARE
+	row_id TEXT;
+	payload TEXT;
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		row_id := NEW.id;
+		payload := json_build_object('op', TG_OP, 'id', row_id, 'new', NEW.raw)::TEXT;
+	ELSIF TG_OP = 'UPDATE' THEN
+		row_id := NEW.id;
+		payload := json_build_object('op', TG_OP, 'id', row_id, 'old', OLD.raw, 'new', NEW.raw)::TEXT;
+	ELSE
+		row_id := OLD.id;
+		payload := json_build_object('op', TG_OP, 'id', row_id, 'old', OLD.raw)::TEXT;
+	END IF;
+	IF octet_length(payload) > 7900 AND TG_OP = 'UPDATE' THEN
+		payload := json_build_object('op', TG_OP, 'id', row_id, 'old', OLD.raw, 'truncated', TRUE)::TEXT;
+	END IF;
+	IF octet_length(payload) > 7900 THEN
+		payload := json_build_object('op', TG_OP, 'id', row_id, 'truncated', TRUE)::TEXT;
+	END IF;
+	PERFORM pg_notify(TG_ARGV[0], payload);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql`
+
+// postgresNotification is the payload sent by gostore_notify
+type postgresNotification struct {
+	Op        string          `json:"op"`
+	ID        string          `json:"id"`
+	Old       json.RawMessage `json:"old"`
+	New       json.RawMessage `json:"new"`
+	Truncated bool            `json:"truncated"`
+}
+
+// WithDSN returns a copy of the store which opens its change feed listeners with dsn, stores opened
+// with Open know their connection string already
+func (s PostgresObjectStore) WithDSN(dsn string) PostgresObjectStore {
+	s.dsn = dsn
+	return s
+}
+
+// postgresNotifyChannel names the channel a table is watched on
+func postgresNotifyChannel(table string) string {
+	return "gostore_" + table
+}
+
+// ensureNotifyTrigger installs the trigger which notifies the watchers of a table
+func (s PostgresObjectStore) ensureNotifyTrigger(table string) error {
+	if err := s.db.Exec(postgresNotifyFunction).Error; err != nil {
+		return err
+	}
+	var n int
+	if err := s.db.Raw("SELECT count(*) FROM pg_trigger WHERE tgname = 'gostore_notify' AND tgrelid = ?::regclass", table).Row().Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	return s.db.Exec(fmt.Sprintf("CREATE TRIGGER gostore_notify AFTER INSERT OR UPDATE OR DELETE ON %s FOR EACH ROW EXECUTE PROCEDURE gostore_notify(%s)",
+		table, pq.QuoteLiteral(postgresNotifyChannel(table)))).Error
+}
+
+// Watch streams the changes of a table with LISTEN/NOTIFY, which sees the writes of every client of
+// the database. The first Watch of a table installs a trigger on it. Changes made while the
+// listener reconnects after losing its connection are missed, and filters are applied by the
+// listener. The old row of an update or delete too large for a notification may be missing, Old
+// is then nil and the change is delivered whatever the filter, since the listener cannot tell
+// whether the row matched
+func (s PostgresObjectStore) Watch(store string, filter map[string]interface{}, opts WatchOptions) (ChangeFeed, error) {
+	if s.dsn == "" {
+		return nil, errPostgresNoDSN
+	}
+	expr, err := ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	table := safeStoreName(store)
+	if err = s.CreateTable(store, nil); err != nil {
+		return nil, err
+	}
+	if err = s.ensureNotifyTrigger(table); err != nil {
+		return nil, err
+	}
+	listener := pq.NewListener(s.dsn, 100*time.Millisecond, 10*time.Second, nil)
+	if err = listener.Listen(postgresNotifyChannel(table)); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return newStreamFeed(opts, func() { listener.Close() }, func(emit func(Change) bool) error {
+		defer listener.Close()
+		for n := range listener.Notify {
+			if n == nil {
+				//the listener reconnected
+				continue
+			}
+			c, err := s.notificationChange(store, table, n.Extra)
+			if err != nil {
+				return err
+			}
+			if postgresChangeMatches(expr, c) && !emit(c) {
+				return nil
+			}
+		}
+		return nil
+	}), nil
+}
+
+// postgresChangeMatches reports whether a change matches expr, an update or delete whose old row
+// was left out of its notification matches any filter
+func postgresChangeMatches(expr *FilterGroup, c Change) bool {
+	if c.Type != ChangeInsert && c.Old == nil {
+		return true
+	}
+	return changeMatches(expr, c)
+}
+
+// notificationChange decodes a notification, reading the new row of a truncated one
+func (s PostgresObjectStore) notificationChange(store, table, payload string) (c Change, err error) {
+	var n postgresNotification
+	if err = json.Unmarshal([]byte(payload), &n); err != nil {
+		return
+	}
+	c = Change{Table: store, Key: n.ID, Old: n.Old, New: n.New}
+	switch n.Op {
+	case "INSERT":
+		c.Type = ChangeInsert
+	case "UPDATE":
+		c.Type = ChangeUpdate
+	default:
+		c.Type = ChangeDelete
+	}
+	if n.Truncated && c.Type != ChangeDelete {
+		var raw []byte
+		err = s.db.Raw(fmt.Sprintf("SELECT raw FROM %s WHERE id = ?", table), n.ID).Row().Scan(&raw)
+		if err == nil {
+			c.New = raw
+		} else if err == sql.ErrNoRows {
+			err = nil
+		}
+	}
+	return
+}
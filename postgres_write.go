@@ -0,0 +1,215 @@
+package gostore
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+// FilterUpdateResult updates the rows matching filter like FilterUpdate and reports the write. The
+// rows are locked and rewritten in a transaction, a dry run rolls it back
+func (s PostgresObjectStore) FilterUpdateResult(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions, wopts WriteOptions) (result WriteResult, err error) {
+	update, err := updater(src)
+	if err != nil {
+		return
+	}
+	err = s.write(func(tx *gorm.DB) error {
+		query, err := s.filterQuery(tx, store, filter)
+		if err != nil {
+			return err
+		}
+		items, err := lockRows(query)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if _, err = rewriteRow(tx, store, item, update, wopts.DryRun, &result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, wopts.DryRun)
+	return
+}
+
+// FilterDeleteResult removes the rows matching filter and reports how many it deleted
+func (s PostgresObjectStore) FilterDeleteResult(filter map[string]interface{}, store string, opts ObjectStoreOptions) (result WriteResult, err error) {
+	query, err := s.filterQuery(s.db, store, filter)
+	if err != nil {
+		return
+	}
+	deleted := query.Delete(&Storage{})
+	if deleted.Error != nil {
+		return result, deleted.Error
+	}
+	result.Matched = int(deleted.RowsAffected)
+	result.Deleted = result.Matched
+	return
+}
+
+// BatchFilterDeleteResult removes rows matching any of the filters in a transaction and reports how
+// many it deleted
+func (s PostgresObjectStore) BatchFilterDeleteResult(filter []map[string]interface{}, store string, opts ObjectStoreOptions) (result WriteResult, err error) {
+	err = s.write(func(tx *gorm.DB) error {
+		ts := s
+		ts.db = tx
+		for _, f := range filter {
+			deleted, err := ts.FilterDeleteResult(f, store, opts)
+			result.add(deleted)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, false)
+	return
+}
+
+// BatchDeleteResult removes rows by key, keys which do not exist are skipped
+func (s PostgresObjectStore) BatchDeleteResult(ids []interface{}, store string, opts ObjectStoreOptions) (result WriteResult, err error) {
+	var keys []string
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		key, err := batchKey(id)
+		switch {
+		case err != nil:
+			result.fail(fmt.Sprint(id), err)
+		case !seen[key]:
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	deleted := s.db.Table(safeStoreName(store)).Where("id IN (?)", keys).Delete(&Storage{})
+	if deleted.Error != nil {
+		return result, deleted.Error
+	}
+	result.Matched = int(deleted.RowsAffected)
+	result.Deleted = result.Matched
+	result.Skipped = len(keys) - result.Matched
+	return
+}
+
+// BatchUpdateResult merges data[i] into the row with ids[i] in a transaction, the keys which have no
+// row fail with ErrNotFound while the other rows are updated
+func (s PostgresObjectStore) BatchUpdateResult(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	return s.batchUpdate(ids, data, store, false)
+}
+
+// batchUpdate merges data into rows by key, when strict nothing is updated unless every row exists
+func (s PostgresObjectStore) batchUpdate(ids []interface{}, data []interface{}, store string, strict bool) (result WriteResult, err error) {
+	if len(ids) != len(data) {
+		return result, fmt.Errorf("gostore: %d ids and %d documents to update", len(ids), len(data))
+	}
+	updates := make([]func(doc map[string]interface{}) map[string]interface{}, len(data))
+	for i, d := range data {
+		if updates[i], err = updater(d); err != nil {
+			return
+		}
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		if keys[i], err = batchKey(id); err != nil {
+			if strict {
+				return
+			}
+			result.fail(fmt.Sprint(id), err)
+			err = nil
+		}
+	}
+	err = s.write(func(tx *gorm.DB) error {
+		items, err := lockRows(tx.Table(safeStoreName(store)).Where("id IN (?)", keys))
+		if err != nil {
+			return err
+		}
+		rows := make(map[string]Storage, len(items))
+		for _, item := range items {
+			rows[item.Id] = item
+		}
+		seen := make(map[string]bool, len(keys))
+		for i, key := range keys {
+			if key == "" || seen[key] {
+				//an invalid key already failed, a key given twice sees its first update
+				continue
+			}
+			seen[key] = true
+			item, ok := rows[key]
+			if !ok {
+				if strict {
+					return ErrNotFound
+				}
+				result.fail(key, ErrNotFound)
+				continue
+			}
+			if _, err = rewriteRow(tx, store, item, updates[i], false, &result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, false)
+	return
+}
+
+// write calls fn in a transaction unless the store already runs in one, the transaction is rolled
+// back when fn fails or discard is set
+func (s PostgresObjectStore) write(fn func(tx *gorm.DB) error, discard bool) error {
+	tx, owned := s.begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if owned {
+		defer tx.RollbackUnlessCommitted()
+	}
+	if err := fn(tx); err != nil || discard || !owned {
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// lockRows reads the rows of a query, locking them until the transaction ends
+func lockRows(query *gorm.DB) (items []Storage, err error) {
+	rows, err := query.Select("id, raw").Set("gorm:query_option", "FOR UPDATE").Rows()
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item Storage
+		if err = rows.Scan(&item.Id, &item.Raw); err != nil {
+			return
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// rewriteRow stores the document change returns for a row when it differs from the row and returns
+// the row as it is now, a dry run only counts it
+func rewriteRow(tx *gorm.DB, store string, item Storage, change func(doc map[string]interface{}) map[string]interface{}, dryRun bool, result *WriteResult) (Storage, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(item.Raw), &doc); err != nil {
+		return item, err
+	}
+	result.Matched++
+	doc, changed, err := changeDoc(doc, change)
+	if err != nil {
+		return item, err
+	}
+	if !changed {
+		result.Unchanged++
+		return item, nil
+	}
+	result.Updated++
+	if dryRun {
+		return item, nil
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return item, err
+	}
+	item.Raw = string(data)
+	return item, tx.Table(safeStoreName(store)).Where("id = ?", item.Id).Updates(map[string]interface{}{"raw": item.Raw}).Error
+}
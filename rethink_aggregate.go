@@ -0,0 +1,156 @@
+package gostore
+
+import (
+	r "github.com/gorethink/gorethink"
+)
+
+// rethinkAggregateCounts are the counts of an aggregate computed by rethinkdb
+type rethinkAggregateCounts struct {
+	Missing int                `gorethink:"missing"`
+	Present int                `gorethink:"present"`
+	Matched int                `gorethink:"matched"`
+	Numbers []int              `gorethink:"numbers"`
+	Dates   []int              `gorethink:"dates"`
+	Terms   int                `gorethink:"terms"`
+	Top     []rethinkTermCount `gorethink:"top"`
+}
+
+// rethinkTermCount is a group of an ungrouped count
+type rethinkTermCount struct {
+	Group     interface{} `gorethink:"group"`
+	Reduction int         `gorethink:"reduction"`
+}
+
+// aggregate counts the rows of a term into the aggregates of a Query. Every count is computed by
+// rethinkdb in a single query, the top terms of an aggregate are grouped and limited there too
+func (s RethinkStore) aggregate(rows r.Term, agg *Aggregator) error {
+	if len(agg.aggs) == 0 {
+		return nil
+	}
+	terms := make([]interface{}, len(agg.aggs))
+	for i, a := range agg.aggs {
+		terms[i] = rethinkAggregateTerm(rows, a)
+	}
+	result, err := r.Expr(terms).Run(s.Session)
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+	var counts []rethinkAggregateCounts
+	if err = result.One(&counts); err != nil {
+		return err
+	}
+	for i, a := range agg.aggs {
+		counts[i].apply(a)
+	}
+	return nil
+}
+
+// rethinkAggregateTerm builds the counts of an aggregate over rows, like aggregation.add
+func rethinkAggregateTerm(rows r.Term, a *aggregation) map[string]interface{} {
+	val := r.Row
+	for _, p := range a.field {
+		val = val.Field(p)
+	}
+	//lookupField treats a missing field like null
+	val = val.Default(nil)
+	present := rows.Filter(val.Ne(nil))
+	counts := map[string]interface{}{
+		"missing": rows.Filter(val.Eq(nil)).Count(),
+		"present": present.Count(),
+	}
+	if a.match != nil {
+		counts["matched"] = present.Filter(rethinkCondition(a.match), r.FilterOpts{Default: false}).Count()
+	}
+	if len(a.nums) > 0 {
+		numbers := make([]interface{}, len(a.nums))
+		for i, n := range a.nums {
+			var from, to interface{}
+			if n.From != nil {
+				from = *n.From
+			}
+			if n.To != nil {
+				to = *n.To
+			}
+			numbers[i] = rows.Filter(r.Branch(val.TypeOf().Eq("NUMBER"), rethinkWithin(val, from, to), false)).Count()
+		}
+		counts["numbers"] = numbers
+	}
+	if len(a.dates) > 0 {
+		dates := make([]interface{}, len(a.dates))
+		for i, d := range a.dates {
+			var from, to interface{}
+			if d.From != nil {
+				from = *d.From
+			}
+			if d.To != nil {
+				to = *d.To
+			}
+			dates[i] = rows.Filter(rethinkTimeWithin(val, from, to)).Count()
+		}
+		counts["dates"] = dates
+	}
+	if a.top > 0 {
+		//the elements of an array are counted one by one
+		values := present.ConcatMap(r.Branch(val.TypeOf().Eq("ARRAY"), val, []interface{}{val}))
+		typ := r.Row.TypeOf()
+		counts["terms"] = values.Count()
+		counts["top"] = values.Filter(r.Or(typ.Eq("STRING"), typ.Eq("NUMBER"), typ.Eq("BOOL"))).
+			Group(r.Row).Count().Ungroup().
+			OrderBy(r.Desc("reduction"), r.Asc("group")).Limit(a.top)
+	}
+	return counts
+}
+
+// rethinkWithin is true when a value lies within [from, to), a nil bound is open
+func rethinkWithin(val r.Term, from, to interface{}) r.Term {
+	t := r.Expr(true)
+	if from != nil {
+		t = t.And(val.Ge(from))
+	}
+	if to != nil {
+		t = t.And(val.Lt(to))
+	}
+	return t
+}
+
+// rethinkTimeWithin reads numbers as unix seconds and strings as dates like toTime, other values
+// are not within any range
+func rethinkTimeWithin(val r.Term, from, to interface{}) r.Term {
+	typ := val.TypeOf()
+	return r.Branch(
+		typ.Eq("PTYPE<TIME>"), rethinkWithin(val, from, to),
+		typ.Eq("NUMBER"), rethinkWithin(r.EpochTime(r.Branch(val.Lt(0), val.Ceil(), val.Floor())), from, to),
+		typ.Eq("STRING"), r.Branch(val.Match(rethinkTimePattern), rethinkWithin(r.ISO8601(val), from, to), false),
+		false,
+	)
+}
+
+// apply fills the result of an aggregate from its counts. The terms beyond the top ones and the
+// values which are not strings, numbers or booleans are counted as other
+func (c rethinkAggregateCounts) apply(a *aggregation) {
+	a.result.Missing = c.Missing
+	a.result.Matched = c.Present
+	if a.match != nil {
+		a.result.Matched = c.Matched
+		a.result.UnMatched = c.Present - c.Matched
+	}
+	for i := range a.nums {
+		if i < len(c.Numbers) {
+			a.nums[i].Count = c.Numbers[i]
+		}
+	}
+	for i := range a.dates {
+		if i < len(c.Dates) {
+			a.dates[i].Count = c.Dates[i]
+		}
+	}
+	a.result.Other = c.Terms
+	for _, t := range c.Top {
+		a.result.Other -= t.Reduction
+		b, _ := indexValue(t.Group)
+		key := string(b)
+		a.terms[key] = &TermCount{Term: t.Group, Count: t.Reduction}
+		a.order = append(a.order, key)
+	}
+}
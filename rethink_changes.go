@@ -0,0 +1,274 @@
+package gostore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	r "github.com/gorethink/gorethink"
+)
+
+// RethinkChangesOptions configures a rethinkdb changefeed
+type RethinkChangesOptions struct {
+	// IncludeInitial delivers the rows matching the filter, with the type "initial", before their
+	// changes. A row changed while they are read is retracted with the type "uninitial"
+	IncludeInitial bool
+	// Squash is passed to rethinkdb as is: true merges the changes made to a row between two reads,
+	// a number of seconds gathers the changes for that long before merging them
+	Squash interface{}
+	// IncludeTypes keeps the type of each change: "add", "change", "remove", "initial" or "uninitial"
+	IncludeTypes bool
+	// Resume delivers the changes missed while the feed reconnects. The feed then keeps the last
+	// value of every row it matches in memory, a copy of the whole selection
+	Resume bool
+	// Retry configures the reconnection of a feed whose session was lost
+	Retry RetryOptions
+}
+
+// RethinkChangeRows is a changefeed read as rows. Each row is a document holding the "old_val" and
+// "new_val" of a changed row, and its "type" when asked for. A feed never ends on its own, Next blocks
+// until a change is made or the rows are closed.
+//
+// When the session is lost the rows rerun the feed, the changes made while reconnecting are lost
+// and initial values are delivered again. Rethinkdb cannot resume a changefeed, so with opts.Resume
+// the rows remember the last value they delivered of every row the feed matches, which costs as
+// much memory as the selection itself. They then rerun the feed with its initial values and deliver
+// only the differences, the changes missed while reconnecting, as adds, changes and removes.
+// The feed ends with the error of the last attempt when reconnecting fails within opts.Retry
+type RethinkChangeRows struct {
+	term    r.Term
+	session r.QueryExecutor
+	opts    RethinkChangesOptions
+	retry   RetryStore
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	cursor  *r.Cursor
+	closed  bool
+	err     error
+	rows    map[string]json.RawMessage
+	seen    map[string]bool
+	pending []rethinkChangeRow
+}
+
+// rethinkChangeRow is a row of RethinkChangeRows
+type rethinkChangeRow struct {
+	Type   string          `json:"type,omitempty"`
+	OldVal json.RawMessage `json:"old_val"`
+	NewVal json.RawMessage `json:"new_val"`
+}
+
+// Changes opens a changefeed on the rows of a table matching filter, selected through an index of
+// opts when the filter uses one
+func (s RethinkStore) Changes(store string, filter map[string]interface{}, opts ObjectStoreOptions, copts RethinkChangesOptions) (ObjectRows, error) {
+	term, err := s.selectTerm(store, filter, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	changesOpts := r.ChangesOpts{
+		Squash:        copts.Squash,
+		IncludeStates: true,
+		IncludeTypes:  true,
+	}
+	if copts.IncludeInitial || copts.Resume {
+		changesOpts.IncludeInitial = true
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &RethinkChangeRows{
+		term:    term.Changes(changesOpts),
+		session: s.Session,
+		opts:    copts,
+		retry:   NewRetryStore(s, copts.Retry),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	if copts.Resume {
+		c.rows = make(map[string]json.RawMessage)
+	}
+	cursor, err := c.term.Run(c.session, r.RunOpts{Context: ctx})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	c.cursor = cursor
+	return c, nil
+}
+
+func (c *RethinkChangeRows) LastError() error {
+	return c.err
+}
+
+func (c *RethinkChangeRows) Next(dst interface{}) (bool, error) {
+	raw, ok := c.NextRaw()
+	if !ok {
+		return false, c.err
+	}
+	return true, json.Unmarshal(raw, dst)
+}
+
+func (c *RethinkChangeRows) NextRaw() ([]byte, bool) {
+	for {
+		if len(c.pending) > 0 {
+			row := c.pending[0]
+			c.pending = c.pending[1:]
+			return c.encode(row)
+		}
+		c.mu.Lock()
+		cursor, closed := c.cursor, c.closed
+		c.mu.Unlock()
+		if closed || c.err != nil {
+			return nil, false
+		}
+		var doc rethinkChange
+		if cursor.Next(&doc) {
+			row, ok, err := c.apply(doc)
+			if err != nil {
+				c.err = err
+				return nil, false
+			}
+			if ok {
+				return c.encode(row)
+			}
+			continue
+		}
+		if c.ctx.Err() != nil {
+			return nil, false
+		}
+		err := cursor.Err()
+		if err == nil {
+			//a changefeed only ends when its connection does
+			err = io.EOF
+		}
+		if !c.retry.retryable(err) {
+			c.err = err
+			return nil, false
+		}
+		if c.err = c.reconnect(err); c.err != nil {
+			return nil, false
+		}
+	}
+}
+
+func (c *RethinkChangeRows) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.cancel()
+	c.cursor.Close()
+}
+
+// encode marshals a row, a failure ends the rows
+func (c *RethinkChangeRows) encode(row rethinkChangeRow) ([]byte, bool) {
+	if !c.opts.IncludeTypes {
+		row.Type = ""
+	}
+	raw, err := json.Marshal(row)
+	if err != nil {
+		c.err = err
+		return nil, false
+	}
+	return raw, true
+}
+
+// reconnect reruns the feed after its session was lost, when resuming the rows it resends are
+// compared with the ones delivered until the feed is ready
+func (c *RethinkChangeRows) reconnect(cause error) error {
+	logger.Warn("rethink changefeed lost, reconnecting", "err", cause)
+	c.mu.Lock()
+	c.cursor.Close()
+	c.mu.Unlock()
+	err := c.retry.retry(c.ctx, "Changes", func(ctx context.Context) error {
+		cursor, err := c.term.Run(c.session, r.RunOpts{Context: ctx})
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.closed {
+			cursor.Close()
+			return context.Canceled
+		}
+		c.cursor = cursor
+		return nil
+	})
+	if err != nil {
+		if c.ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	if c.opts.Resume {
+		c.seen = make(map[string]bool)
+	}
+	return nil
+}
+
+// apply records a document of the feed when resuming, ok is false when it is not delivered: a state,
+// an initial value which was not asked for or, after reconnecting, a row which was already delivered
+func (c *RethinkChangeRows) apply(doc rethinkChange) (row rethinkChangeRow, ok bool, err error) {
+	if doc.Type == "state" {
+		if doc.State == "ready" && c.seen != nil {
+			for key, old := range c.rows {
+				if !c.seen[key] {
+					delete(c.rows, key)
+					c.pending = append(c.pending, rethinkChangeRow{Type: "remove", OldVal: old})
+				}
+			}
+			c.seen = nil
+		}
+		return
+	}
+	row.Type = doc.Type
+	var key interface{}
+	if doc.OldVal != nil {
+		if row.OldVal, err = json.Marshal(doc.OldVal); err != nil {
+			return
+		}
+		key = doc.OldVal["id"]
+	}
+	if doc.NewVal != nil {
+		if row.NewVal, err = json.Marshal(doc.NewVal); err != nil {
+			return
+		}
+		key = doc.NewVal["id"]
+	}
+	if !c.opts.Resume {
+		return row, true, nil
+	}
+	id := fmt.Sprint(key)
+	resyncing := c.seen != nil
+	if resyncing {
+		if doc.Type == "uninitial" {
+			return
+		}
+		c.seen[id] = true
+	}
+	last, known := c.rows[id]
+	switch doc.Type {
+	case "initial", "add", "change":
+		c.rows[id] = row.NewVal
+		if !resyncing {
+			return row, doc.Type != "initial" || c.opts.IncludeInitial, nil
+		}
+		if !known {
+			return rethinkChangeRow{Type: "add", NewVal: row.NewVal}, true, nil
+		}
+		return rethinkChangeRow{Type: "change", OldVal: last, NewVal: row.NewVal}, !bytes.Equal(last, row.NewVal), nil
+	case "uninitial":
+		delete(c.rows, id)
+		return row, c.opts.IncludeInitial, nil
+	case "remove":
+		delete(c.rows, id)
+		if resyncing {
+			row.OldVal = last
+		}
+		return row, !resyncing || known, nil
+	}
+	return
+}
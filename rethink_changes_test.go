@@ -0,0 +1,102 @@
+package gostore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	r "github.com/gorethink/gorethink"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// changeDocs reads the documents of a changefeed until it ends
+func changeDocs(rows ObjectRows) (docs []map[string]interface{}) {
+	for {
+		var doc map[string]interface{}
+		ok, err := rows.Next(&doc)
+		if !ok || err != nil {
+			return
+		}
+		docs = append(docs, doc)
+	}
+}
+
+func TestRethinkChanges(t *testing.T) {
+	Convey("Giving a rethink changefeed which loses its session", t, func() {
+		mock := r.NewMock()
+		query := r.DB("gostore_test").Table(collection).Changes(r.ChangesOpts{IncludeInitial: true, IncludeStates: true, IncludeTypes: true})
+		mock.On(query).Return([]interface{}{
+			map[string]interface{}{"type": "initial", "new_val": map[string]interface{}{"id": "1", "kind": "thing"}},
+			map[string]interface{}{"type": "initial", "new_val": map[string]interface{}{"id": "2", "kind": "thing"}},
+			map[string]interface{}{"type": "state", "state": "ready"},
+			map[string]interface{}{"type": "change", "old_val": map[string]interface{}{"id": "1", "kind": "thing"}, "new_val": map[string]interface{}{"id": "1", "kind": "fish"}},
+		}, nil).Once()
+		mock.On(query).Return([]interface{}{
+			map[string]interface{}{"type": "initial", "new_val": map[string]interface{}{"id": "1", "kind": "fish"}},
+			map[string]interface{}{"type": "initial", "new_val": map[string]interface{}{"id": "3", "kind": "thing"}},
+			map[string]interface{}{"type": "state", "state": "ready"},
+		}, nil).Once()
+		dropped := errors.New("table dropped")
+		mock.On(query).Return(nil, dropped)
+		changes := r.DB("gostore_test").Table(collection).Changes(r.ChangesOpts{IncludeStates: true, IncludeTypes: true})
+		mock.On(changes).Return([]interface{}{
+			map[string]interface{}{"type": "state", "state": "ready"},
+			map[string]interface{}{"type": "change", "old_val": map[string]interface{}{"id": "1", "kind": "thing"}, "new_val": map[string]interface{}{"id": "1", "kind": "fish"}},
+		}, nil).Once()
+		mock.On(changes).Return([]interface{}{
+			map[string]interface{}{"type": "state", "state": "ready"},
+			map[string]interface{}{"type": "remove", "old_val": map[string]interface{}{"id": "2", "kind": "thing"}},
+		}, nil).Once()
+		mock.On(changes).Return(nil, dropped)
+		store := RethinkStore{mock, "gostore_test"}
+		retry := RetryOptions{InitialInterval: time.Millisecond}
+		Convey("The feed resumes with the changes it missed and no duplicates", func() {
+			rows, err := store.Changes(collection, nil, nil, RethinkChangesOptions{IncludeInitial: true, IncludeTypes: true, Resume: true, Retry: retry})
+			So(err, ShouldBeNil)
+			defer rows.Close()
+			var seen []string
+			for _, doc := range changeDocs(rows) {
+				id := ""
+				for _, val := range []interface{}{doc["old_val"], doc["new_val"]} {
+					if val, ok := val.(map[string]interface{}); ok {
+						id = val["id"].(string)
+					}
+				}
+				seen = append(seen, doc["type"].(string)+" "+id)
+			}
+			So(seen, ShouldResemble, []string{"initial 1", "initial 2", "change 1", "add 3", "remove 2"})
+			So(rows.LastError(), ShouldEqual, dropped)
+		})
+		Convey("Initial values and types are only delivered when asked for", func() {
+			rows, err := store.Changes(collection, nil, nil, RethinkChangesOptions{Resume: true, Retry: retry})
+			So(err, ShouldBeNil)
+			defer rows.Close()
+			docs := changeDocs(rows)
+			So(docs, ShouldHaveLength, 3)
+			So(docs[0], ShouldNotContainKey, "type")
+			So(docs[0]["new_val"], ShouldResemble, map[string]interface{}{"id": "1", "kind": "fish"})
+			So(docs[2]["new_val"], ShouldBeNil)
+		})
+		Convey("A feed which does not resume keeps no rows and skips the changes it missed", func() {
+			rows, err := store.Changes(collection, nil, nil, RethinkChangesOptions{IncludeTypes: true, Retry: retry})
+			So(err, ShouldBeNil)
+			defer rows.Close()
+			docs := changeDocs(rows)
+			So(rows.(*RethinkChangeRows).rows, ShouldBeNil)
+			So(docs, ShouldHaveLength, 2)
+			So(docs[0]["type"], ShouldEqual, "change")
+			So(docs[1]["type"], ShouldEqual, "remove")
+			So(docs[1]["old_val"], ShouldResemble, map[string]interface{}{"id": "2", "kind": "thing"})
+			So(rows.LastError(), ShouldEqual, dropped)
+		})
+		Convey("Closed rows end without an error", func() {
+			rows, err := store.Changes(collection, nil, nil, RethinkChangesOptions{Retry: retry})
+			So(err, ShouldBeNil)
+			rows.Close()
+			rows.Close()
+			ok, err := rows.Next(&map[string]interface{}{})
+			So(ok, ShouldBeFalse)
+			So(err, ShouldBeNil)
+		})
+	})
+}
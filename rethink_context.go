@@ -0,0 +1,170 @@
+package gostore
+
+import (
+	"context"
+
+	r "github.com/gorethink/gorethink"
+)
+
+// rethinkContextSession runs queries with the context of a store. The driver cancels a query and
+// stops fetching batches of its cursor once the context is done
+type rethinkContextSession struct {
+	r.QueryExecutor
+	ctx context.Context
+}
+
+func (s rethinkContextSession) Query(ctx context.Context, q r.Query) (*r.Cursor, error) {
+	if ctx == nil {
+		ctx = s.ctx
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.QueryExecutor.Query(ctx, q)
+}
+
+func (s rethinkContextSession) Exec(ctx context.Context, q r.Query) error {
+	if ctx == nil {
+		ctx = s.ctx
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.QueryExecutor.Exec(ctx, q)
+}
+
+// withContext returns a copy of the store whose queries run with ctx
+func (s RethinkStore) withContext(ctx context.Context) RethinkStore {
+	s.Session = rethinkContextSession{s.Session, ctx}
+	return s
+}
+
+func (s RethinkStore) CreateDatabaseContext(ctx context.Context) error {
+	return s.withContext(ctx).CreateDatabase()
+}
+
+func (s RethinkStore) CreateTableContext(ctx context.Context, table string, sample interface{}) error {
+	return s.withContext(ctx).CreateTable(table, sample)
+}
+
+func (s RethinkStore) StatsContext(ctx context.Context, store string) (map[string]interface{}, error) {
+	return s.withContext(ctx).Stats(store)
+}
+
+func (s RethinkStore) AllContext(ctx context.Context, count int, skip int, store string) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).All(count, skip, store)
+	return contextRows(ctx, rows, err)
+}
+
+func (s RethinkStore) AllCursorContext(ctx context.Context, store string) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).AllCursor(store)
+	return contextRows(ctx, rows, err)
+}
+
+func (s RethinkStore) AllWithinRangeContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).AllWithinRange(filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (s RethinkStore) SinceContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).Since(id, count, skip, store)
+	return contextRows(ctx, rows, err)
+}
+
+func (s RethinkStore) BeforeContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).Before(id, count, skip, store)
+	return contextRows(ctx, rows, err)
+}
+
+func (s RethinkStore) FilterSinceContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).FilterSince(id, filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (s RethinkStore) FilterBeforeContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).FilterBefore(id, filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (s RethinkStore) FilterBeforeCountContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.withContext(ctx).FilterBeforeCount(id, filter, count, skip, store, opts)
+}
+
+func (s RethinkStore) GetContext(ctx context.Context, key string, store string, dst interface{}) error {
+	return s.withContext(ctx).Get(key, store, dst)
+}
+
+func (s RethinkStore) SaveContext(ctx context.Context, key, store string, src interface{}) (string, error) {
+	return s.withContext(ctx).Save(key, store, src)
+}
+
+func (s RethinkStore) SaveAllContext(ctx context.Context, store string, src ...interface{}) ([]string, error) {
+	return s.withContext(ctx).SaveAll(store, src...)
+}
+
+func (s RethinkStore) UpdateContext(ctx context.Context, key string, store string, src interface{}) error {
+	return s.withContext(ctx).Update(key, store, src)
+}
+
+func (s RethinkStore) ReplaceContext(ctx context.Context, key string, store string, src interface{}) error {
+	return s.withContext(ctx).Replace(key, store, src)
+}
+
+func (s RethinkStore) DeleteContext(ctx context.Context, key string, store string) error {
+	return s.withContext(ctx).Delete(key, store)
+}
+
+func (s RethinkStore) FilterUpdateContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).FilterUpdate(filter, src, store, opts)
+}
+
+func (s RethinkStore) FilterReplaceContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).FilterReplace(filter, src, store, opts)
+}
+
+func (s RethinkStore) FilterGetContext(ctx context.Context, filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).FilterGet(filter, store, dst, opts)
+}
+
+func (s RethinkStore) FilterGetAllContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).FilterGetAll(filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (s RethinkStore) QueryContext(ctx context.Context, filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error) {
+	rows, agg, err := s.withContext(ctx).Query(filter, aggregates, count, skip, store, opts)
+	rows, err = contextRows(ctx, rows, err)
+	return rows, agg, err
+}
+
+func (s RethinkStore) FilterDeleteContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).FilterDelete(filter, store, opts)
+}
+
+func (s RethinkStore) FilterCountContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.withContext(ctx).FilterCount(filter, store, opts)
+}
+
+func (s RethinkStore) GetByFieldContext(ctx context.Context, name, val, store string, dst interface{}) error {
+	return s.withContext(ctx).GetByField(name, val, store, dst)
+}
+
+func (s RethinkStore) GetByFieldsByFieldContext(ctx context.Context, name, val, store string, fields []string, dst interface{}) error {
+	return s.withContext(ctx).GetByFieldsByField(name, val, store, fields, dst)
+}
+
+func (s RethinkStore) BatchDeleteContext(ctx context.Context, ids []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).BatchDelete(ids, store, opts)
+}
+
+func (s RethinkStore) BatchUpdateContext(ctx context.Context, ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).BatchUpdate(ids, data, store, opts)
+}
+
+func (s RethinkStore) BatchFilterDeleteContext(ctx context.Context, filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).BatchFilterDelete(filter, store, opts)
+}
+
+func (s RethinkStore) BatchInsertContext(ctx context.Context, data []interface{}, store string, opts ObjectStoreOptions) ([]string, error) {
+	return s.withContext(ctx).BatchInsert(data, store, opts)
+}
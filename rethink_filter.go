@@ -0,0 +1,111 @@
+package gostore
+
+import (
+	r "github.com/gorethink/gorethink"
+)
+
+// rethinkNumberPattern matches strings which compare as numbers, like compareFilterValue
+const rethinkNumberPattern = `^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?$`
+
+// rethinkTimePattern matches the RFC3339 dates toTime accepts, r.ISO8601 parses them
+const rethinkTimePattern = `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})$`
+
+// compileRethinkFilter translates a filter into a row predicate which matches the rows
+// FilterExpr.Match matches. A filter which cannot be parsed fails with a *FilterError
+func compileRethinkFilter(filter map[string]interface{}) (r.Term, error) {
+	expr, err := ParseFilter(filter)
+	if err != nil {
+		return r.Term{}, err
+	}
+	return rethinkExpr(expr), nil
+}
+
+func rethinkExpr(e FilterExpr) r.Term {
+	switch e := e.(type) {
+	case *FilterGroup:
+		return rethinkGroup(e)
+	case *FilterCondition:
+		return rethinkCondition(e)
+	}
+	return r.Expr(false)
+}
+
+// rethinkGroup chains the members of an and group, an or group becomes r.Or
+func rethinkGroup(g *FilterGroup) r.Term {
+	switch len(g.Exprs) {
+	case 0:
+		return r.Expr(g.Op == AndGroup)
+	case 1:
+		return rethinkExpr(g.Exprs[0])
+	}
+	if g.Op == OrGroup {
+		terms := make([]interface{}, len(g.Exprs))
+		for i, e := range g.Exprs {
+			terms[i] = rethinkExpr(e)
+		}
+		return r.Or(terms...)
+	}
+	t := rethinkExpr(g.Exprs[0])
+	for _, e := range g.Exprs[1:] {
+		t = t.And(rethinkExpr(e))
+	}
+	return t
+}
+
+func rethinkCondition(c *FilterCondition) r.Term {
+	field := r.Row
+	for _, p := range c.Path {
+		field = field.Field(p)
+	}
+	switch c.Op {
+	case OpExists:
+		//rethinkdb treats every value but false and null as true
+		return field
+	case OpGt:
+		return rethinkCompare(field, c.Values[0], r.Term.Gt)
+	case OpLt:
+		return rethinkCompare(field, c.Values[0], r.Term.Lt)
+	}
+	var t r.Term
+	for i, v := range c.Values {
+		var cond r.Term
+		if c.Op == OpMatch {
+			cond = field.Match(v.Str)
+		} else if v.Kind == TimeValue {
+			cond = rethinkCompare(field, v, r.Term.Eq)
+		} else {
+			cond = field.Eq(v.Interface())
+		}
+		if i == 0 {
+			t = cond
+		} else {
+			t = t.Or(cond)
+		}
+	}
+	return t
+}
+
+// rethinkCompare compares a field against an operand like compareFilterValue: numeric strings
+// compare as numbers, dates are read from times, unix seconds and RFC3339 strings. Fields of
+// another type do not match, rethinkdb would otherwise order them by type
+func rethinkCompare(field r.Term, v FilterValue, cmp func(r.Term, ...interface{}) r.Term) r.Term {
+	typ := field.TypeOf()
+	switch v.Kind {
+	case NumberValue:
+		return r.Branch(
+			typ.Eq("NUMBER"), cmp(field, v.Number),
+			typ.Eq("STRING"), r.Branch(field.Match(rethinkNumberPattern), cmp(field.CoerceTo("NUMBER"), v.Number), cmp(field, v.Raw)),
+			false,
+		)
+	case TimeValue:
+		return r.Branch(
+			typ.Eq("PTYPE<TIME>"), cmp(field, v.Time),
+			typ.Eq("NUMBER"), cmp(r.EpochTime(field), v.Time),
+			typ.Eq("STRING"), r.Branch(field.Match(rethinkTimePattern), cmp(r.ISO8601(field), v.Time), false),
+			false,
+		)
+	case StringValue:
+		return r.Branch(typ.Eq("STRING"), cmp(field, v.Str), false)
+	}
+	return r.Expr(false)
+}
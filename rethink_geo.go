@@ -0,0 +1,113 @@
+package gostore
+
+import (
+	r "github.com/gorethink/gorethink"
+)
+
+// createGeoIndex creates a geo index named after the location field configured in schema["locationField"]
+func (rs RethinkStore) createGeoIndex(store string, schema interface{}, existing []interface{}) error {
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	field, ok := s["locationField"].(string)
+	if !ok || field == "" || hasIndex(field, existing) {
+		return nil
+	}
+	logger.Info("creating geo index", "name", field)
+	if err := r.DB(rs.Database).Table(store).IndexCreate(field, r.IndexCreateOpts{Geo: true}).Exec(rs.Session); err != nil {
+		return err
+	}
+	return r.DB(rs.Database).Table(store).IndexWait(field).Exec(rs.Session)
+}
+
+// geoDoc converts the location field of src into a rethinkdb point
+func geoDoc(key string, src interface{}, field string) (map[string]interface{}, error) {
+	doc, err := toDoc(src)
+	if err != nil {
+		return nil, err
+	}
+	lon, lat, ok := locationOf(doc[field])
+	if !ok {
+		return nil, ErrInvalidLocation
+	}
+	geo := make(map[string]interface{}, len(doc)+1)
+	for k, v := range doc {
+		geo[k] = v
+	}
+	geo[field] = r.Point(lon, lat)
+	if _, ok := geo["id"]; !ok && key != "" {
+		geo["id"] = key
+	}
+	return geo, nil
+}
+
+// SaveWithGeo saves src with its location field stored as a native point so it can be geo indexed
+func (s RethinkStore) SaveWithGeo(key, store string, src interface{}, field string) (string, error) {
+	doc, err := geoDoc(key, src, field)
+	if err != nil {
+		return "", err
+	}
+	newKey, err := s.Save(key, store, doc)
+	if newKey == "" && err == nil {
+		newKey = key
+	}
+	return newKey, err
+}
+
+// SaveWithGeoTX is not supported, rethinkdb has no transactions
+func (s RethinkStore) SaveWithGeoTX(key, store string, src interface{}, field string, txn Transaction) error {
+	return ErrNotImplemented
+}
+
+// GeoQuery retrieves rows within distance (e.g "5km", "300m") of a point, nearest first. The location
+// field is read from opts.GetGeoQuery() and rows must also match query. Each row has the distance in
+// meters in its _distance field.
+//
+// An unfiltered query with a count reads the count+skip nearest rows with get_nearest. Otherwise
+// get_nearest would need a bound on the rows it reads before they are filtered, so the rows within
+// distance are read from the geo index with get_intersecting and sorted by distance in memory
+func (s RethinkStore) GeoQuery(lon, lat float64, distance string, query map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (rrows ObjectRows, err error) {
+	meters, err := ParseDistance(distance)
+	if err != nil {
+		return
+	}
+	if err = ValidateFilter(query); err != nil {
+		return
+	}
+	point := r.Point(lon, lat)
+	field := geoLocationField(opts)
+	var term r.Term
+	if len(query) == 0 && count > 0 {
+		term = r.DB(s.Database).Table(store).GetNearest(point, r.GetNearestOpts{
+			Index:      field,
+			MaxDist:    meters,
+			Unit:       "m",
+			MaxResults: skip + count,
+		}).Map(r.Row.Field("doc").Merge(map[string]interface{}{geoDistanceField: r.Row.Field("dist")}))
+	} else {
+		term = r.DB(s.Database).Table(store).GetIntersecting(r.Circle(point, meters, r.CircleOpts{Unit: "m"}), r.GetIntersectingOpts{
+			Index: field,
+		}).Map(r.Row.Merge(map[string]interface{}{geoDistanceField: r.Distance(r.Row.Field(field), point, r.DistanceOpts{Unit: "m"})}))
+		if term, err = s.filtered(term, query); err != nil {
+			return
+		}
+		term = term.OrderBy(geoDistanceField)
+	}
+	if skip > 0 {
+		term = term.Skip(skip)
+	}
+	if count > 0 {
+		term = term.Limit(count)
+	}
+	result, err := term.Run(s.Session)
+	if err != nil {
+		return
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+	rrows = RethinkRows{result}
+	logger.Debug("GeoQuery::done", "query", term.String(), "store", store)
+	return
+}
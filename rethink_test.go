@@ -226,9 +226,9 @@ func TestFilterBefore(t *testing.T) {
 	mock := r.NewMock()
 	mock.On(r.DB("gostore_test").Table("things").Insert(items, r.InsertOpts{Durability: "hard"})).Return(r.WriteResponse{GeneratedKeys: expectedKeys}, nil)
 	mock.On(r.DB("gostore_test").Table("things")).Return(items, nil)
-	mock.On(r.DB("gostore_test").Table("things").Between(r.MinVal, "5", r.BetweenOpts{RightBound: "closed"}).
+	mock.On(r.DB("gostore_test").Table("things").Between(r.MinVal, "5").
 		OrderBy(r.OrderByOpts{Index: r.Desc("id")}).Filter(r.Row.Field("kind").Eq("thing")).
-		Limit(3)).Return([]interface{}{items[4], items[3], items[2]}, nil)
+		Skip(0).Limit(3)).Return([]interface{}{items[4], items[3], items[2]}, nil)
 
 	Convey("Giving a rethink store", t, func() {
 		store := RethinkStore{mock, "gostore_test"}
@@ -436,7 +436,8 @@ func TestParseFilterOpsOrEqTerm(t *testing.T) {
 		key := "kind"
 		val := "=thing|fish"
 		Convey("Determine what conditions to perform on the val", func() {
-			t := store.parseFilterOpsTerm(key, val)
+			t, err := store.transformFilter(map[string]interface{}{key: val})
+			So(err, ShouldBeNil)
 			So(t.String(), ShouldEqual, `r.Row.Field("kind").Eq("thing").Or(r.Row.Field("kind").Eq("fish"))`)
 
 		})
@@ -452,7 +453,8 @@ func TestParseFilterOpsOrMatchTerm(t *testing.T) {
 		key := "kind"
 		val := "~thing|fish"
 		Convey("Determine what conditions to perform on the val", func() {
-			t := store.parseFilterOpsTerm(key, val)
+			t, err := store.transformFilter(map[string]interface{}{key: val})
+			So(err, ShouldBeNil)
 			So(t.String(), ShouldEqual, `r.Row.Field("kind").Match("thing").Or(r.Row.Field("kind").Match("fish"))`)
 
 		})
@@ -485,7 +487,8 @@ func TestTransformFilter(t *testing.T) {
 				},
 			}
 			Convey("figure out rethink conditions", func() {
-				term := store.transformFilter(nil, filter)
+				term, err := store.transformFilter(filter)
+				So(err, ShouldBeNil)
 				So(term.String(), ShouldBeIn, []string{
 					`r.Or(r.Row.Field("place").Eq("lagos").And(r.Row.Field("food").Match("amala").Or(r.Row.Field("food").Match("ewedu"))), r.Row.Field("server").Eq("olu").And(r.Row.Field("beverage").Eq("coke")))`,
 					`r.Or(r.Row.Field("place").Eq("lagos").And(r.Row.Field("food").Match("amala").Or(r.Row.Field("food").Match("ewedu"))), r.Row.Field("beverage").Eq("coke").And(r.Row.Field("server").Eq("olu")))`,
@@ -504,7 +507,8 @@ func TestTransformFilterNestedObject(t *testing.T) {
 		key := "food.type"
 		val := "~egg|fish"
 		Convey("Determine what conditions to perform on the val", func() {
-			t := store.parseFilterOpsTerm(key, val)
+			t, err := store.transformFilter(map[string]interface{}{key: val})
+			So(err, ShouldBeNil)
 			So(t.String(), ShouldEqual, `r.Row.Field("food").Field("type").Match("egg").Or(r.Row.Field("food").Field("type").Match("fish"))`)
 
 		})
@@ -520,7 +524,8 @@ func TestGetRootTermWithoutIndexes(t *testing.T) {
 		Convey("and a filter", func() {
 			filter := map[string]interface{}{"id": "1", "kind": "thing"}
 			Convey("generating a root term without indexes should give a slow term without any indexing", func() {
-				term := store.getRootTerm("things", filter, nil)
+				term, err := store.getRootTerm("things", filter, nil)
+				So(err, ShouldBeNil)
 
 				So(term.String(), ShouldBeIn, []string{
 					`r.DB("gostore_test").Table("things").OrderBy(index=r.Desc("id")).Filter(func(var_11 r.Term) r.Term { return r.Row.Field("kind").Eq("thing").And(r.Row.Field("id").Eq("1")) })`,
@@ -545,7 +550,8 @@ func TestGetRootTermWithIndexes(t *testing.T) {
 			},
 			}
 			Convey("generating a root term with indexes should give an optimized term", func() {
-				term := store.getRootTerm("things", filter, opts)
+				term, err := store.getRootTerm("things", filter, opts)
+				So(err, ShouldBeNil)
 
 				So(term.String(), ShouldBeIn, []string{
 					`r.DB("gostore_test").Table("things").Between(["thing", r.MinVal()], ["thing", r.MaxVal()], right_bound="closed", index="kind_id").OrderBy(index=r.Desc("kind_id")).Filter(func(var_12 r.Term) r.Term { return r.Row.Field("kind").Eq("thing").And(r.Row.Field("id").Eq("1")) })`,
@@ -808,3 +814,204 @@ func TestBatchDelete(t *testing.T) {
 		})
 	})
 }
+
+func TestRethinkSaveWithGeo(t *testing.T) {
+	Convey("Giving a rethink store", t, func() {
+		mock := r.NewMock()
+		mock.On(r.DB("gostore_test").Table("riders").Insert(map[string]interface{}{
+			"id": "1", "status": "available", "location": r.Point(3.4, 6.5),
+		}, r.InsertOpts{Durability: "soft"})).Return(r.WriteResponse{}, nil)
+		store := RethinkStore{mock, "gostore_test"}
+		Convey("Saving a row stores its location as a point", func() {
+			key, err := store.SaveWithGeo("1", "riders", map[string]interface{}{
+				"status": "available", "location": map[string]interface{}{"lat": 6.5, "lon": 3.4},
+			}, "location")
+			So(err, ShouldBeNil)
+			So(key, ShouldEqual, "1")
+			mock.AssertExpectations(t)
+		})
+		Convey("A row without a valid location is rejected", func() {
+			_, err := store.SaveWithGeo("1", "riders", map[string]interface{}{"status": "available"}, "location")
+			So(err, ShouldEqual, ErrInvalidLocation)
+		})
+	})
+}
+
+func TestRethinkGeoQuery(t *testing.T) {
+	riders := []interface{}{map[string]interface{}{"id": "1", "status": "available", "_distance": 120.5}}
+	Convey("Giving a rethink store", t, func() {
+		mock := r.NewMock()
+		table := r.DB("gostore_test").Table("riders")
+		mock.On(table.GetIntersecting(r.Circle(r.Point(3.4, 6.5), 5000.0, r.CircleOpts{Unit: "m"}), r.GetIntersectingOpts{
+			Index: "position",
+		}).Map(r.Row.Merge(map[string]interface{}{
+			"_distance": r.Distance(r.Row.Field("position"), r.Point(3.4, 6.5), r.DistanceOpts{Unit: "m"}),
+		})).Filter(r.Row.Field("status").Eq("available")).OrderBy("_distance").Skip(20).Limit(10)).Return(riders, nil)
+		mock.On(table.GetNearest(r.Point(3.4, 6.5), r.GetNearestOpts{
+			Index: "location", MaxDist: 5000.0, Unit: "m", MaxResults: 30,
+		}).Map(r.Row.Field("doc").Merge(map[string]interface{}{"_distance": r.Row.Field("dist")})).Skip(20).Limit(10)).Return(riders, nil)
+		store := RethinkStore{mock, "gostore_test"}
+		Convey("Every nearby row matching the filter is considered, nearest first", func() {
+			opts := DefaultObjectStoreOptions{GeoQuery: GeoQueryOptions{LocationField: "position"}}
+			rows, err := store.GeoQuery(3.4, 6.5, "5km", map[string]interface{}{"status": "available"}, 10, 20, "riders", opts)
+			So(err, ShouldBeNil)
+			So(rowsToArray(rows), ShouldResemble, riders)
+		})
+		Convey("Unfiltered rows are read nearest first up to the page asked for", func() {
+			rows, err := store.GeoQuery(3.4, 6.5, "5km", nil, 10, 20, "riders", nil)
+			So(err, ShouldBeNil)
+			So(rowsToArray(rows), ShouldResemble, riders)
+		})
+		Convey("Invalid distances are rejected", func() {
+			_, err := store.GeoQuery(3.4, 6.5, "5 leagues", nil, 10, 0, "riders", nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSelectTermForChanges(t *testing.T) {
+	Convey("Changes select rows through the indexes of the filter without ordering them", t, func() {
+		store := RethinkStore{r.NewMock(), "gostore_test"}
+		opts := DefaultObjectStoreOptions{Index: map[string][]string{"kind": {}}}
+		term, err := store.selectTerm("things", map[string]interface{}{"kind": "thing"}, opts, false)
+		So(err, ShouldBeNil)
+		So(term.String(), ShouldStartWith, `r.DB("gostore_test").Table("things").GetAll("thing", index="kind").Filter(`)
+	})
+}
+
+func TestRethinkFilterOperators(t *testing.T) {
+	Convey("Giving a rethink store", t, func() {
+		mock := r.NewMock()
+		store := RethinkStore{mock, "gostore_test"}
+		table := r.DB("gostore_test").Table("things").OrderBy(r.OrderByOpts{Index: r.Desc("id")})
+		filters := map[FilterOperator][]map[string]interface{}{
+			OpEq:     {{"kind": "=thing|fish"}, {"active": true}, {"rating": 5}, {"deleted": nil}},
+			OpMatch:  {{"name": "~^First"}},
+			OpGt:     {{"rating": ">3"}, {"created": ">2017-06-01|dt"}, {"name": ">M"}},
+			OpLt:     {{"rating": "<3.5"}, {"created": "<1500000000|dt"}},
+			OpExists: {{"food.type": ""}},
+		}
+		Convey("Every declared operator runs", func() {
+			caps, _ := CapabilitiesOf(store)
+			for _, op := range caps.FilterOperators {
+				So(filters, ShouldContainKey, op)
+				for _, filter := range filters[op] {
+					predicate, err := store.transformFilter(filter)
+					So(err, ShouldBeNil)
+					mock.On(table.Filter(predicate)).Return([]interface{}{map[string]interface{}{"id": "1"}}, nil)
+					So(func() {
+						rows, err := store.FilterGetAll(filter, 0, 0, "things", nil)
+						So(err, ShouldBeNil)
+						So(rowsToArray(rows), ShouldHaveLength, 1)
+					}, ShouldNotPanic)
+				}
+			}
+		})
+		Convey("Typed values and comparisons compile to terms", func() {
+			term, _ := store.transformFilter(map[string]interface{}{"active": true, "rating": 5})
+			So(term.String(), ShouldEqual, `r.Row.Field("active").Eq(true).And(r.Row.Field("rating").Eq(5))`)
+			term, _ = store.transformFilter(map[string]interface{}{"rating": ">3"})
+			So(term.String(), ShouldStartWith, `r.Branch(r.Row.Field("rating").TypeOf().Eq("NUMBER"), r.Row.Field("rating").Gt(3)`)
+		})
+		Convey("Filters which cannot be compiled fail with a FilterError", func() {
+			_, err := store.FilterGetAll(map[string]interface{}{"rating": ">"}, 0, 0, "things", nil)
+			So(err, ShouldHaveSameTypeAs, &FilterError{})
+			_, err = store.FilterCount(map[string]interface{}{"tags": []string{"a"}}, "things", nil)
+			So(err, ShouldHaveSameTypeAs, &FilterError{})
+		})
+	})
+}
+
+func TestRethinkRanges(t *testing.T) {
+	mock := r.NewMock()
+	table := r.DB("gostore_test").Table("things")
+	newest := r.OrderByOpts{Index: r.Desc("id")}
+	filter := r.Row.Field("kind").Eq("thing")
+	mock.On(table.Between(r.MinVal, "5").OrderBy(newest).Skip(0).Limit(2)).
+		Return([]interface{}{map[string]interface{}{"id": "4"}, map[string]interface{}{"id": "3"}}, nil)
+	mock.On(table.Between("5", r.MaxVal, r.BetweenOpts{LeftBound: "open"}).OrderBy(newest).Skip(0).Limit(2)).
+		Return([]interface{}{map[string]interface{}{"id": "7"}, map[string]interface{}{"id": "6"}}, nil)
+	mock.On(table.Between(r.MinVal, "5").OrderBy(newest).Filter(filter).Count()).
+		Return(3, nil)
+	mock.On(table.Between("5", r.MaxVal, r.BetweenOpts{LeftBound: "open", Index: "id"}).OrderBy(newest).Filter(filter).Skip(0).Limit(1)).
+		Return([]interface{}{map[string]interface{}{"id": "7"}}, nil)
+	mock.On(table.Between(r.MinVal, "5").OrderBy(newest).Filter(filter).Skip(1)).
+		Return([]interface{}{map[string]interface{}{"id": "2"}, map[string]interface{}{"id": "1"}}, nil)
+
+	Convey("Given a rethink store", t, func() {
+		store := RethinkStore{mock, "gostore_test"}
+		Convey("Before excludes the row with id and reads newest first", func() {
+			rows, err := store.Before("5", 2, 0, "things")
+			So(err, ShouldBeNil)
+			So(rowsToArray(rows), ShouldResemble, []interface{}{map[string]interface{}{"id": "4"}, map[string]interface{}{"id": "3"}})
+			count, err := store.FilterBeforeCount("5", map[string]interface{}{"kind": "thing"}, 0, 0, "things", nil)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+		})
+		Convey("Since excludes the row with id and reads newest first", func() {
+			rows, err := store.Since("5", 2, 0, "things")
+			So(err, ShouldBeNil)
+			So(rowsToArray(rows), ShouldResemble, []interface{}{map[string]interface{}{"id": "7"}, map[string]interface{}{"id": "6"}})
+			rows, err = store.FilterSince("5", map[string]interface{}{"kind": "thing"}, 1, 0, "things", nil)
+			So(err, ShouldBeNil)
+			So(rowsToArray(rows), ShouldHaveLength, 1)
+		})
+		Convey("Filtered ranges skip rows and read every row when count is 0", func() {
+			rows, err := store.FilterBefore("5", map[string]interface{}{"kind": "thing"}, 0, 1, "things", nil)
+			So(err, ShouldBeNil)
+			So(rowsToArray(rows), ShouldResemble, []interface{}{map[string]interface{}{"id": "2"}, map[string]interface{}{"id": "1"}})
+		})
+	})
+}
+
+func TestRethinkQuery(t *testing.T) {
+	mock := r.NewMock()
+	table := r.DB("gostore_test").Table("riders")
+	bikes := table.Filter(r.Row.Field("kind").Eq("bike"))
+	status := r.Row.Field("status").Default(nil)
+	present := bikes.Filter(status.Ne(nil))
+	values := present.ConcatMap(r.Branch(status.TypeOf().Eq("ARRAY"), status, []interface{}{status}))
+	typ := r.Row.TypeOf()
+	cheap := 10.0
+	mock.On(r.Expr([]interface{}{
+		map[string]interface{}{
+			"missing": bikes.Filter(r.Row.Field("price").Default(nil).Eq(nil)).Count(),
+			"present": bikes.Filter(r.Row.Field("price").Default(nil).Ne(nil)).Count(),
+			"numbers": []interface{}{bikes.Filter(r.Branch(r.Row.Field("price").Default(nil).TypeOf().Eq("NUMBER"),
+				r.Expr(true).And(r.Row.Field("price").Default(nil).Lt(cheap)), false)).Count()},
+		},
+		map[string]interface{}{
+			"missing": bikes.Filter(status.Eq(nil)).Count(),
+			"present": present.Count(),
+			"matched": present.Filter(r.Row.Field("status").Eq("available"), r.FilterOpts{Default: false}).Count(),
+			"terms":   values.Count(),
+			"top": values.Filter(r.Or(typ.Eq("STRING"), typ.Eq("NUMBER"), typ.Eq("BOOL"))).
+				Group(r.Row).Count().Ungroup().OrderBy(r.Desc("reduction"), r.Asc("group")).Limit(2),
+		},
+	})).Return([]interface{}{[]interface{}{
+		map[string]interface{}{"missing": 1, "present": 4, "numbers": []interface{}{3}},
+		map[string]interface{}{"missing": 0, "present": 5, "matched": 3, "terms": 7, "top": []interface{}{
+			map[string]interface{}{"group": "available", "reduction": 3},
+			map[string]interface{}{"group": "busy", "reduction": 2},
+		}},
+	}}, nil).Once()
+	mock.On(table.OrderBy(r.OrderByOpts{Index: r.Desc("id")}).Filter(r.Row.Field("kind").Eq("bike")).Slice(0, 10)).
+		Return([]interface{}{map[string]interface{}{"id": "1", "kind": "bike"}}, nil).Once()
+
+	Convey("Given a rethink store", t, func() {
+		store := RethinkStore{mock, "gostore_test"}
+		Convey("Aggregates are counted by rethinkdb and only the page is read", func() {
+			rows, aggs, err := store.Query(map[string]interface{}{"kind": "bike"}, map[string]interface{}{
+				"price":  map[string]interface{}{"numberRange": []interface{}{map[string]interface{}{"name": "cheap", "to": 10}}},
+				"status": map[string]interface{}{"match": "=available", "top": 2},
+			}, 10, 0, "riders", nil)
+			So(err, ShouldBeNil)
+			So(rowsToArray(rows), ShouldHaveLength, 1)
+			So(aggs["price"], ShouldResemble, Match{Field: "price", Missing: 1, Matched: 4,
+				NumberRange: []NumberRangeCount{{Name: "cheap", To: &cheap, Count: 3}}})
+			So(aggs["status"], ShouldResemble, Match{Field: "status", Matched: 3, UnMatched: 2, Other: 2,
+				Top: []TermCount{{Term: "available", Count: 3}, {Term: "busy", Count: 2}}})
+			mock.AssertExpectations(t)
+		})
+	})
+}
@@ -0,0 +1,69 @@
+package gostore
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// rethinkChange is a document of a rethinkdb changefeed
+type rethinkChange struct {
+	Type   string                 `gorethink:"type" json:"type"`
+	State  string                 `gorethink:"state" json:"-"`
+	OldVal map[string]interface{} `gorethink:"old_val" json:"old_val"`
+	NewVal map[string]interface{} `gorethink:"new_val" json:"new_val"`
+}
+
+// Watch streams the changes of a table with a rethinkdb changefeed, which sees the writes of every
+// client of the database. The feed reconnects after its session is lost and misses the changes made
+// meanwhile, like a postgres feed, so it keeps no rows in memory. Closing it stops the query
+func (s RethinkStore) Watch(store string, filter map[string]interface{}, opts WatchOptions) (ChangeFeed, error) {
+	rows, err := s.Changes(store, filter, nil, RethinkChangesOptions{IncludeTypes: true})
+	if err != nil {
+		return nil, err
+	}
+	return newStreamFeed(opts, rows.Close, func(emit func(Change) bool) error {
+		defer rows.Close()
+		for {
+			var doc rethinkChange
+			ok, err := rows.Next(&doc)
+			if !ok || err != nil {
+				return err
+			}
+			c, ok, err := doc.change(store)
+			if err != nil {
+				return err
+			}
+			if ok && !emit(c) {
+				return nil
+			}
+		}
+	}), nil
+}
+
+// change converts a changefeed document, ok is false for the states and initial values a feed
+// may send which are not writes
+func (d rethinkChange) change(store string) (c Change, ok bool, err error) {
+	switch d.Type {
+	case "add", "change", "remove", "":
+	default:
+		return c, false, nil
+	}
+	var old, new []byte
+	var key interface{}
+	if d.OldVal != nil {
+		if old, err = json.Marshal(d.OldVal); err != nil {
+			return
+		}
+		key = d.OldVal["id"]
+	}
+	if d.NewVal != nil {
+		if new, err = json.Marshal(d.NewVal); err != nil {
+			return
+		}
+		key = d.NewVal["id"]
+	}
+	if old == nil && new == nil {
+		return c, false, nil
+	}
+	return changeOf(store, fmt.Sprint(key), old, new), true, nil
+}
@@ -0,0 +1,272 @@
+package gostore
+
+import (
+	"errors"
+	"fmt"
+
+	r "github.com/gorethink/gorethink"
+)
+
+// FilterUpdateResult updates the rows matching filter, selected through an index of opts when the
+// filter uses one, and reports the write. src is a document merged into each row, an UpdateSpec or
+// a func(r.Term) interface{} returning the changes of a row. A dry run counts the rows which would
+// be matched and changed. An empty filter fails with ErrEmptyFilter unless wopts.All is set
+func (s RethinkStore) FilterUpdateResult(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions, wopts WriteOptions) (WriteResult, error) {
+	if len(filter) == 0 && !wopts.All {
+		return WriteResult{}, ErrEmptyFilter
+	}
+	update, err := rethinkUpdate(src)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	term, err := s.selectTerm(store, filter, opts, false)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	if wopts.DryRun {
+		return s.dryRun(term, func(row r.Term) interface{} {
+			return row.Merge(update)
+		}, false)
+	}
+	res, err := term.Update(update, r.UpdateOpts{Durability: "soft"}).RunWrite(s.Session)
+	return rethinkWriteResult(res, false), err
+}
+
+// FilterReplaceResult replaces the rows matching filter and reports the write. src is either a
+// document, which keeps the id of each row it replaces, or a func(r.Term) interface{} returning the
+// replacement of a row. A dry run counts the rows which would be matched and changed. An empty
+// filter fails with ErrEmptyFilter unless wopts.All is set
+func (s RethinkStore) FilterReplaceResult(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions, wopts WriteOptions) (WriteResult, error) {
+	if len(filter) == 0 && !wopts.All {
+		return WriteResult{}, ErrEmptyFilter
+	}
+	replace := rethinkReplacement(src)
+	term, err := s.selectTerm(store, filter, opts, false)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	if wopts.DryRun {
+		return s.dryRun(term, replace, true)
+	}
+	res, err := term.Replace(replace, r.ReplaceOpts{Durability: "soft"}).RunWrite(s.Session)
+	return rethinkWriteResult(res, true), err
+}
+
+// dryRun counts the rows of term and those write would change
+func (s RethinkStore) dryRun(term r.Term, write func(row r.Term) interface{}, replace bool) (result WriteResult, err error) {
+	cursor, err := r.Expr(map[string]interface{}{
+		"matched": term.Count(),
+		"changed": term.Filter(func(row r.Term) interface{} {
+			return row.Ne(write(row))
+		}).Count(),
+	}).Run(s.Session)
+	if err != nil {
+		return
+	}
+	defer cursor.Close()
+	var counts struct {
+		Matched int `gorethink:"matched"`
+		Changed int `gorethink:"changed"`
+	}
+	if err = cursor.One(&counts); err != nil {
+		return
+	}
+	result.Matched = counts.Matched
+	result.Unchanged = counts.Matched - counts.Changed
+	if replace {
+		result.Replaced = counts.Changed
+	} else {
+		result.Updated = counts.Changed
+	}
+	return
+}
+
+// rethinkUpdate converts an UpdateSpec into an update document, set values are literals so they
+// replace what they are set over and removed paths hold an empty literal
+func rethinkUpdate(src interface{}) (interface{}, error) {
+	literal := func(val interface{}) interface{} {
+		return r.Literal(val)
+	}
+	switch u := src.(type) {
+	case UpdateSpec:
+		return u.document(literal, r.Literal())
+	case *UpdateSpec:
+		return u.document(literal, r.Literal())
+	}
+	return src, nil
+}
+
+// rethinkReplacement returns the function replacing a row, a document replaces the row but keeps
+// its id
+func rethinkReplacement(src interface{}) func(row r.Term) interface{} {
+	switch f := src.(type) {
+	case func(r.Term) interface{}:
+		return f
+	case func(r.Term) r.Term:
+		return func(row r.Term) interface{} {
+			return f(row)
+		}
+	}
+	return func(row r.Term) interface{} {
+		return r.Expr(src).Merge(map[string]interface{}{"id": row.Field("id")})
+	}
+}
+
+// rethinkWriteResult converts the response of an update or a replace, rethinkdb counts the rows
+// either changed as replaced
+func rethinkWriteResult(res r.WriteResponse, replace bool) WriteResult {
+	result := WriteResult{
+		Matched:    res.Replaced + res.Updated + res.Unchanged + res.Errors,
+		Unchanged:  res.Unchanged,
+		Errors:     res.Errors,
+		FirstError: res.FirstError,
+	}
+	if replace {
+		result.Replaced = res.Replaced + res.Updated
+	} else {
+		result.Updated = res.Replaced + res.Updated
+	}
+	return result
+}
+
+// FilterDeleteResult removes the rows matching filter and reports how many it deleted
+func (s RethinkStore) FilterDeleteResult(filter map[string]interface{}, store string, opts ObjectStoreOptions) (result WriteResult, err error) {
+	term, err := s.selectTerm(store, filter, opts, false)
+	if err != nil {
+		return
+	}
+	res, err := s.runWrite(term.Delete(r.DeleteOpts{Durability: "hard"}))
+	if err != nil {
+		return
+	}
+	result.Matched = res.Deleted + res.Errors
+	result.Deleted = res.Deleted
+	result.Errors, result.FirstError = res.Errors, res.FirstError
+	return
+}
+
+// BatchFilterDeleteResult removes rows matching any of the filters and reports how many it deleted
+func (s RethinkStore) BatchFilterDeleteResult(filter []map[string]interface{}, store string, opts ObjectStoreOptions) (result WriteResult, err error) {
+	for _, f := range filter {
+		deleted, err := s.FilterDeleteResult(f, store, opts)
+		result.add(deleted)
+		if err != nil {
+			return result, err
+		}
+	}
+	return
+}
+
+// BatchDeleteResult removes rows by key, keys which do not exist are skipped
+func (s RethinkStore) BatchDeleteResult(ids []interface{}, store string, opts ObjectStoreOptions) (result WriteResult, err error) {
+	keys := rethinkBatchKeys(ids, &result)
+	if len(keys) == 0 {
+		return
+	}
+	res, err := s.runWrite(r.DB(s.Database).Table(store).GetAll(keys...).Delete(r.DeleteOpts{Durability: "hard"}))
+	if err != nil {
+		return
+	}
+	result.Matched = res.Deleted + res.Errors
+	result.Deleted = res.Deleted
+	result.Skipped = len(keys) - result.Matched
+	result.Errors, result.FirstError = res.Errors, res.FirstError
+	return
+}
+
+// BatchUpdateResult merges data[i] into the row with ids[i], the keys which have no row fail with
+// ErrNotFound while the other rows are updated. data[i] may be an UpdateSpec
+func (s RethinkStore) BatchUpdateResult(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) (result WriteResult, err error) {
+	if len(ids) != len(data) {
+		return result, fmt.Errorf("gostore: %d ids and %d documents to update", len(ids), len(data))
+	}
+	var keys []interface{}
+	updates := make(map[string]interface{}, len(ids))
+	for i, id := range ids {
+		key, err := batchKey(id)
+		if err != nil {
+			result.fail(fmt.Sprint(id), err)
+			continue
+		}
+		if _, ok := updates[key]; ok {
+			//a key given twice sees its first update
+			continue
+		}
+		if updates[key], err = rethinkUpdate(data[i]); err != nil {
+			return result, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return
+	}
+	res, err := s.runWrite(r.DB(s.Database).Table(store).GetAll(keys...).Update(func(row r.Term) interface{} {
+		args := make([]interface{}, 0, len(keys)*2+1)
+		for _, key := range keys {
+			args = append(args, row.Field("id").Eq(key), updates[key.(string)])
+		}
+		return r.Branch(append(args, nil)...)
+	}, r.UpdateOpts{Durability: "hard", ReturnChanges: "always"}))
+	if err != nil {
+		return
+	}
+	result.Updated = res.Replaced + res.Updated
+	result.Unchanged = res.Unchanged
+	found := make(map[string]bool, len(res.Changes))
+	for _, change := range res.Changes {
+		key := fmt.Sprint(change.OldVal["id"])
+		found[key] = true
+		if change.Error != "" {
+			result.fail(key, errors.New(change.Error))
+		}
+	}
+	result.Matched = len(found)
+	for _, key := range keys {
+		if !found[key.(string)] {
+			result.fail(key.(string), ErrNotFound)
+		}
+	}
+	return
+}
+
+// rethinkBatchKeys returns the distinct keys of a batch write, the invalid ones fail in result
+func rethinkBatchKeys(ids []interface{}, result *WriteResult) []interface{} {
+	var keys []interface{}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		key, err := batchKey(id)
+		switch {
+		case err != nil:
+			result.fail(fmt.Sprint(id), err)
+		case !seen[key]:
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// rethinkWriteResponse is the response of a write returning the changes of every row it selected
+type rethinkWriteResponse struct {
+	Deleted    int    `gorethink:"deleted"`
+	Replaced   int    `gorethink:"replaced"`
+	Updated    int    `gorethink:"updated"`
+	Unchanged  int    `gorethink:"unchanged"`
+	Errors     int    `gorethink:"errors"`
+	FirstError string `gorethink:"first_error"`
+	Changes    []struct {
+		OldVal map[string]interface{} `gorethink:"old_val"`
+		Error  string                 `gorethink:"error"`
+	} `gorethink:"changes"`
+}
+
+// runWrite runs a write, unlike RunWrite the rows it failed on do not fail it
+func (s RethinkStore) runWrite(term r.Term) (res rethinkWriteResponse, err error) {
+	cursor, err := term.Run(s.Session)
+	if err != nil {
+		return
+	}
+	defer cursor.Close()
+	err = cursor.One(&res)
+	return
+}
@@ -0,0 +1,134 @@
+package gostore
+
+import (
+	"testing"
+
+	r "github.com/gorethink/gorethink"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRethinkFilterWrites(t *testing.T) {
+	Convey("Giving a rethink store", t, func() {
+		mock := r.NewMock()
+		store := RethinkStore{mock, "gostore_test"}
+		filter := map[string]interface{}{"kind": "thing"}
+		table := r.DB("gostore_test").Table(collection)
+		predicate, _ := store.transformFilter(filter)
+		matching := table.Filter(predicate)
+		doc := map[string]interface{}{"rating": 5}
+		Convey("FilterUpdate only updates the rows matching the filter", func() {
+			mock.On(matching.Update(doc, r.UpdateOpts{Durability: "soft"})).Return(map[string]interface{}{"replaced": 2, "unchanged": 1}, nil)
+			So(store.FilterUpdate(filter, doc, collection, nil), ShouldBeNil)
+			result, err := store.FilterUpdateResult(filter, doc, collection, nil, WriteOptions{})
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, WriteResult{Matched: 3, Updated: 2, Unchanged: 1})
+		})
+		Convey("Filter writes select rows through an index", func() {
+			opts := DefaultObjectStoreOptions{Index: map[string][]string{"kind": {}}}
+			indexed := table.GetAllByIndex("kind", "thing").Filter(predicate)
+			mock.On(indexed.Update(doc, r.UpdateOpts{Durability: "soft"})).Return(map[string]interface{}{"replaced": 1}, nil)
+			result, err := store.FilterUpdateResult(filter, doc, collection, opts, WriteOptions{})
+			So(err, ShouldBeNil)
+			So(result.Updated, ShouldEqual, 1)
+		})
+		Convey("An UpdateSpec sets and removes paths", func() {
+			spec := UpdateSpec{Set: map[string]interface{}{"food.cooked": true}, Unset: []string{"rating"}}
+			mock.On(matching.Update(map[string]interface{}{
+				"food":   map[string]interface{}{"cooked": r.Literal(true)},
+				"rating": r.Literal(),
+			}, r.UpdateOpts{Durability: "soft"})).Return(map[string]interface{}{"replaced": 1}, nil)
+			So(store.FilterUpdate(filter, spec, collection, nil), ShouldBeNil)
+			_, err := store.FilterUpdateResult(filter, UpdateSpec{Unset: []string{"food..cooked"}}, collection, nil, WriteOptions{})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("A dry run counts the rows it would change", func() {
+			mock.On(r.Expr(map[string]interface{}{
+				"matched": matching.Count(),
+				"changed": matching.Filter(func(row r.Term) interface{} {
+					return row.Ne(row.Merge(doc))
+				}).Count(),
+			})).Return(map[string]interface{}{"matched": 3, "changed": 2}, nil)
+			result, err := store.FilterUpdateResult(filter, doc, collection, nil, WriteOptions{DryRun: true})
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, WriteResult{Matched: 3, Updated: 2, Unchanged: 1})
+		})
+		Convey("FilterReplace keeps the id of the rows it replaces", func() {
+			mock.On(matching.Replace(func(row r.Term) interface{} {
+				return r.Expr(doc).Merge(map[string]interface{}{"id": row.Field("id")})
+			}, r.ReplaceOpts{Durability: "soft"})).Return(map[string]interface{}{"replaced": 1, "errors": 1, "first_error": "boom"}, nil)
+			result, err := store.FilterReplaceResult(filter, doc, collection, nil, WriteOptions{})
+			So(err, ShouldNotBeNil)
+			So(result, ShouldResemble, WriteResult{Matched: 2, Replaced: 1, Errors: 1, FirstError: "boom"})
+		})
+		Convey("Typed filter values only update the rows they match", func() {
+			typed := map[string]interface{}{"active": true, "rating": "<3"}
+			predicate, err := store.transformFilter(typed)
+			So(err, ShouldBeNil)
+			mock.On(table.Filter(predicate).Update(doc, r.UpdateOpts{Durability: "soft"})).Return(map[string]interface{}{"replaced": 1}, nil)
+			result, err := store.FilterUpdateResult(typed, doc, collection, nil, WriteOptions{})
+			So(err, ShouldBeNil)
+			So(result.Updated, ShouldEqual, 1)
+			_, err = store.FilterUpdateResult(map[string]interface{}{"rating": []int{1}}, doc, collection, nil, WriteOptions{})
+			So(err, ShouldHaveSameTypeAs, &FilterError{})
+		})
+		Convey("An empty filter only rewrites the table when asked to", func() {
+			_, err := store.FilterUpdateResult(nil, doc, collection, nil, WriteOptions{})
+			So(err, ShouldEqual, ErrEmptyFilter)
+			So(store.FilterReplace(map[string]interface{}{}, doc, collection, nil), ShouldEqual, ErrEmptyFilter)
+			mock.On(table.Update(doc, r.UpdateOpts{Durability: "soft"})).Return(map[string]interface{}{"replaced": 4}, nil)
+			result, err := store.FilterUpdateResult(nil, doc, collection, nil, WriteOptions{All: true})
+			So(err, ShouldBeNil)
+			So(result.Updated, ShouldEqual, 4)
+		})
+	})
+}
+
+func TestRethinkWriteResults(t *testing.T) {
+	Convey("Giving a rethink store", t, func() {
+		mock := r.NewMock()
+		store := RethinkStore{mock, "gostore_test"}
+		table := r.DB("gostore_test").Table(collection)
+		Convey("BatchUpdateResult lists the rows it did not update", func() {
+			data := []interface{}{
+				map[string]interface{}{"name": "First"},
+				map[string]interface{}{"name": "Missing"},
+				map[string]interface{}{"rating": "bad"},
+			}
+			mock.On(table.GetAll("1", "2", "3").Update(func(row r.Term) interface{} {
+				return r.Branch(row.Field("id").Eq("1"), data[0], row.Field("id").Eq("2"), data[1], row.Field("id").Eq("3"), data[2], nil)
+			}, r.UpdateOpts{Durability: "hard", ReturnChanges: "always"})).Return(map[string]interface{}{
+				"replaced": 1, "errors": 1, "first_error": "bad rating",
+				"changes": []interface{}{
+					map[string]interface{}{"old_val": map[string]interface{}{"id": "1"}, "new_val": map[string]interface{}{"id": "1", "name": "First"}},
+					map[string]interface{}{"old_val": map[string]interface{}{"id": "3"}, "new_val": map[string]interface{}{"id": "3"}, "error": "bad rating"},
+				},
+			}, nil)
+			result, err := store.BatchUpdateResult([]interface{}{"1", "2", "3", 4}, append(data, nil), collection, nil)
+			So(err, ShouldBeNil)
+			So(result.Matched, ShouldEqual, 2)
+			So(result.Updated, ShouldEqual, 1)
+			So(result.Skipped, ShouldEqual, 1)
+			So(result.Errors, ShouldEqual, 2)
+			So(result.FirstError, ShouldEqual, "gostore: invalid key 4")
+			So(len(result.Failed), ShouldEqual, 3)
+			So(result.Failed[1].Error(), ShouldEqual, "3: bad rating")
+			So(result.Failed[2], ShouldResemble, WriteError{Key: "2", Err: ErrNotFound})
+		})
+		Convey("BatchDeleteResult counts the keys which have no row as skipped", func() {
+			mock.On(table.GetAll("1", "2").Delete(r.DeleteOpts{Durability: "hard"})).Return(map[string]interface{}{"deleted": 1}, nil)
+			result, err := store.BatchDeleteResult([]interface{}{"1", "2", "1"}, collection, nil)
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, WriteResult{Matched: 1, Deleted: 1, Skipped: 1})
+		})
+		Convey("BatchFilterDeleteResult sums the rows deleted by each filter", func() {
+			for kind, deleted := range map[string]int{"thing": 2, "fish": 1} {
+				filter := map[string]interface{}{"kind": kind}
+				predicate, _ := store.transformFilter(filter)
+				mock.On(table.Filter(predicate).Delete(r.DeleteOpts{Durability: "hard"})).Return(map[string]interface{}{"deleted": deleted}, nil)
+			}
+			result, err := store.BatchFilterDeleteResult([]map[string]interface{}{{"kind": "thing"}, {"kind": "fish"}}, collection, nil)
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, WriteResult{Matched: 3, Deleted: 3})
+		})
+	})
+}
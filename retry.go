@@ -0,0 +1,564 @@
+package gostore
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	r "github.com/gorethink/gorethink"
+	"github.com/lib/pq"
+)
+
+// RetryOptions configures a RetryStore
+type RetryOptions struct {
+	// MaxRetries limits the retries of a call after its first attempt, 3 when 0. A negative value
+	// disables retries
+	MaxRetries int
+	// InitialInterval is the delay before the first retry, 100ms when 0
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between retries, 2s when 0
+	MaxInterval time.Duration
+	// MaxElapsedTime stops retrying a call once it has taken this long, 10s when 0. A negative
+	// value removes the limit
+	MaxElapsedTime time.Duration
+	// Jitter randomizes each delay by up to this fraction of it, 0.5 when 0. A negative value
+	// disables jitter
+	Jitter float64
+	// Retryable reports whether an error is transient. When nil the store classifies its own errors
+	// if it is a RetryClassifier, else IsTransientError is used
+	Retryable func(err error) bool
+	// OnRetry is called before sleeping ahead of each retry, when nil retries are logged as warnings
+	OnRetry func(op string, attempt int, err error, delay time.Duration)
+}
+
+// RetryClassifier is implemented by stores which know which of their errors are transient
+type RetryClassifier interface {
+	Retryable(err error) bool
+}
+
+// RetryStore retries calls to a store which fail with transient errors, waiting an exponentially
+// growing, jittered delay between attempts. Only idempotent calls are retried: reads, Update,
+// Replace, Delete and their filter and batch variants, and Save with a key. A retried Save may
+// return ErrDuplicatePk when the attempt which failed was applied. Save without a key, SaveAll,
+// BatchInsert, CreateDatabase and CreateTable are never retried. The context methods stop
+// retrying once their context is done
+type RetryStore struct {
+	store     ContextObjectStore
+	inner     ObjectStore
+	opts      RetryOptions
+	retryable func(err error) bool
+}
+
+// NewRetryStore wraps a store with retries
+func NewRetryStore(store ObjectStore, opts RetryOptions) RetryStore {
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.InitialInterval == 0 {
+		opts.InitialInterval = 100 * time.Millisecond
+	}
+	if opts.MaxInterval == 0 {
+		opts.MaxInterval = 2 * time.Second
+	}
+	if opts.MaxElapsedTime == 0 {
+		opts.MaxElapsedTime = 10 * time.Second
+	}
+	if opts.Jitter == 0 {
+		opts.Jitter = backoff.DefaultRandomizationFactor
+	}
+	if opts.OnRetry == nil {
+		opts.OnRetry = func(op string, attempt int, err error, delay time.Duration) {
+			logger.Warn("retrying store operation", "operation", op, "attempt", attempt, "delay", delay, "err", err)
+		}
+	}
+	retryable := opts.Retryable
+	if retryable == nil {
+		retryable = retryClassifier(store)
+	}
+	return RetryStore{
+		store:     NewContextAdapter(store),
+		inner:     store,
+		opts:      opts,
+		retryable: retryable,
+	}
+}
+
+// retryClassifier finds the classifier of a store, looking through decorators which expose the
+// store they wrap
+func retryClassifier(store ObjectStore) func(err error) bool {
+	for store != nil {
+		if c, ok := store.(RetryClassifier); ok {
+			return c.Retryable
+		}
+		d, ok := store.(interface{ Store() ObjectStore })
+		if !ok {
+			break
+		}
+		store = d.Store()
+	}
+	return IsTransientError
+}
+
+// IsTransientError reports whether err is a network failure which may not recur, such as a dropped
+// connection or a timeout
+func IsTransientError(err error) bool {
+	switch err {
+	case nil, context.Canceled, context.DeadlineExceeded:
+		return false
+	case io.EOF, io.ErrUnexpectedEOF, driver.ErrBadConn, syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED, syscall.EPIPE:
+		return true
+	}
+	switch e := err.(type) {
+	case *net.OpError:
+		return true
+	case net.Error:
+		return e.Timeout()
+	}
+	return false
+}
+
+// Retryable reports whether a postgres error is transient: a serialization failure or deadlock,
+// a connection failure, too many connections or a server shutting down
+func (s PostgresObjectStore) Retryable(err error) bool {
+	if pqErr, ok := err.(*pq.Error); ok {
+		switch {
+		case IsSerializationFailure(err), pqErr.Code == "53300":
+			return true
+		case strings.HasPrefix(string(pqErr.Code), "08"), strings.HasPrefix(string(pqErr.Code), "57P"):
+			return true
+		}
+		return false
+	}
+	return IsTransientError(err)
+}
+
+// Retryable reports whether a rethinkdb error is transient: a dropped connection, an unavailable
+// table or a timeout. Indeterminate writes are not retried
+func (s RethinkStore) Retryable(err error) bool {
+	switch err {
+	case r.ErrConnectionClosed, r.ErrNoConnections, r.ErrNoConnectionsStarted, r.ErrQueryTimeout:
+		return true
+	}
+	switch err.(type) {
+	case r.RQLConnectionError, r.RQLOpFailedError, r.RQLTimeoutError:
+		return true
+	}
+	return IsTransientError(err)
+}
+
+// retry calls fn until it succeeds, fails with an error which is not retryable or the retries run out
+func (s RetryStore) retry(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	if s.opts.MaxRetries < 0 {
+		return fn(ctx)
+	}
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = s.opts.InitialInterval
+	b.MaxInterval = s.opts.MaxInterval
+	b.MaxElapsedTime = s.opts.MaxElapsedTime
+	if b.MaxElapsedTime < 0 {
+		b.MaxElapsedTime = 0
+	}
+	b.RandomizationFactor = s.opts.Jitter
+	if b.RandomizationFactor < 0 {
+		b.RandomizationFactor = 0
+	}
+	attempt := 0
+	return backoff.RetryNotify(func() error {
+		attempt++
+		err := fn(ctx)
+		if err != nil && (ctx.Err() != nil || !s.retryable(err)) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(backoff.WithMaxRetries(b, uint64(s.opts.MaxRetries)), ctx), func(err error, delay time.Duration) {
+		s.opts.OnRetry(op, attempt, err, delay)
+	})
+}
+
+// retryRows retries a call which returns rows, the rows themselves are read once
+func (s RetryStore) retryRows(ctx context.Context, op string, fn func(ctx context.Context) (ObjectRows, error)) (rows ObjectRows, err error) {
+	err = s.retry(ctx, op, func(ctx context.Context) (err error) {
+		rows, err = fn(ctx)
+		return
+	})
+	return
+}
+
+// Store returns the wrapped store
+func (s RetryStore) Store() ObjectStore {
+	return s.inner
+}
+
+// Capabilities describes the wrapped store, RetryStore exposes the ObjectStore and
+// ContextObjectStore apis and the write results of the wrapped store
+func (s RetryStore) Capabilities() Capabilities {
+	c := decoratedCapabilities(s.inner)
+	c.Context = true
+	return c
+}
+
+func (s RetryStore) GetStore() interface{} {
+	return s.store.GetStore()
+}
+
+func (s RetryStore) Close() {
+	s.store.Close()
+}
+
+func (s RetryStore) CreateDatabaseContext(ctx context.Context) error {
+	return s.store.CreateDatabaseContext(ctx)
+}
+
+func (s RetryStore) CreateTableContext(ctx context.Context, table string, sample interface{}) error {
+	return s.store.CreateTableContext(ctx, table, sample)
+}
+
+func (s RetryStore) StatsContext(ctx context.Context, store string) (data map[string]interface{}, err error) {
+	err = s.retry(ctx, "Stats", func(ctx context.Context) (err error) {
+		data, err = s.store.StatsContext(ctx, store)
+		return
+	})
+	return
+}
+
+func (s RetryStore) AllContext(ctx context.Context, count int, skip int, store string) (ObjectRows, error) {
+	return s.retryRows(ctx, "All", func(ctx context.Context) (ObjectRows, error) {
+		return s.store.AllContext(ctx, count, skip, store)
+	})
+}
+
+func (s RetryStore) AllCursorContext(ctx context.Context, store string) (ObjectRows, error) {
+	return s.retryRows(ctx, "AllCursor", func(ctx context.Context) (ObjectRows, error) {
+		return s.store.AllCursorContext(ctx, store)
+	})
+}
+
+func (s RetryStore) AllWithinRangeContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.retryRows(ctx, "AllWithinRange", func(ctx context.Context) (ObjectRows, error) {
+		return s.store.AllWithinRangeContext(ctx, filter, count, skip, store, opts)
+	})
+}
+
+func (s RetryStore) SinceContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.retryRows(ctx, "Since", func(ctx context.Context) (ObjectRows, error) {
+		return s.store.SinceContext(ctx, id, count, skip, store)
+	})
+}
+
+func (s RetryStore) BeforeContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.retryRows(ctx, "Before", func(ctx context.Context) (ObjectRows, error) {
+		return s.store.BeforeContext(ctx, id, count, skip, store)
+	})
+}
+
+func (s RetryStore) FilterSinceContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.retryRows(ctx, "FilterSince", func(ctx context.Context) (ObjectRows, error) {
+		return s.store.FilterSinceContext(ctx, id, filter, count, skip, store, opts)
+	})
+}
+
+func (s RetryStore) FilterBeforeContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.retryRows(ctx, "FilterBefore", func(ctx context.Context) (ObjectRows, error) {
+		return s.store.FilterBeforeContext(ctx, id, filter, count, skip, store, opts)
+	})
+}
+
+func (s RetryStore) FilterBeforeCountContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (cnt int64, err error) {
+	err = s.retry(ctx, "FilterBeforeCount", func(ctx context.Context) (err error) {
+		cnt, err = s.store.FilterBeforeCountContext(ctx, id, filter, count, skip, store, opts)
+		return
+	})
+	return
+}
+
+func (s RetryStore) GetContext(ctx context.Context, key string, store string, dst interface{}) error {
+	return s.retry(ctx, "Get", func(ctx context.Context) error {
+		return s.store.GetContext(ctx, key, store, dst)
+	})
+}
+
+func (s RetryStore) SaveContext(ctx context.Context, key, store string, src interface{}) (saved string, err error) {
+	if key == "" {
+		return s.store.SaveContext(ctx, key, store, src)
+	}
+	err = s.retry(ctx, "Save", func(ctx context.Context) (err error) {
+		saved, err = s.store.SaveContext(ctx, key, store, src)
+		return
+	})
+	return
+}
+
+func (s RetryStore) SaveAllContext(ctx context.Context, store string, src ...interface{}) ([]string, error) {
+	return s.store.SaveAllContext(ctx, store, src...)
+}
+
+func (s RetryStore) UpdateContext(ctx context.Context, key string, store string, src interface{}) error {
+	return s.retry(ctx, "Update", func(ctx context.Context) error {
+		return s.store.UpdateContext(ctx, key, store, src)
+	})
+}
+
+func (s RetryStore) ReplaceContext(ctx context.Context, key string, store string, src interface{}) error {
+	return s.retry(ctx, "Replace", func(ctx context.Context) error {
+		return s.store.ReplaceContext(ctx, key, store, src)
+	})
+}
+
+func (s RetryStore) DeleteContext(ctx context.Context, key string, store string) error {
+	return s.retry(ctx, "Delete", func(ctx context.Context) error {
+		return s.store.DeleteContext(ctx, key, store)
+	})
+}
+
+func (s RetryStore) FilterUpdateContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.retry(ctx, "FilterUpdate", func(ctx context.Context) error {
+		return s.store.FilterUpdateContext(ctx, filter, src, store, opts)
+	})
+}
+
+func (s RetryStore) FilterReplaceContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.retry(ctx, "FilterReplace", func(ctx context.Context) error {
+		return s.store.FilterReplaceContext(ctx, filter, src, store, opts)
+	})
+}
+
+func (s RetryStore) FilterGetContext(ctx context.Context, filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	return s.retry(ctx, "FilterGet", func(ctx context.Context) error {
+		return s.store.FilterGetContext(ctx, filter, store, dst, opts)
+	})
+}
+
+func (s RetryStore) FilterGetAllContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.retryRows(ctx, "FilterGetAll", func(ctx context.Context) (ObjectRows, error) {
+		return s.store.FilterGetAllContext(ctx, filter, count, skip, store, opts)
+	})
+}
+
+func (s RetryStore) QueryContext(ctx context.Context, filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (rows ObjectRows, agg AggregateResult, err error) {
+	rows, err = s.retryRows(ctx, "Query", func(ctx context.Context) (rows ObjectRows, err error) {
+		rows, agg, err = s.store.QueryContext(ctx, filter, aggregates, count, skip, store, opts)
+		return
+	})
+	return
+}
+
+func (s RetryStore) FilterDeleteContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.retry(ctx, "FilterDelete", func(ctx context.Context) error {
+		return s.store.FilterDeleteContext(ctx, filter, store, opts)
+	})
+}
+
+func (s RetryStore) FilterCountContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) (cnt int64, err error) {
+	err = s.retry(ctx, "FilterCount", func(ctx context.Context) (err error) {
+		cnt, err = s.store.FilterCountContext(ctx, filter, store, opts)
+		return
+	})
+	return
+}
+
+func (s RetryStore) GetByFieldContext(ctx context.Context, name, val, store string, dst interface{}) error {
+	return s.retry(ctx, "GetByField", func(ctx context.Context) error {
+		return s.store.GetByFieldContext(ctx, name, val, store, dst)
+	})
+}
+
+func (s RetryStore) GetByFieldsByFieldContext(ctx context.Context, name, val, store string, fields []string, dst interface{}) error {
+	return s.retry(ctx, "GetByFieldsByField", func(ctx context.Context) error {
+		return s.store.GetByFieldsByFieldContext(ctx, name, val, store, fields, dst)
+	})
+}
+
+func (s RetryStore) BatchDeleteContext(ctx context.Context, ids []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.retry(ctx, "BatchDelete", func(ctx context.Context) error {
+		return s.store.BatchDeleteContext(ctx, ids, store, opts)
+	})
+}
+
+func (s RetryStore) BatchUpdateContext(ctx context.Context, ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.retry(ctx, "BatchUpdate", func(ctx context.Context) error {
+		return s.store.BatchUpdateContext(ctx, ids, data, store, opts)
+	})
+}
+
+func (s RetryStore) BatchFilterDeleteContext(ctx context.Context, filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.retry(ctx, "BatchFilterDelete", func(ctx context.Context) error {
+		return s.store.BatchFilterDeleteContext(ctx, filter, store, opts)
+	})
+}
+
+func (s RetryStore) BatchInsertContext(ctx context.Context, data []interface{}, store string, opts ObjectStoreOptions) ([]string, error) {
+	return s.store.BatchInsertContext(ctx, data, store, opts)
+}
+
+// The ObjectStore api retries until MaxElapsedTime
+
+func (s RetryStore) CreateDatabase() error {
+	return s.CreateDatabaseContext(context.Background())
+}
+
+func (s RetryStore) CreateTable(table string, sample interface{}) error {
+	return s.CreateTableContext(context.Background(), table, sample)
+}
+
+func (s RetryStore) Stats(store string) (map[string]interface{}, error) {
+	return s.StatsContext(context.Background(), store)
+}
+
+func (s RetryStore) All(count int, skip int, store string) (ObjectRows, error) {
+	return s.AllContext(context.Background(), count, skip, store)
+}
+
+func (s RetryStore) AllCursor(store string) (ObjectRows, error) {
+	return s.AllCursorContext(context.Background(), store)
+}
+
+func (s RetryStore) AllWithinRange(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.AllWithinRangeContext(context.Background(), filter, count, skip, store, opts)
+}
+
+func (s RetryStore) Since(id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.SinceContext(context.Background(), id, count, skip, store)
+}
+
+func (s RetryStore) Before(id string, count int, skip int, store string) (ObjectRows, error) {
+	return s.BeforeContext(context.Background(), id, count, skip, store)
+}
+
+func (s RetryStore) FilterSince(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.FilterSinceContext(context.Background(), id, filter, count, skip, store, opts)
+}
+
+func (s RetryStore) FilterBefore(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.FilterBeforeContext(context.Background(), id, filter, count, skip, store, opts)
+}
+
+func (s RetryStore) FilterBeforeCount(id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.FilterBeforeCountContext(context.Background(), id, filter, count, skip, store, opts)
+}
+
+func (s RetryStore) Get(key string, store string, dst interface{}) error {
+	return s.GetContext(context.Background(), key, store, dst)
+}
+
+func (s RetryStore) Save(key, store string, src interface{}) (string, error) {
+	return s.SaveContext(context.Background(), key, store, src)
+}
+
+func (s RetryStore) SaveAll(store string, src ...interface{}) ([]string, error) {
+	return s.SaveAllContext(context.Background(), store, src...)
+}
+
+func (s RetryStore) Update(key string, store string, src interface{}) error {
+	return s.UpdateContext(context.Background(), key, store, src)
+}
+
+func (s RetryStore) Replace(key string, store string, src interface{}) error {
+	return s.ReplaceContext(context.Background(), key, store, src)
+}
+
+func (s RetryStore) Delete(key string, store string) error {
+	return s.DeleteContext(context.Background(), key, store)
+}
+
+func (s RetryStore) FilterUpdate(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.FilterUpdateContext(context.Background(), filter, src, store, opts)
+}
+
+func (s RetryStore) FilterReplace(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.FilterReplaceContext(context.Background(), filter, src, store, opts)
+}
+
+func (s RetryStore) FilterGet(filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	return s.FilterGetContext(context.Background(), filter, store, dst, opts)
+}
+
+func (s RetryStore) FilterGetAll(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	return s.FilterGetAllContext(context.Background(), filter, count, skip, store, opts)
+}
+
+func (s RetryStore) Query(filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error) {
+	return s.QueryContext(context.Background(), filter, aggregates, count, skip, store, opts)
+}
+
+func (s RetryStore) FilterDelete(filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.FilterDeleteContext(context.Background(), filter, store, opts)
+}
+
+func (s RetryStore) FilterCount(filter map[string]interface{}, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.FilterCountContext(context.Background(), filter, store, opts)
+}
+
+func (s RetryStore) GetByField(name, val, store string, dst interface{}) error {
+	return s.GetByFieldContext(context.Background(), name, val, store, dst)
+}
+
+func (s RetryStore) GetByFieldsByField(name, val, store string, fields []string, dst interface{}) error {
+	return s.GetByFieldsByFieldContext(context.Background(), name, val, store, fields, dst)
+}
+
+func (s RetryStore) BatchDelete(ids []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.BatchDeleteContext(context.Background(), ids, store, opts)
+}
+
+func (s RetryStore) BatchUpdate(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.BatchUpdateContext(context.Background(), ids, data, store, opts)
+}
+
+func (s RetryStore) BatchFilterDelete(filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.BatchFilterDeleteContext(context.Background(), filter, store, opts)
+}
+
+func (s RetryStore) BatchInsert(data []interface{}, store string, opts ObjectStoreOptions) ([]string, error) {
+	return s.BatchInsertContext(context.Background(), data, store, opts)
+}
+
+// The write results of the wrapped store are retried like the writes above, a retried call reports
+// the rows written by its last attempt
+
+// retryResult retries an operation which reports its write
+func (s RetryStore) retryResult(op string, fn func(w WriteResultStore) (WriteResult, error)) (result WriteResult, err error) {
+	w, err := writeResultStore(s.inner)
+	if err != nil {
+		return
+	}
+	err = s.retry(context.Background(), op, func(ctx context.Context) (err error) {
+		result, err = fn(w)
+		return
+	})
+	return
+}
+
+func (s RetryStore) BatchDeleteResult(ids []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	return s.retryResult("BatchDeleteResult", func(w WriteResultStore) (WriteResult, error) {
+		return w.BatchDeleteResult(ids, store, opts)
+	})
+}
+
+func (s RetryStore) BatchUpdateResult(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	return s.retryResult("BatchUpdateResult", func(w WriteResultStore) (WriteResult, error) {
+		return w.BatchUpdateResult(ids, data, store, opts)
+	})
+}
+
+func (s RetryStore) BatchFilterDeleteResult(filter []map[string]interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	return s.retryResult("BatchFilterDeleteResult", func(w WriteResultStore) (WriteResult, error) {
+		return w.BatchFilterDeleteResult(filter, store, opts)
+	})
+}
+
+func (s RetryStore) FilterDeleteResult(filter map[string]interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	return s.retryResult("FilterDeleteResult", func(w WriteResultStore) (WriteResult, error) {
+		return w.FilterDeleteResult(filter, store, opts)
+	})
+}
+
+func (s RetryStore) FilterUpdateResult(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions, wopts WriteOptions) (WriteResult, error) {
+	return s.retryResult("FilterUpdateResult", func(w WriteResultStore) (WriteResult, error) {
+		return w.FilterUpdateResult(filter, src, store, opts, wopts)
+	})
+}
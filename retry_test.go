@@ -0,0 +1,147 @@
+package gostore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	r "github.com/gorethink/gorethink"
+	"github.com/lib/pq"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// flakyStore fails the first calls which reach it with err
+type flakyStore struct {
+	ObjectStore
+	failures *int
+	calls    *int
+	err      error
+}
+
+func (s flakyStore) fail() error {
+	*s.calls++
+	if *s.failures > 0 {
+		*s.failures--
+		return s.err
+	}
+	return nil
+}
+
+func (s flakyStore) Get(key string, store string, dst interface{}) error {
+	if err := s.fail(); err != nil {
+		return err
+	}
+	return s.ObjectStore.Get(key, store, dst)
+}
+
+func (s flakyStore) Save(key, store string, src interface{}) (string, error) {
+	if err := s.fail(); err != nil {
+		return "", err
+	}
+	return s.ObjectStore.Save(key, store, src)
+}
+
+// flakyResults is a flakyStore whose BatchDeleteResult fails too
+type flakyResults struct {
+	flakyStore
+	WriteResultStore
+}
+
+func (s flakyResults) BatchDeleteResult(ids []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error) {
+	if err := s.fail(); err != nil {
+		return WriteResult{}, err
+	}
+	return s.WriteResultStore.BatchDeleteResult(ids, store, opts)
+}
+
+func (s flakyStore) FilterGetAll(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return s.ObjectStore.FilterGetAll(filter, count, skip, store, opts)
+}
+
+func TestRetryStore(t *testing.T) {
+	Convey("Giving a retrying store over a flaky memory store", t, func() {
+		failures, calls := 2, 0
+		mem := NewMemoryStore()
+		_, err := mem.Save("1", collection, map[string]interface{}{"id": "1", "kind": "thing"})
+		So(err, ShouldBeNil)
+		var retries []int
+		opts := RetryOptions{
+			InitialInterval: time.Millisecond,
+			OnRetry: func(op string, attempt int, err error, delay time.Duration) {
+				retries = append(retries, attempt)
+			},
+		}
+		flaky := flakyStore{mem, &failures, &calls, io.ErrUnexpectedEOF}
+		store := NewRetryStore(flaky, opts)
+		var row map[string]interface{}
+		Convey("Idempotent calls are retried until they succeed", func() {
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			So(row["kind"], ShouldEqual, "thing")
+			So(calls, ShouldEqual, 3)
+			So(retries, ShouldResemble, []int{1, 2})
+			So(rowIds(store.FilterGetAll(map[string]interface{}{"kind": "thing"}, 0, 0, collection, nil)), ShouldResemble, []string{"1"})
+		})
+		Convey("Retries are limited", func() {
+			failures = 10
+			So(store.Get("1", collection, &row), ShouldEqual, io.ErrUnexpectedEOF)
+			So(calls, ShouldEqual, 4)
+		})
+		Convey("Errors which are not transient are returned at once", func() {
+			failures = 0
+			So(store.Get("9", collection, &row), ShouldEqual, ErrNotFound)
+			So(calls, ShouldEqual, 1)
+		})
+		Convey("Save is retried only with a key", func() {
+			_, err := store.Save("2", collection, map[string]interface{}{"id": "2"})
+			So(err, ShouldBeNil)
+			So(calls, ShouldEqual, 3)
+			failures = 1
+			calls = 0
+			_, err = store.Save("", collection, map[string]interface{}{"kind": "new"})
+			So(err, ShouldEqual, io.ErrUnexpectedEOF)
+			So(calls, ShouldEqual, 1)
+		})
+		Convey("Write results are retried", func() {
+			_, err := store.FilterDeleteResult(map[string]interface{}{"id": "1"}, collection, nil)
+			So(err, ShouldEqual, ErrNotImplemented)
+			store = NewRetryStore(flakyResults{flaky, mem}, opts)
+			result, err := store.BatchDeleteResult([]interface{}{"1"}, collection, nil)
+			So(err, ShouldBeNil)
+			So(result.Deleted, ShouldEqual, 1)
+			So(calls, ShouldEqual, 3)
+		})
+		Convey("A custom classifier decides what is retried", func() {
+			opts.Retryable = func(err error) bool { return false }
+			store = NewRetryStore(flaky, opts)
+			So(store.Get("1", collection, &row), ShouldEqual, io.ErrUnexpectedEOF)
+			So(calls, ShouldEqual, 1)
+		})
+		Convey("Context methods stop retrying once their context is done", func() {
+			failures = 10
+			opts.InitialInterval = time.Hour
+			store = NewRetryStore(flaky, opts)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			So(store.GetContext(ctx, "1", collection, &row), ShouldEqual, io.ErrUnexpectedEOF)
+			So(calls, ShouldEqual, 1)
+		})
+	})
+	Convey("Backends classify their transient errors", t, func() {
+		So(IsTransientError(io.EOF), ShouldBeTrue)
+		So(IsTransientError(context.Canceled), ShouldBeFalse)
+		So(IsTransientError(errors.New("boom")), ShouldBeFalse)
+		pg := PostgresObjectStore{}
+		So(pg.Retryable(&pq.Error{Code: "40001"}), ShouldBeTrue)
+		So(pg.Retryable(&pq.Error{Code: "08006"}), ShouldBeTrue)
+		So(pg.Retryable(&pq.Error{Code: "23505"}), ShouldBeFalse)
+		rethink := RethinkStore{}
+		So(rethink.Retryable(r.ErrConnectionClosed), ShouldBeTrue)
+		So(rethink.Retryable(ErrNotFound), ShouldBeFalse)
+		So(retryClassifier(NewCachedStore(pg, CacheOptions{}))(&pq.Error{Code: "40P01"}), ShouldBeTrue)
+	})
+}
@@ -1,7 +1,9 @@
 package gostore
 
 import (
+	"context"
 	"encoding/json"
+	"net/url"
 	"os"
 
 	"github.com/mgutz/logxi/v1"
@@ -11,11 +13,29 @@ import (
 type ScribbleStore struct {
 	db   *scribble.Driver
 	path string
+	ctx  context.Context
+}
+
+func init() {
+	Register("scribble", DriverFunc(openScribble))
+}
+
+//openScribble opens scribble:///path/to/directory
+func openScribble(u *url.URL) (ObjectStore, error) {
+	path, err := urlPath(u)
+	if err != nil {
+		return nil, err
+	}
+	db, err := scribble.New(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &ScribbleStore{db: db, path: path}, nil
 }
 
 func NewScribbleStore(path string) *ScribbleStore {
 	if db, err := scribble.New(path, nil); err == nil {
-		return &ScribbleStore{db, path}
+		return &ScribbleStore{db: db, path: path}
 	} else {
 		log.Warn("cannot create scribble database", "err", err)
 	}
@@ -28,10 +48,11 @@ type ScribbleRows struct {
 	len  int
 }
 
-func (s ScribbleRows) LastError() error {
+func (s *ScribbleRows) LastError() error {
 	return nil
 }
-func (s ScribbleRows) Next(dst interface{}) (bool, error) {
+
+func (s *ScribbleRows) Next(dst interface{}) (bool, error) {
 	if s.i >= s.len {
 		return false, nil
 	}
@@ -42,16 +63,25 @@ func (s ScribbleRows) Next(dst interface{}) (bool, error) {
 	return true, nil
 }
 
-func (s ScribbleRows) NextRaw() ([]byte, bool) {
+func (s *ScribbleRows) NextRaw() ([]byte, bool) {
 	return nil, false
 }
 
-func (s ScribbleRows) Close() {
+func (s *ScribbleRows) Close() {
 	s.rows = nil
 	s.i = -1
 	s.len = -1
 }
 
+//Capabilities describes ScribbleStore, it only reads and writes rows by key
+func (s ScribbleStore) Capabilities() Capabilities {
+	return newCapabilities(s, "Stats", "AllCursor", "AllWithinRange", "Since", "Before",
+		"FilterSince", "FilterBefore", "FilterBeforeCount", "SaveAll", "Update", "Replace",
+		"FilterUpdate", "FilterReplace", "FilterGet", "FilterGetAll", "Query", "FilterDelete",
+		"FilterCount", "GetByField", "GetByFieldsByField", "BatchDelete", "BatchUpdate",
+		"BatchFilterDelete", "BatchInsert")
+}
+
 //Management Api
 func (s ScribbleStore) CreateDatabase() error {
 	return nil
@@ -65,11 +95,16 @@ func (s ScribbleStore) GetStore() interface{} {
 	return s.db
 }
 func (s ScribbleStore) Stats(store string) (map[string]interface{}, error) {
-	return nil, nil
+	return nil, ErrNotImplemented
 }
 
 //New Api
+
+//All reads count rows of a table after skip in key order
 func (s ScribbleStore) All(count int, skip int, store string) (ObjectRows, error) {
+	if err := s.ctxErr(); err != nil {
+		return nil, err
+	}
 	_rows, err := s.db.ReadAll(store)
 	if err != nil {
 		if _, ok := err.(*os.PathError); ok {
@@ -77,7 +112,14 @@ func (s ScribbleStore) All(count int, skip int, store string) (ObjectRows, error
 		}
 		return nil, err
 	}
-	return ScribbleRows{_rows, 0, len(_rows)}, nil
+	if skip > len(_rows) {
+		skip = len(_rows)
+	}
+	_rows = _rows[skip:]
+	if count > 0 && count < len(_rows) {
+		_rows = _rows[:count]
+	}
+	return &ScribbleRows{_rows, 0, len(_rows)}, nil
 }
 func (s ScribbleStore) AllCursor(store string) (ObjectRows, error) {
 	return nil, ErrNotImplemented
@@ -106,6 +148,9 @@ func (s ScribbleStore) FilterBeforeCount(id string, filter map[string]interface{
 }
 
 func (s ScribbleStore) Get(key string, store string, dst interface{}) error {
+	if err := s.ctxErr(); err != nil {
+		return err
+	}
 	err := s.db.Read(store, key, &dst)
 	if _, ok := err.(*os.PathError); ok {
 		return ErrNotFound
@@ -115,9 +160,18 @@ func (s ScribbleStore) Get(key string, store string, dst interface{}) error {
 }
 
 func (s ScribbleStore) Save(key, store string, src interface{}) (string, error) {
+	if err := s.ctxErr(); err != nil {
+		return "", err
+	}
+	watched, old := s.watchedRow(store, key)
 	if err := s.db.Write(store, key, src); err != nil {
 		return "", err
 	}
+	if watched {
+		if err := s.publish(store, key, old, src); err != nil {
+			return "", err
+		}
+	}
 	return key, nil
 }
 func (s ScribbleStore) SaveAll(store string, src ...interface{}) (keys []string, err error) {
@@ -130,7 +184,17 @@ func (s ScribbleStore) Replace(key string, store string, src interface{}) error
 	return ErrNotImplemented
 }
 func (s ScribbleStore) Delete(key string, store string) error {
-	return s.db.Delete(store, key)
+	if err := s.ctxErr(); err != nil {
+		return err
+	}
+	watched, old := s.watchedRow(store, key)
+	if err := s.db.Delete(store, key); err != nil {
+		return err
+	}
+	if watched && old != nil {
+		s.publish(store, key, old, nil)
+	}
+	return s.deleteGeohash(key, store)
 }
 
 //Filter
@@ -146,6 +210,10 @@ func (s ScribbleStore) FilterGet(filter map[string]interface{}, store string, ds
 func (s ScribbleStore) FilterGetAll(filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
 	return nil, ErrNotImplemented
 }
+
+func (s ScribbleStore) Query(filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error) {
+	return nil, nil, ErrNotImplemented
+}
 func (s ScribbleStore) FilterDelete(filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
 	return ErrNotImplemented
 }
@@ -172,5 +240,8 @@ func (s ScribbleStore) GetByFieldsByField(name, val, store string, fields []stri
 func (s ScribbleStore) BatchInsert(data []interface{}, store string, opts ObjectStoreOptions) (keys []string, err error) {
 	return nil, ErrNotImplemented
 }
+
+//Close ends the change feeds of the store
 func (s ScribbleStore) Close() {
+	closeLocal(s.db)
 }
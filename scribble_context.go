@@ -0,0 +1,150 @@
+package gostore
+
+import (
+	"context"
+)
+
+// withContext returns a copy of the store whose calls fail once ctx is done. Scribble reads and
+// writes files which cannot be interrupted, the context is checked before each of them
+func (s ScribbleStore) withContext(ctx context.Context) ScribbleStore {
+	s.ctx = ctx
+	return s
+}
+
+// ctxErr returns the error of the context the store is bound to once it is done
+func (s ScribbleStore) ctxErr() error {
+	if s.ctx == nil {
+		return nil
+	}
+	return s.ctx.Err()
+}
+
+func (s ScribbleStore) CreateDatabaseContext(ctx context.Context) error {
+	return s.withContext(ctx).CreateDatabase()
+}
+
+func (s ScribbleStore) CreateTableContext(ctx context.Context, table string, sample interface{}) error {
+	return s.withContext(ctx).CreateTable(table, sample)
+}
+
+func (s ScribbleStore) StatsContext(ctx context.Context, store string) (map[string]interface{}, error) {
+	return s.withContext(ctx).Stats(store)
+}
+
+func (s ScribbleStore) AllContext(ctx context.Context, count int, skip int, store string) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).All(count, skip, store)
+	return contextRows(ctx, rows, err)
+}
+
+func (s ScribbleStore) AllCursorContext(ctx context.Context, store string) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).AllCursor(store)
+	return contextRows(ctx, rows, err)
+}
+
+func (s ScribbleStore) AllWithinRangeContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).AllWithinRange(filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (s ScribbleStore) SinceContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).Since(id, count, skip, store)
+	return contextRows(ctx, rows, err)
+}
+
+func (s ScribbleStore) BeforeContext(ctx context.Context, id string, count int, skip int, store string) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).Before(id, count, skip, store)
+	return contextRows(ctx, rows, err)
+}
+
+func (s ScribbleStore) FilterSinceContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).FilterSince(id, filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (s ScribbleStore) FilterBeforeContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).FilterBefore(id, filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (s ScribbleStore) FilterBeforeCountContext(ctx context.Context, id string, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.withContext(ctx).FilterBeforeCount(id, filter, count, skip, store, opts)
+}
+
+func (s ScribbleStore) GetContext(ctx context.Context, key string, store string, dst interface{}) error {
+	return s.withContext(ctx).Get(key, store, dst)
+}
+
+func (s ScribbleStore) SaveContext(ctx context.Context, key, store string, src interface{}) (string, error) {
+	return s.withContext(ctx).Save(key, store, src)
+}
+
+func (s ScribbleStore) SaveAllContext(ctx context.Context, store string, src ...interface{}) ([]string, error) {
+	return s.withContext(ctx).SaveAll(store, src...)
+}
+
+func (s ScribbleStore) UpdateContext(ctx context.Context, key string, store string, src interface{}) error {
+	return s.withContext(ctx).Update(key, store, src)
+}
+
+func (s ScribbleStore) ReplaceContext(ctx context.Context, key string, store string, src interface{}) error {
+	return s.withContext(ctx).Replace(key, store, src)
+}
+
+func (s ScribbleStore) DeleteContext(ctx context.Context, key string, store string) error {
+	return s.withContext(ctx).Delete(key, store)
+}
+
+func (s ScribbleStore) FilterUpdateContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).FilterUpdate(filter, src, store, opts)
+}
+
+func (s ScribbleStore) FilterReplaceContext(ctx context.Context, filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).FilterReplace(filter, src, store, opts)
+}
+
+func (s ScribbleStore) FilterGetContext(ctx context.Context, filter map[string]interface{}, store string, dst interface{}, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).FilterGet(filter, store, dst, opts)
+}
+
+func (s ScribbleStore) FilterGetAllContext(ctx context.Context, filter map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	rows, err := s.withContext(ctx).FilterGetAll(filter, count, skip, store, opts)
+	return contextRows(ctx, rows, err)
+}
+
+func (s ScribbleStore) QueryContext(ctx context.Context, filter, aggregates map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, AggregateResult, error) {
+	rows, agg, err := s.withContext(ctx).Query(filter, aggregates, count, skip, store, opts)
+	rows, err = contextRows(ctx, rows, err)
+	return rows, agg, err
+}
+
+func (s ScribbleStore) FilterDeleteContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).FilterDelete(filter, store, opts)
+}
+
+func (s ScribbleStore) FilterCountContext(ctx context.Context, filter map[string]interface{}, store string, opts ObjectStoreOptions) (int64, error) {
+	return s.withContext(ctx).FilterCount(filter, store, opts)
+}
+
+func (s ScribbleStore) GetByFieldContext(ctx context.Context, name, val, store string, dst interface{}) error {
+	return s.withContext(ctx).GetByField(name, val, store, dst)
+}
+
+func (s ScribbleStore) GetByFieldsByFieldContext(ctx context.Context, name, val, store string, fields []string, dst interface{}) error {
+	return s.withContext(ctx).GetByFieldsByField(name, val, store, fields, dst)
+}
+
+func (s ScribbleStore) BatchDeleteContext(ctx context.Context, ids []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).BatchDelete(ids, store, opts)
+}
+
+func (s ScribbleStore) BatchUpdateContext(ctx context.Context, ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).BatchUpdate(ids, data, store, opts)
+}
+
+func (s ScribbleStore) BatchFilterDeleteContext(ctx context.Context, filter []map[string]interface{}, store string, opts ObjectStoreOptions) error {
+	return s.withContext(ctx).BatchFilterDelete(filter, store, opts)
+}
+
+func (s ScribbleStore) BatchInsertContext(ctx context.Context, data []interface{}, store string, opts ObjectStoreOptions) ([]string, error) {
+	return s.withContext(ctx).BatchInsert(data, store, opts)
+}
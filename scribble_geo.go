@@ -0,0 +1,119 @@
+package gostore
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// scribbleGeohash is the record kept for each row saved with SaveWithGeo
+type scribbleGeohash struct {
+	ID   string `json:"id"`
+	Hash string `json:"hash"`
+}
+
+// scribbleGeoCollection holds the geohash records of a table, one directory per character of
+// the geohash so the rows of a cell are the records under its directory
+func scribbleGeoCollection(store, hash string) string {
+	return path.Join(append([]string{"_geo", store}, strings.Split(hash, "")...)...)
+}
+
+// scribbleGeoKeysCollection maps the key of a row to its geohash so the record can be replaced
+func scribbleGeoKeysCollection(store string) string {
+	return "_geokeys/" + store
+}
+
+// deleteGeohash removes the geohash record of a row if it has one
+func (s ScribbleStore) deleteGeohash(key, store string) error {
+	var hash scribbleGeohash
+	if err := s.db.Read(scribbleGeoKeysCollection(store), key, &hash); err != nil {
+		if _, ok := err.(*os.PathError); ok {
+			return nil
+		}
+		return err
+	}
+	if err := s.db.Delete(scribbleGeoCollection(store, hash.Hash), key); err != nil {
+		if _, ok := err.(*os.PathError); !ok {
+			return err
+		}
+	}
+	return s.db.Delete(scribbleGeoKeysCollection(store), key)
+}
+
+// SaveWithGeo saves src and records the geohash of its location field
+func (s ScribbleStore) SaveWithGeo(key, store string, src interface{}, field string) (string, error) {
+	doc, err := toDoc(src)
+	if err != nil {
+		return "", err
+	}
+	lon, lat, ok := locationOf(doc[field])
+	if !ok {
+		return "", ErrInvalidLocation
+	}
+	if _, err = s.Save(key, store, src); err != nil {
+		return "", err
+	}
+	if err = s.deleteGeohash(key, store); err != nil {
+		return "", err
+	}
+	hash := scribbleGeohash{key, encodeGeohash(lat, lon, geohashPrecision)}
+	if err = s.db.Write(scribbleGeoCollection(store, hash.Hash), key, hash); err != nil {
+		return "", err
+	}
+	if err = s.db.Write(scribbleGeoKeysCollection(store), key, hash); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// SaveWithGeoTX is not supported, scribble has no transactions
+func (s ScribbleStore) SaveWithGeoTX(key, store string, src interface{}, field string, txn Transaction) error {
+	return ErrNotImplemented
+}
+
+// GeoQuery retrieves rows saved with SaveWithGeo within distance (e.g "5km", "300m") of a point,
+// nearest first. Only the records under the geohash cells around the point are read, their rows
+// are refined by their exact distance and must match query. Each row has the distance in meters in its _distance field
+func (s ScribbleStore) GeoQuery(lon, lat float64, distance string, query map[string]interface{}, count int, skip int, store string, opts ObjectStoreOptions) (ObjectRows, error) {
+	q, err := newGeohashQuery(lon, lat, distance, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, cell := range q.cells() {
+		root := filepath.Join(s.path, scribbleGeoCollection(store, cell))
+		err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if err := s.ctxErr(); err != nil {
+				return err
+			}
+			if info.IsDir() || filepath.Ext(file) != ".json" {
+				return nil
+			}
+			key := strings.TrimSuffix(info.Name(), ".json")
+			var doc map[string]interface{}
+			if err := s.db.Read(store, key, &doc); err == nil {
+				q.add(key, doc)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var rows []string
+	for _, m := range q.results(count, skip) {
+		data, err := json.Marshal(m.doc)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, string(data))
+	}
+	return &ScribbleRows{rows, 0, len(rows)}, nil
+}
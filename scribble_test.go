@@ -3,6 +3,7 @@ package gostore
 import (
 	. "github.com/smartystreets/goconvey/convey"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -73,3 +74,35 @@ func TestScribbleDelete(t *testing.T) {
 	})
 
 }
+
+func TestScribbleGeoQuery(t *testing.T) {
+	Convey("Given a scribble store with places saved with their location", t, func() {
+		path := "/tmp/scribble.geo.test.json"
+		store := NewScribbleStore(path)
+		saveGeoPlaces(store)
+		Convey("Places within the distance are returned nearest first", func() {
+			ids := rowIds(store.GeoQuery(3.3792, 6.5244, "5km", nil, 10, 0, "places", nil))
+			So(ids, ShouldResemble, []string{"near", "bar", "close"})
+		})
+		Convey("Deleted places are not returned", func() {
+			So(store.Delete("near", "places"), ShouldBeNil)
+			ids := rowIds(store.GeoQuery(3.3792, 6.5244, "5km", map[string]interface{}{"kind": "shop"}, 10, 0, "places", nil))
+			So(ids, ShouldResemble, []string{"close"})
+		})
+		Convey("Records are kept under the directory of their geohash cell", func() {
+			hash := encodeGeohash(6.5250, 3.3800, geohashPrecision)
+			_, err := os.Stat(filepath.Join(path, scribbleGeoCollection("places", hash), "near.json"))
+			So(err, ShouldBeNil)
+		})
+		Convey("Moved places are found at their new location only", func() {
+			place := map[string]interface{}{"id": "near", "kind": "shop", "location": []interface{}{3.5000, 6.6000}}
+			_, err := store.SaveWithGeo("near", "places", place, "location")
+			So(err, ShouldBeNil)
+			ids := rowIds(store.GeoQuery(3.3792, 6.5244, "5km", nil, 10, 0, "places", nil))
+			So(ids, ShouldResemble, []string{"bar", "close"})
+			ids = rowIds(store.GeoQuery(3.5000, 6.6000, "1km", nil, 10, 0, "places", nil))
+			So(ids, ShouldResemble, []string{"far", "near"})
+		})
+		os.RemoveAll(path)
+	})
+}
@@ -0,0 +1,36 @@
+package gostore
+
+import (
+	"encoding/json"
+)
+
+// Watch streams the changes made to a table through the stores of this process which share the
+// scribble driver. Writes made by other drivers on the same directory are not seen, and the old
+// value of a row written concurrently by two goroutines may be stale
+func (s ScribbleStore) Watch(store string, filter map[string]interface{}, opts WatchOptions) (ChangeFeed, error) {
+	return watchLocal(s.db, store, filter, opts)
+}
+
+// watchedRow reads the JSON of a row about to be written when its table is watched
+func (s ScribbleStore) watchedRow(store, key string) (watched bool, old json.RawMessage) {
+	if !watchingLocal(s.db, store) {
+		return false, nil
+	}
+	if err := s.db.Read(store, key, &old); err != nil {
+		return true, nil
+	}
+	return true, old
+}
+
+// publish sends the write of a row to the watchers of its table, a nil src is a delete
+func (s ScribbleStore) publish(store, key string, old json.RawMessage, src interface{}) error {
+	var new []byte
+	if src != nil {
+		var err error
+		if new, err = json.Marshal(src); err != nil {
+			return err
+		}
+	}
+	publishLocal(s.db, changeOf(store, key, old, new))
+	return nil
+}
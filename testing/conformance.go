@@ -0,0 +1,479 @@
+package testing
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/osiloke/gostore"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Table is the table the conformance suite writes to
+const Table = "conformance"
+
+// Factory returns an empty store for the conformance suite and a function which releases it. It
+// is called for every case so cases never see each others rows
+type Factory func() (store gostore.ObjectStore, done func())
+
+// things are saved before every case, their keys sort in the order they were created. The backends
+// do not agree on the order of the rows they read so the suite compares the keys of rows sorted
+var things = []map[string]interface{}{
+	{"id": "1", "name": "First Thing", "kind": "thing", "rating": 4.5, "active": true, "created": "2017-01-02T15:04:05Z", "food": map[string]interface{}{"type": "egg"}},
+	{"id": "2", "name": "Second Thing", "kind": "thing", "rating": 3, "active": false, "created": "2017-06-02T15:04:05Z", "food": map[string]interface{}{"type": "fish"}},
+	{"id": "3", "name": "Third Something", "kind": "something", "rating": 5, "created": "2018-01-02T15:04:05Z"},
+	{"id": "4", "name": "Fourth Fish", "kind": "fish", "rating": 1, "active": true, "created": "2019-01-02T15:04:05Z"},
+	{"id": "5", "name": "Fifth Thing", "kind": "thing", "rating": 2, "created": "2020-01-02T15:04:05Z"},
+}
+
+// RunConformance checks that the stores made by factory behave like the built in backends:
+//
+//	Save fails with ErrDuplicatePk or replaces the row when the key exists
+//	Get, FilterGet and GetByField fail with ErrNotFound when no row matches
+//	Since reads the rows with keys greater than id and Before the rows with keys less than id
+//	reads may return rows in any order, count and skip page through them without repeating a row
+//	a count less than 1 reads every row after skip
+//	FilterGet retrieves the matching row with the greatest key
+//	rows return false from Next after the last row and may be closed more than once
+//	a gostore.WriteResultStore counts the rows it writes and lists the keys a batch update missed
+//
+// Cases using an operation or filter operator the store declares unsupported through
+// gostore.CapabilitiesOf are skipped, a store which does not describe itself must support everything
+func RunConformance(t *testing.T, factory Factory) {
+	Convey("Giving a store with some things", t, func() {
+		store, done := factory()
+		defer done()
+		s := newSuite(store)
+		So(store.CreateTable(Table, nil), ShouldBeNil)
+		for _, thing := range things {
+			_, err := store.Save(thing["id"].(string), Table, copyThing(thing))
+			So(err, ShouldBeNil)
+		}
+		s.crud()
+		s.ranges()
+		s.filters()
+		s.filterWrites()
+		s.batches()
+		s.writeResults()
+		s.rows()
+	})
+}
+
+type suite struct {
+	store     gostore.ObjectStore
+	caps      gostore.Capabilities
+	described bool
+}
+
+func newSuite(store gostore.ObjectStore) suite {
+	caps, described := gostore.CapabilitiesOf(store)
+	return suite{store, caps, described}
+}
+
+func (s suite) supports(ops ...string) bool {
+	for _, op := range ops {
+		if s.described && !s.caps.Supports(op) {
+			return false
+		}
+	}
+	return true
+}
+
+// convey runs a case needing ops, it is reported as skipped when one of them is unsupported
+func (s suite) convey(name string, ops []string, fn func()) {
+	if !s.supports(ops...) {
+		SkipConvey(name, fn)
+		return
+	}
+	Convey(name, fn)
+}
+
+// conveyFilter runs a filter case needing op like convey
+func (s suite) conveyFilter(name string, op gostore.FilterOperator, fn func()) {
+	if s.described && !s.caps.SupportsFilter(op) {
+		SkipConvey(name, fn)
+		return
+	}
+	s.convey(name, []string{"FilterGetAll"}, fn)
+}
+
+func (s suite) get(key string) (map[string]interface{}, error) {
+	var row map[string]interface{}
+	err := s.store.Get(key, Table, &row)
+	return row, err
+}
+
+func (s suite) crud() {
+	s.convey("Saved rows are retrieved by key", []string{"Get"}, func() {
+		row, err := s.get("1")
+		So(err, ShouldBeNil)
+		So(row["id"], ShouldEqual, "1")
+		So(row["name"], ShouldEqual, "First Thing")
+		So(row["food"], ShouldResemble, map[string]interface{}{"type": "egg"})
+		_, err = s.get("missing")
+		So(err, ShouldEqual, gostore.ErrNotFound)
+	})
+	s.convey("Saving an existing key replaces the row or fails with ErrDuplicatePk", []string{"Get"}, func() {
+		_, err := s.store.Save("1", Table, map[string]interface{}{"id": "1", "name": "Saved Again"})
+		if err != nil {
+			So(err, ShouldEqual, gostore.ErrDuplicatePk)
+			return
+		}
+		row, err := s.get("1")
+		So(err, ShouldBeNil)
+		So(row["name"], ShouldEqual, "Saved Again")
+	})
+	s.convey("Update merges into a row", []string{"Update", "Get"}, func() {
+		So(s.store.Update("1", Table, map[string]interface{}{"rating": 1}), ShouldBeNil)
+		row, err := s.get("1")
+		So(err, ShouldBeNil)
+		So(fmt.Sprint(row["rating"]), ShouldEqual, "1")
+		So(row["name"], ShouldEqual, "First Thing")
+	})
+	s.convey("Replace overwrites a row", []string{"Replace", "Get"}, func() {
+		So(s.store.Replace("1", Table, map[string]interface{}{"id": "1", "name": "Replaced"}), ShouldBeNil)
+		row, err := s.get("1")
+		So(err, ShouldBeNil)
+		So(row["name"], ShouldEqual, "Replaced")
+		So(row, ShouldNotContainKey, "kind")
+	})
+	s.convey("Deleted rows are not found", []string{"Delete", "Get"}, func() {
+		So(s.store.Delete("1", Table), ShouldBeNil)
+		_, err := s.get("1")
+		So(err, ShouldEqual, gostore.ErrNotFound)
+	})
+}
+
+func (s suite) ranges() {
+	s.convey("All returns every row and pages them", []string{"All"}, func() {
+		So(rowIds(s.store.All(0, 0, Table)), ShouldResemble, []string{"1", "2", "3", "4", "5"})
+		So(rowIds(s.store.All(2, 1, Table)), ShouldHaveLength, 2)
+		So(rowIds(s.store.All(0, 3, Table)), ShouldHaveLength, 2)
+		So(pages(func(count, skip int) (gostore.ObjectRows, error) {
+			return s.store.All(count, skip, Table)
+		}), ShouldResemble, []string{"1", "2", "3", "4", "5"})
+	})
+	s.convey("AllCursor returns every row", []string{"AllCursor"}, func() {
+		So(rowIds(s.store.AllCursor(Table)), ShouldResemble, []string{"1", "2", "3", "4", "5"})
+	})
+	s.convey("Since returns rows after a key", []string{"Since"}, func() {
+		So(rowIds(s.store.Since("2", 0, 0, Table)), ShouldResemble, []string{"3", "4", "5"})
+		So(rowIds(s.store.Since("2", 2, 0, Table)), ShouldHaveLength, 2)
+		So(rowIds(s.store.Since("2", 0, 1, Table)), ShouldHaveLength, 2)
+		So(pages(func(count, skip int) (gostore.ObjectRows, error) {
+			return s.store.Since("2", count, skip, Table)
+		}), ShouldResemble, []string{"3", "4", "5"})
+		So(rowIds(s.store.Since("5", 0, 0, Table)), ShouldBeEmpty)
+	})
+	s.convey("Before returns rows before a key", []string{"Before"}, func() {
+		So(rowIds(s.store.Before("3", 0, 0, Table)), ShouldResemble, []string{"1", "2"})
+		So(rowIds(s.store.Before("3", 1, 1, Table)), ShouldHaveLength, 1)
+		So(pages(func(count, skip int) (gostore.ObjectRows, error) {
+			return s.store.Before("4", count, skip, Table)
+		}), ShouldResemble, []string{"1", "2", "3"})
+		So(rowIds(s.store.Before("1", 0, 0, Table)), ShouldBeEmpty)
+	})
+	s.convey("FilterSince and FilterBefore bound filtered rows", []string{"FilterSince", "FilterBefore"}, func() {
+		thing := map[string]interface{}{"kind": "thing"}
+		So(rowIds(s.store.FilterSince("1", thing, 0, 0, Table, nil)), ShouldResemble, []string{"2", "5"})
+		So(rowIds(s.store.FilterBefore("5", thing, 0, 0, Table, nil)), ShouldResemble, []string{"1", "2"})
+		So(rowIds(s.store.FilterBefore("2", thing, 0, 0, Table, nil)), ShouldResemble, []string{"1"})
+		So(rowIds(s.store.FilterBefore("5", thing, 1, 0, Table, nil)), ShouldHaveLength, 1)
+		So(pages(func(count, skip int) (gostore.ObjectRows, error) {
+			return s.store.FilterSince("0", thing, count, skip, Table, nil)
+		}), ShouldResemble, []string{"1", "2", "5"})
+	})
+	s.convey("FilterBeforeCount counts filtered rows before a key", []string{"FilterBeforeCount"}, func() {
+		cnt, err := s.store.FilterBeforeCount("5", map[string]interface{}{"kind": "thing"}, 0, 0, Table, nil)
+		So(err, ShouldBeNil)
+		So(cnt, ShouldEqual, 2)
+	})
+}
+
+func (s suite) filters() {
+	filtered := func(filter map[string]interface{}) []string {
+		return rowIds(s.store.FilterGetAll(filter, 0, 0, Table, nil))
+	}
+	s.conveyFilter("Equality matches any alternative", gostore.OpEq, func() {
+		So(filtered(map[string]interface{}{"kind": "thing"}), ShouldResemble, []string{"1", "2", "5"})
+		So(filtered(map[string]interface{}{"kind": "=fish|something"}), ShouldResemble, []string{"3", "4"})
+		So(filtered(map[string]interface{}{"active": true}), ShouldResemble, []string{"1", "4"})
+		So(filtered(map[string]interface{}{"food.type": "fish"}), ShouldResemble, []string{"2"})
+		So(filtered(map[string]interface{}{"food": map[string]interface{}{"type": "egg"}}), ShouldResemble, []string{"1"})
+		So(filtered(map[string]interface{}{"kind": "chair"}), ShouldBeEmpty)
+	})
+	s.conveyFilter("Regular expressions match", gostore.OpMatch, func() {
+		So(filtered(map[string]interface{}{"name": "~^F"}), ShouldResemble, []string{"1", "4", "5"})
+		So(filtered(map[string]interface{}{"name": "~Fish|Something"}), ShouldResemble, []string{"3", "4"})
+	})
+	s.conveyFilter("Greater than compares numbers and dates", gostore.OpGt, func() {
+		So(filtered(map[string]interface{}{"rating": ">3"}), ShouldResemble, []string{"1", "3"})
+		So(filtered(map[string]interface{}{"created": ">2018-06-01T00:00:00Z|dt"}), ShouldResemble, []string{"4", "5"})
+	})
+	s.conveyFilter("Less than compares numbers and dates", gostore.OpLt, func() {
+		So(filtered(map[string]interface{}{"rating": "<3"}), ShouldResemble, []string{"4", "5"})
+		So(filtered(map[string]interface{}{"created": "<2017-03-01T00:00:00Z|dt"}), ShouldResemble, []string{"1"})
+	})
+	s.conveyFilter("Exists matches truthy fields", gostore.OpExists, func() {
+		So(filtered(map[string]interface{}{"active": ""}), ShouldResemble, []string{"1", "4"})
+	})
+	s.conveyFilter("Conditions are combined and grouped", gostore.OpEq, func() {
+		So(filtered(map[string]interface{}{"kind": "thing", "food.type": "egg"}), ShouldResemble, []string{"1"})
+		So(filtered(map[string]interface{}{"or": []interface{}{
+			map[string]interface{}{"kind": "fish"},
+			map[string]interface{}{"kind": "something"},
+		}}), ShouldResemble, []string{"3", "4"})
+	})
+	s.conveyFilter("Count and skip shape filtered rows", gostore.OpEq, func() {
+		So(rowIds(s.store.FilterGetAll(map[string]interface{}{"kind": "thing"}, 1, 1, Table, nil)), ShouldHaveLength, 1)
+		So(pages(func(count, skip int) (gostore.ObjectRows, error) {
+			return s.store.FilterGetAll(map[string]interface{}{"kind": "thing"}, count, skip, Table, nil)
+		}), ShouldResemble, []string{"1", "2", "5"})
+	})
+	s.convey("FilterCount counts matching rows", []string{"FilterCount"}, func() {
+		cnt, err := s.store.FilterCount(map[string]interface{}{"kind": "thing"}, Table, nil)
+		So(err, ShouldBeNil)
+		So(cnt, ShouldEqual, 3)
+		cnt, err = s.store.FilterCount(map[string]interface{}{"kind": "chair"}, Table, nil)
+		So(err, ShouldBeNil)
+		So(cnt, ShouldEqual, 0)
+	})
+	s.convey("FilterGet retrieves the newest matching row", []string{"FilterGet"}, func() {
+		var row map[string]interface{}
+		So(s.store.FilterGet(map[string]interface{}{"kind": "thing"}, Table, &row, nil), ShouldBeNil)
+		So(row["id"], ShouldEqual, "5")
+		So(s.store.FilterGet(map[string]interface{}{"kind": "chair"}, Table, &row, nil), ShouldEqual, gostore.ErrNotFound)
+	})
+	s.convey("GetByField retrieves a row by a field", []string{"GetByField"}, func() {
+		var row map[string]interface{}
+		So(s.store.GetByField("name", "Fourth Fish", Table, &row), ShouldBeNil)
+		So(row["id"], ShouldEqual, "4")
+		So(s.store.GetByField("name", "Nothing", Table, &row), ShouldEqual, gostore.ErrNotFound)
+	})
+	s.convey("Query returns the filtered rows", []string{"Query"}, func() {
+		rows, _, err := s.store.Query(map[string]interface{}{"kind": "thing"}, nil, 0, 0, Table, nil)
+		So(rowIds(rows, err), ShouldResemble, []string{"1", "2", "5"})
+	})
+}
+
+func (s suite) filterWrites() {
+	s.convey("FilterUpdate merges into matching rows", []string{"FilterUpdate", "Get"}, func() {
+		So(s.store.FilterUpdate(map[string]interface{}{"kind": "thing"}, map[string]interface{}{"rating": 0}, Table, nil), ShouldBeNil)
+		for _, key := range []string{"1", "2", "5"} {
+			row, err := s.get(key)
+			So(err, ShouldBeNil)
+			So(fmt.Sprint(row["rating"]), ShouldEqual, "0")
+			So(row["kind"], ShouldEqual, "thing")
+		}
+		row, _ := s.get("4")
+		So(fmt.Sprint(row["rating"]), ShouldEqual, "1")
+	})
+	s.convey("FilterReplace overwrites matching rows", []string{"FilterReplace", "Get"}, func() {
+		So(s.store.FilterReplace(map[string]interface{}{"kind": "fish"}, map[string]interface{}{"id": "4", "kind": "chair"}, Table, nil), ShouldBeNil)
+		row, err := s.get("4")
+		So(err, ShouldBeNil)
+		So(row["kind"], ShouldEqual, "chair")
+		So(row, ShouldNotContainKey, "name")
+	})
+	s.convey("FilterDelete removes matching rows", []string{"FilterDelete", "Get"}, func() {
+		So(s.store.FilterDelete(map[string]interface{}{"kind": "thing"}, Table, nil), ShouldBeNil)
+		for _, key := range []string{"1", "2", "5"} {
+			_, err := s.get(key)
+			So(err, ShouldEqual, gostore.ErrNotFound)
+		}
+		_, err := s.get("3")
+		So(err, ShouldBeNil)
+	})
+}
+
+func (s suite) batches() {
+	more := []interface{}{
+		map[string]interface{}{"id": "6", "name": "Sixth Thing", "kind": "thing"},
+		map[string]interface{}{"id": "7", "name": "Seventh Thing", "kind": "thing"},
+	}
+	s.convey("SaveAll saves every row", []string{"SaveAll", "Get"}, func() {
+		_, err := s.store.SaveAll(Table, more...)
+		So(err, ShouldBeNil)
+		row, err := s.get("7")
+		So(err, ShouldBeNil)
+		So(row["name"], ShouldEqual, "Seventh Thing")
+	})
+	s.convey("BatchInsert saves every row", []string{"BatchInsert", "Get"}, func() {
+		_, err := s.store.BatchInsert(more, Table, nil)
+		So(err, ShouldBeNil)
+		row, err := s.get("6")
+		So(err, ShouldBeNil)
+		So(row["name"], ShouldEqual, "Sixth Thing")
+	})
+	s.convey("BatchUpdate merges into rows by key", []string{"BatchUpdate", "Get"}, func() {
+		So(s.store.BatchUpdate([]interface{}{"1", "2"}, []interface{}{
+			map[string]interface{}{"name": "Updated First"},
+			map[string]interface{}{"name": "Updated Second"},
+		}, Table, nil), ShouldBeNil)
+		row, _ := s.get("2")
+		So(row["name"], ShouldEqual, "Updated Second")
+		So(row["kind"], ShouldEqual, "thing")
+	})
+	s.convey("BatchDelete removes rows by key", []string{"BatchDelete", "Get"}, func() {
+		So(s.store.BatchDelete([]interface{}{"1", "2"}, Table, nil), ShouldBeNil)
+		_, err := s.get("2")
+		So(err, ShouldEqual, gostore.ErrNotFound)
+		_, err = s.get("3")
+		So(err, ShouldBeNil)
+	})
+	s.convey("BatchFilterDelete removes rows matching any filter", []string{"BatchFilterDelete", "Get"}, func() {
+		So(s.store.BatchFilterDelete([]map[string]interface{}{{"kind": "fish"}, {"kind": "something"}}, Table, nil), ShouldBeNil)
+		_, err := s.get("4")
+		So(err, ShouldEqual, gostore.ErrNotFound)
+		_, err = s.get("3")
+		So(err, ShouldEqual, gostore.ErrNotFound)
+		_, err = s.get("1")
+		So(err, ShouldBeNil)
+	})
+}
+
+// writeResults checks the results of the writes of a gostore.WriteResultStore, the cases are
+// skipped for other stores
+func (s suite) writeResults() {
+	store, ok := s.store.(gostore.WriteResultStore)
+	convey := func(name string, ops []string, fn func()) {
+		if !ok {
+			SkipConvey(name, fn)
+			return
+		}
+		s.convey(name, ops, fn)
+	}
+	convey("BatchUpdateResult lists the keys which have no row", []string{"BatchUpdate", "Get"}, func() {
+		result, err := store.BatchUpdateResult([]interface{}{"1", "missing", "2"}, []interface{}{
+			map[string]interface{}{"name": "Updated First"},
+			map[string]interface{}{"name": "Nobody"},
+			map[string]interface{}{"kind": "thing"},
+		}, Table, nil)
+		So(err, ShouldBeNil)
+		So(result.Matched, ShouldEqual, 2)
+		So(result.Updated, ShouldEqual, 1)
+		So(result.Unchanged, ShouldEqual, 1)
+		So(result.Skipped, ShouldEqual, 1)
+		So(result.Failed, ShouldResemble, []gostore.WriteError{{Key: "missing", Err: gostore.ErrNotFound}})
+		row, _ := s.get("1")
+		So(row["name"], ShouldEqual, "Updated First")
+		_, err = s.get("missing")
+		So(err, ShouldEqual, gostore.ErrNotFound)
+	})
+	convey("BatchUpdateResult applies the first update of a key given twice", []string{"BatchUpdate", "Get"}, func() {
+		result, err := store.BatchUpdateResult([]interface{}{"1", "1"}, []interface{}{
+			map[string]interface{}{"name": "Updated First"},
+			map[string]interface{}{"name": "Updated Again"},
+		}, Table, nil)
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, gostore.WriteResult{Matched: 1, Updated: 1})
+		row, _ := s.get("1")
+		So(row["name"], ShouldEqual, "Updated First")
+	})
+	convey("BatchDeleteResult counts the keys which have no row as skipped", []string{"BatchDelete", "Get"}, func() {
+		result, err := store.BatchDeleteResult([]interface{}{"1", "missing"}, Table, nil)
+		So(err, ShouldBeNil)
+		So(result.Deleted, ShouldEqual, 1)
+		So(result.Skipped, ShouldEqual, 1)
+		So(result.Failed, ShouldBeEmpty)
+		_, err = s.get("1")
+		So(err, ShouldEqual, gostore.ErrNotFound)
+	})
+	convey("FilterUpdateResult counts the rows it changed", []string{"FilterUpdate", "Get"}, func() {
+		update := map[string]interface{}{"active": true}
+		result, err := store.FilterUpdateResult(map[string]interface{}{"kind": "thing"}, update, Table, nil, gostore.WriteOptions{DryRun: true})
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, gostore.WriteResult{Matched: 3, Updated: 2, Unchanged: 1})
+		row, _ := s.get("2")
+		So(row["active"], ShouldEqual, false)
+		result, err = store.FilterUpdateResult(map[string]interface{}{"kind": "thing"}, update, Table, nil, gostore.WriteOptions{})
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, gostore.WriteResult{Matched: 3, Updated: 2, Unchanged: 1})
+		row, _ = s.get("2")
+		So(row["active"], ShouldEqual, true)
+	})
+	convey("FilterDeleteResult and BatchFilterDeleteResult count the rows they deleted", []string{"FilterDelete", "BatchFilterDelete"}, func() {
+		result, err := store.FilterDeleteResult(map[string]interface{}{"kind": "thing"}, Table, nil)
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, gostore.WriteResult{Matched: 3, Deleted: 3})
+		result, err = store.BatchFilterDeleteResult([]map[string]interface{}{{"kind": "fish"}, {"kind": "something"}, {"kind": "fish"}}, Table, nil)
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, gostore.WriteResult{Matched: 2, Deleted: 2})
+	})
+}
+
+func (s suite) rows() {
+	s.convey("Rows end without an error and can be closed twice", []string{"All"}, func() {
+		rows, err := s.store.All(1, 0, Table)
+		So(err, ShouldBeNil)
+		var row map[string]interface{}
+		ok, err := rows.Next(&row)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		ok, err = rows.Next(&row)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+		So(rows.LastError(), ShouldBeNil)
+		rows.Close()
+		So(rows.Close, ShouldNotPanic)
+	})
+	s.convey("Closed rows stop iterating", []string{"All"}, func() {
+		rows, err := s.store.All(0, 0, Table)
+		So(err, ShouldBeNil)
+		rows.Close()
+		var row map[string]interface{}
+		ok, _ := rows.Next(&row)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+// rowIds reads the ids of rows, ErrNotFound is read as no rows
+func rowIds(rows gostore.ObjectRows, err error) []string {
+	ids := []string{}
+	if err == gostore.ErrNotFound {
+		return ids
+	}
+	So(err, ShouldBeNil)
+	defer rows.Close()
+	for {
+		var row map[string]interface{}
+		ok, err := rows.Next(&row)
+		So(err, ShouldBeNil)
+		if !ok {
+			break
+		}
+		ids = append(ids, fmt.Sprint(row["id"]))
+	}
+	So(rows.LastError(), ShouldBeNil)
+	sort.Strings(ids)
+	return ids
+}
+
+// pages reads every page of two rows of a read and returns the keys of all of them sorted, a
+// key read on more than one page fails the case
+func pages(read func(count, skip int) (gostore.ObjectRows, error)) []string {
+	ids := []string{}
+	seen := map[string]bool{}
+	for skip := 0; ; skip += 2 {
+		page := rowIds(read(2, skip))
+		So(len(page), ShouldBeLessThanOrEqualTo, 2)
+		for _, id := range page {
+			So(seen[id], ShouldBeFalse)
+			seen[id] = true
+		}
+		ids = append(ids, page...)
+		if len(page) < 2 {
+			break
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func copyThing(thing map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(thing))
+	for k, v := range thing {
+		c[k] = v
+	}
+	return c
+}
@@ -26,6 +26,8 @@ var ErrNotAllDeleted = errors.New("not all rows were deleted")
 var ErrDuplicatePk = errors.New("duplicate primary key exists")
 var ErrNotImplemented = errors.New("not implemented yet")
 var ErrEOF = errors.New("eof")
+var ErrInvalidLocation = errors.New("location field is not a valid point")
+var ErrInvalidTransaction = errors.New("transaction does not belong to this store")
 
 type Params map[string]interface{}
 
@@ -94,5 +96,4 @@ func ParseAllRows(rows ObjectRows, done chan bool) (results []interface{}, err e
 			}
 		}
 	}
-	return
 }
@@ -0,0 +1,297 @@
+package gostore
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// ErrChangeFeedOverflow ends a change feed whose reader fell more than its buffer behind the writes
+// of an in-process store
+var ErrChangeFeedOverflow = errors.New("change feed fell behind and was closed")
+
+// ChangeType names the kind of write a Change describes
+type ChangeType string
+
+const (
+	ChangeInsert ChangeType = "insert"
+	ChangeUpdate ChangeType = "update"
+	ChangeDelete ChangeType = "delete"
+)
+
+// Change describes a write to a row. Old and New hold the JSON of the row before and after the
+// write, Old is nil for inserts and New is nil for deletes
+type Change struct {
+	Type  ChangeType
+	Table string
+	Key   string
+	Old   json.RawMessage
+	New   json.RawMessage
+}
+
+// DecodeOld decodes the row as it was before the change, it returns ErrNotFound for inserts
+func (c Change) DecodeOld(dst interface{}) error {
+	if c.Old == nil {
+		return ErrNotFound
+	}
+	return json.Unmarshal(c.Old, dst)
+}
+
+// DecodeNew decodes the row as it is after the change, it returns ErrNotFound for deletes
+func (c Change) DecodeNew(dst interface{}) error {
+	if c.New == nil {
+		return ErrNotFound
+	}
+	return json.Unmarshal(c.New, dst)
+}
+
+// ChangeFeed is a stream of changes
+type ChangeFeed interface {
+	// Changes delivers the changes in the order they were made, it is closed when the feed ends
+	Changes() <-chan Change
+	// Err returns the error which ended the feed once Changes is closed, nil after Close
+	Err() error
+	// Close stops the feed, it is safe to call more than once
+	Close() error
+}
+
+// WatchOptions configures a ChangeFeed
+type WatchOptions struct {
+	// Buffer is the number of changes held for a slow reader, 256 when 0
+	Buffer int
+}
+
+func (o WatchOptions) buffer() int {
+	if o.Buffer <= 0 {
+		return 256
+	}
+	return o.Buffer
+}
+
+// WatchStore is a store which streams the changes made to its tables
+type WatchStore interface {
+	// Watch streams the inserts, updates and deletes of the rows of a table which match filter,
+	// either before or after the change. A nil filter matches every row
+	Watch(store string, filter map[string]interface{}, opts WatchOptions) (ChangeFeed, error)
+}
+
+// Watch streams the changes to the rows of a table matching filter, looking through decorators
+// which expose the store they wrap. It returns ErrNotImplemented when the store cannot be watched
+func Watch(s ObjectStore, store string, filter map[string]interface{}, opts WatchOptions) (ChangeFeed, error) {
+	for s != nil {
+		if w, ok := s.(WatchStore); ok {
+			return w.Watch(store, filter, opts)
+		}
+		d, ok := s.(interface{ Store() ObjectStore })
+		if !ok {
+			break
+		}
+		s = d.Store()
+	}
+	return nil, ErrNotImplemented
+}
+
+// changeMatches reports whether the row matches expr before or after the change
+func changeMatches(expr *FilterGroup, c Change) bool {
+	if expr == nil || len(expr.Exprs) == 0 {
+		return true
+	}
+	for _, raw := range []json.RawMessage{c.Old, c.New} {
+		var doc map[string]interface{}
+		if raw != nil && json.Unmarshal(raw, &doc) == nil && expr.Match(doc) {
+			return true
+		}
+	}
+	return false
+}
+
+// changeOf describes the write of a row from its old and new JSON
+func changeOf(table, key string, old, new []byte) Change {
+	c := Change{Type: ChangeUpdate, Table: table, Key: key, Old: old, New: new}
+	switch {
+	case old == nil:
+		c.Type = ChangeInsert
+	case new == nil:
+		c.Type = ChangeDelete
+	}
+	return c
+}
+
+// localFeeds holds the feeds of the stores which notify their watchers in process, keyed by the
+// database the stores share. Every store on a database sees the changes made through the others
+var localFeeds = struct {
+	sync.RWMutex
+	feeds map[interface{}]map[*localFeed]bool
+}{feeds: make(map[interface{}]map[*localFeed]bool)}
+
+// localFeed is fed by the writes made in process. Sends never block a writer, a reader which falls
+// behind has its feed closed with ErrChangeFeedOverflow
+type localFeed struct {
+	db     interface{}
+	table  string
+	expr   *FilterGroup
+	mu     sync.Mutex
+	ch     chan Change
+	closed bool
+	err    error
+}
+
+// watchLocal starts a feed of the changes made in process to a table of db
+func watchLocal(db interface{}, store string, filter map[string]interface{}, opts WatchOptions) (ChangeFeed, error) {
+	expr, err := ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	f := &localFeed{db: db, table: store, expr: expr, ch: make(chan Change, opts.buffer())}
+	localFeeds.Lock()
+	defer localFeeds.Unlock()
+	if localFeeds.feeds[db] == nil {
+		localFeeds.feeds[db] = make(map[*localFeed]bool)
+	}
+	localFeeds.feeds[db][f] = true
+	return f, nil
+}
+
+// watchingLocal reports whether a table of db has watchers, so writers only describe their
+// changes when someone reads them
+func watchingLocal(db interface{}, table string) bool {
+	localFeeds.RLock()
+	defer localFeeds.RUnlock()
+	for f := range localFeeds.feeds[db] {
+		if f.table == table {
+			return true
+		}
+	}
+	return false
+}
+
+// publishLocal sends a change to the feeds watching its table of db
+func publishLocal(db interface{}, c Change) {
+	var overflowed []*localFeed
+	localFeeds.RLock()
+	for f := range localFeeds.feeds[db] {
+		if f.table == c.Table && changeMatches(f.expr, c) && !f.offer(c) {
+			overflowed = append(overflowed, f)
+		}
+	}
+	localFeeds.RUnlock()
+	for _, f := range overflowed {
+		f.Close()
+	}
+}
+
+// closeLocal ends the feeds of db, with a nil error, when its store is closed
+func closeLocal(db interface{}) {
+	localFeeds.RLock()
+	var feeds []*localFeed
+	for f := range localFeeds.feeds[db] {
+		feeds = append(feeds, f)
+	}
+	localFeeds.RUnlock()
+	for _, f := range feeds {
+		f.Close()
+	}
+}
+
+// offer sends a change without blocking, it reports false when the feed overflowed
+func (f *localFeed) offer(c Change) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return true
+	}
+	select {
+	case f.ch <- c:
+		return true
+	default:
+		f.err = ErrChangeFeedOverflow
+		f.closed = true
+		close(f.ch)
+		return false
+	}
+}
+
+func (f *localFeed) Changes() <-chan Change {
+	return f.ch
+}
+
+func (f *localFeed) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *localFeed) Close() error {
+	localFeeds.Lock()
+	delete(localFeeds.feeds[f.db], f)
+	if len(localFeeds.feeds[f.db]) == 0 {
+		delete(localFeeds.feeds, f.db)
+	}
+	localFeeds.Unlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.ch)
+	}
+	return nil
+}
+
+// streamFeed is fed by a goroutine reading the change stream of a database server. The goroutine
+// blocks while the reader is behind, leaving the server to buffer the changes
+type streamFeed struct {
+	ch   chan Change
+	done chan struct{}
+	once sync.Once
+	stop func()
+	mu   sync.Mutex
+	err  error
+}
+
+// newStreamFeed runs pump until it returns, its error ends the feed. emit returns false once the
+// feed is closed, stop interrupts a pump blocked on its source
+func newStreamFeed(opts WatchOptions, stop func(), pump func(emit func(Change) bool) error) *streamFeed {
+	f := &streamFeed{ch: make(chan Change, opts.buffer()), done: make(chan struct{}), stop: stop}
+	go func() {
+		err := pump(f.emit)
+		select {
+		case <-f.done:
+			err = nil
+		default:
+		}
+		f.mu.Lock()
+		f.err = err
+		f.mu.Unlock()
+		close(f.ch)
+	}()
+	return f
+}
+
+func (f *streamFeed) emit(c Change) bool {
+	select {
+	case f.ch <- c:
+		return true
+	case <-f.done:
+		return false
+	}
+}
+
+func (f *streamFeed) Changes() <-chan Change {
+	return f.ch
+}
+
+func (f *streamFeed) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *streamFeed) Close() error {
+	f.once.Do(func() {
+		close(f.done)
+		if f.stop != nil {
+			f.stop()
+		}
+	})
+	return nil
+}
@@ -0,0 +1,216 @@
+package gostore
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	r "github.com/gorethink/gorethink"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// nextChange reads a change from a feed, failing when none arrives
+func nextChange(feed ChangeFeed) (c Change) {
+	select {
+	case c = <-feed.Changes():
+	case <-time.After(time.Second):
+		So("no change", ShouldBeEmpty)
+	}
+	return
+}
+
+// noChange checks that a feed holds no pending change
+func noChange(feed ChangeFeed) {
+	select {
+	case c, ok := <-feed.Changes():
+		So(ok, ShouldBeFalse)
+		So(c, ShouldResemble, Change{})
+	default:
+	}
+}
+
+func TestMemoryWatch(t *testing.T) {
+	Convey("Giving a watched memory store", t, func() {
+		store := NewMemoryStore()
+		feed, err := Watch(store, collection, nil, WatchOptions{})
+		So(err, ShouldBeNil)
+		defer feed.Close()
+		Convey("Inserts, updates and deletes are streamed with their rows", func() {
+			_, err := store.Save("1", collection, map[string]interface{}{"id": "1", "kind": "thing"})
+			So(err, ShouldBeNil)
+			So(store.Update("1", collection, map[string]interface{}{"kind": "fish"}), ShouldBeNil)
+			So(store.Delete("1", collection), ShouldBeNil)
+			var doc map[string]interface{}
+			c := nextChange(feed)
+			So(c.Type, ShouldEqual, ChangeInsert)
+			So(c.Key, ShouldEqual, "1")
+			So(c.DecodeOld(&doc), ShouldEqual, ErrNotFound)
+			So(c.DecodeNew(&doc), ShouldBeNil)
+			So(doc["kind"], ShouldEqual, "thing")
+			c = nextChange(feed)
+			So(c.Type, ShouldEqual, ChangeUpdate)
+			So(c.DecodeNew(&doc), ShouldBeNil)
+			So(doc["kind"], ShouldEqual, "fish")
+			c = nextChange(feed)
+			So(c.Type, ShouldEqual, ChangeDelete)
+			So(c.New, ShouldBeNil)
+			noChange(feed)
+		})
+		Convey("Other tables are not streamed", func() {
+			_, err := store.Save("1", "other", map[string]interface{}{"id": "1"})
+			So(err, ShouldBeNil)
+			noChange(feed)
+		})
+		Convey("Filters match the row before or after the change", func() {
+			things, err := store.Watch(collection, map[string]interface{}{"kind": "thing"}, WatchOptions{})
+			So(err, ShouldBeNil)
+			defer things.Close()
+			_, err = store.Save("1", collection, map[string]interface{}{"kind": "fish"})
+			So(err, ShouldBeNil)
+			So(store.Update("1", collection, map[string]interface{}{"kind": "thing"}), ShouldBeNil)
+			So(store.Update("1", collection, map[string]interface{}{"kind": "fish"}), ShouldBeNil)
+			So(nextChange(things).Type, ShouldEqual, ChangeUpdate)
+			c := nextChange(things)
+			var doc map[string]interface{}
+			So(c.DecodeOld(&doc), ShouldBeNil)
+			So(doc["kind"], ShouldEqual, "thing")
+			noChange(things)
+		})
+		Convey("A reader which falls behind has its feed closed", func() {
+			slow, err := store.Watch(collection, nil, WatchOptions{Buffer: 1})
+			So(err, ShouldBeNil)
+			for _, id := range []string{"1", "2"} {
+				_, err = store.Save(id, collection, map[string]interface{}{"id": id})
+				So(err, ShouldBeNil)
+			}
+			So(nextChange(slow).Key, ShouldEqual, "1")
+			_, ok := <-slow.Changes()
+			So(ok, ShouldBeFalse)
+			So(slow.Err(), ShouldEqual, ErrChangeFeedOverflow)
+			So(watchingLocal(store.db, collection), ShouldBeTrue)
+		})
+		Convey("Closing the feed stops it", func() {
+			So(feed.Close(), ShouldBeNil)
+			So(feed.Close(), ShouldBeNil)
+			_, ok := <-feed.Changes()
+			So(ok, ShouldBeFalse)
+			So(feed.Err(), ShouldBeNil)
+			So(watchingLocal(store.db, collection), ShouldBeFalse)
+		})
+		Convey("Decorated stores are watched through", func() {
+			cached := NewCachedStore(store, CacheOptions{})
+			decorated, err := Watch(NewHookedStore(cached), collection, nil, WatchOptions{})
+			So(err, ShouldBeNil)
+			defer decorated.Close()
+			_, err = cached.Save("1", collection, map[string]interface{}{"id": "1"})
+			So(err, ShouldBeNil)
+			So(nextChange(decorated).Key, ShouldEqual, "1")
+			caps, _ := CapabilitiesOf(cached)
+			So(caps.Watch, ShouldBeTrue)
+		})
+	})
+	Convey("Stores which cannot be watched say so", t, func() {
+		_, err := Watch(plainStore{}, collection, nil, WatchOptions{})
+		So(err, ShouldEqual, ErrNotImplemented)
+	})
+}
+
+func TestBoltWatch(t *testing.T) {
+	Convey("Giving a watched bolt store", t, func() {
+		store, done := newTestBoltStore()
+		defer done()
+		feed, err := store.Watch(collection, map[string]interface{}{"kind": "thing"}, WatchOptions{})
+		So(err, ShouldBeNil)
+		defer feed.Close()
+		Convey("Committed writes are streamed", func() {
+			_, err := store.Save("1", collection, map[string]interface{}{"kind": "thing"})
+			So(err, ShouldBeNil)
+			So(store.FilterUpdate(map[string]interface{}{"kind": "thing"}, map[string]interface{}{"rating": 5}, collection, nil), ShouldBeNil)
+			So(store.Delete("1", collection), ShouldBeNil)
+			c := nextChange(feed)
+			So(c.Type, ShouldEqual, ChangeInsert)
+			var doc map[string]interface{}
+			So(c.DecodeNew(&doc), ShouldBeNil)
+			So(doc["id"], ShouldEqual, "1")
+			c = nextChange(feed)
+			So(c.Type, ShouldEqual, ChangeUpdate)
+			So(c.DecodeNew(&doc), ShouldBeNil)
+			So(doc["rating"], ShouldEqual, 5)
+			So(nextChange(feed).Type, ShouldEqual, ChangeDelete)
+		})
+		Convey("Discarded transactions are not streamed", func() {
+			txn, err := store.BeginTransaction()
+			So(err, ShouldBeNil)
+			So(store.SaveTX("1", collection, map[string]interface{}{"kind": "thing"}, txn), ShouldBeNil)
+			noChange(feed)
+			txn.Discard()
+			noChange(feed)
+			txn, err = store.BeginTransaction()
+			So(err, ShouldBeNil)
+			So(store.SaveTX("2", collection, map[string]interface{}{"kind": "thing"}, txn), ShouldBeNil)
+			So(txn.Commit(), ShouldBeNil)
+			So(nextChange(feed).Key, ShouldEqual, "2")
+		})
+		Convey("Stores sharing the database see each other's writes", func() {
+			other := NewBoltStore("other", store.Db)
+			_, err := other.Save("1", collection, map[string]interface{}{"kind": "thing"})
+			So(err, ShouldBeNil)
+			So(nextChange(feed).Key, ShouldEqual, "1")
+		})
+	})
+}
+
+func TestScribbleWatch(t *testing.T) {
+	Convey("Giving a watched scribble store", t, func() {
+		dir, err := ioutil.TempDir("", "gostore-scribble")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		store := NewScribbleStore(dir)
+		feed, err := store.Watch(collection, nil, WatchOptions{})
+		So(err, ShouldBeNil)
+		defer feed.Close()
+		_, err = store.Save("1", collection, map[string]interface{}{"kind": "thing"})
+		So(err, ShouldBeNil)
+		_, err = store.Save("1", collection, map[string]interface{}{"kind": "fish"})
+		So(err, ShouldBeNil)
+		So(store.Delete("1", collection), ShouldBeNil)
+		So(nextChange(feed).Type, ShouldEqual, ChangeInsert)
+		c := nextChange(feed)
+		So(c.Type, ShouldEqual, ChangeUpdate)
+		var doc map[string]interface{}
+		So(c.DecodeOld(&doc), ShouldBeNil)
+		So(doc["kind"], ShouldEqual, "thing")
+		So(nextChange(feed).Type, ShouldEqual, ChangeDelete)
+		store.Close()
+		_, ok := <-feed.Changes()
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestRethinkWatch(t *testing.T) {
+	Convey("Giving a rethink store with a changefeed", t, func() {
+		mock := r.NewMock()
+		query := r.DB("gostore_test").Table(collection).Changes(r.ChangesOpts{IncludeStates: true, IncludeTypes: true})
+		mock.On(query).Return([]interface{}{
+			map[string]interface{}{"type": "state", "state": "ready"},
+			map[string]interface{}{"type": "add", "new_val": map[string]interface{}{"id": "1", "kind": "thing"}},
+			map[string]interface{}{"type": "change", "old_val": map[string]interface{}{"id": "1", "kind": "thing"}, "new_val": map[string]interface{}{"id": "1", "kind": "fish"}},
+			map[string]interface{}{"type": "remove", "old_val": map[string]interface{}{"id": "1", "kind": "fish"}},
+		}, nil).Once()
+		dropped := errors.New("table dropped")
+		mock.On(query).Return(nil, dropped)
+		store := RethinkStore{mock, "gostore_test"}
+		feed, err := store.Watch(collection, nil, WatchOptions{})
+		So(err, ShouldBeNil)
+		defer feed.Close()
+		var types []ChangeType
+		for c := range feed.Changes() {
+			So(c.Key, ShouldEqual, "1")
+			types = append(types, c.Type)
+		}
+		So(types, ShouldResemble, []ChangeType{ChangeInsert, ChangeUpdate, ChangeDelete})
+		So(feed.Err(), ShouldEqual, dropped)
+	})
+}
@@ -0,0 +1,218 @@
+package gostore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrEmptyFilter is returned by a filter write whose empty filter would change every row of the
+// table, set WriteOptions.All to allow it
+var ErrEmptyFilter = errors.New("an empty filter matches every row")
+
+// WriteResult summarises a batch or filter write
+type WriteResult struct {
+	// Matched is the number of rows the write selected
+	Matched int
+	// Inserted is the number of rows the write created
+	Inserted int
+	// Updated is the number of rows an update changed
+	Updated int
+	// Replaced is the number of rows a replace changed
+	Replaced int
+	// Deleted is the number of rows the write removed
+	Deleted int
+	// Unchanged is the number of rows which already held what was written
+	Unchanged int
+	// Skipped is the number of keys of a batch write which have no row
+	Skipped int
+	// Errors is the number of rows the write failed on, FirstError describes the first failure
+	Errors     int
+	FirstError string
+	// Failed holds the key and error of every row the write was not applied to, the keys a batch
+	// update found no row for fail with ErrNotFound. A batch delete skips them without failing
+	Failed []WriteError
+}
+
+// WriteError is the failure to write a row
+type WriteError struct {
+	Key string
+	Err error
+}
+
+func (e WriteError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Key, e.Err)
+}
+
+// fail records the failure to write a row
+func (w *WriteResult) fail(key string, err error) {
+	if err == ErrNotFound {
+		w.Skipped++
+	} else {
+		w.Errors++
+		if w.FirstError == "" {
+			w.FirstError = err.Error()
+		}
+	}
+	w.Failed = append(w.Failed, WriteError{Key: key, Err: err})
+}
+
+// add sums the result of another write into w
+func (w *WriteResult) add(o WriteResult) {
+	w.Matched += o.Matched
+	w.Inserted += o.Inserted
+	w.Updated += o.Updated
+	w.Replaced += o.Replaced
+	w.Deleted += o.Deleted
+	w.Unchanged += o.Unchanged
+	w.Skipped += o.Skipped
+	w.Errors += o.Errors
+	if w.FirstError == "" {
+		w.FirstError = o.FirstError
+	}
+	w.Failed = append(w.Failed, o.Failed...)
+}
+
+// WriteResultStore is a store whose batch and filter writes report the rows they wrote. Each method
+// behaves like the ObjectStore method it is named after, the failures of single rows are listed in
+// the result instead of failing the call
+type WriteResultStore interface {
+	BatchDeleteResult(ids []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error)
+	BatchUpdateResult(ids []interface{}, data []interface{}, store string, opts ObjectStoreOptions) (WriteResult, error)
+	BatchFilterDeleteResult(filter []map[string]interface{}, store string, opts ObjectStoreOptions) (WriteResult, error)
+	FilterDeleteResult(filter map[string]interface{}, store string, opts ObjectStoreOptions) (WriteResult, error)
+	FilterUpdateResult(filter map[string]interface{}, src interface{}, store string, opts ObjectStoreOptions, wopts WriteOptions) (WriteResult, error)
+}
+
+// writeResultStore returns the store a decorator wraps as a WriteResultStore, the decorator's
+// *Result methods fail with ErrNotImplemented when it does not report its writes
+func writeResultStore(store ObjectStore) (WriteResultStore, error) {
+	w, ok := store.(WriteResultStore)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return w, nil
+}
+
+// batchKey returns the key of a row of a batch write
+func batchKey(id interface{}) (string, error) {
+	key, ok := id.(string)
+	if !ok || key == "" {
+		return "", fmt.Errorf("gostore: invalid key %#v", id)
+	}
+	return key, nil
+}
+
+// changeDoc applies change to a row, changed reports whether the result differs from the row. A
+// nil result deletes the row
+func changeDoc(doc map[string]interface{}, change func(doc map[string]interface{}) map[string]interface{}) (_ map[string]interface{}, changed bool, err error) {
+	before, err := json.Marshal(doc)
+	if err != nil {
+		return
+	}
+	if doc = change(doc); doc == nil {
+		return nil, true, nil
+	}
+	after, err := json.Marshal(doc)
+	if err != nil {
+		return
+	}
+	return doc, !bytes.Equal(before, after), nil
+}
+
+// WriteOptions configures a write which reports its result
+type WriteOptions struct {
+	// DryRun counts the rows the write would match and change without writing them
+	DryRun bool
+	// All allows a write with an empty filter to change every row of the table
+	All bool
+}
+
+// UpdateSpec is an update which sets and removes paths of a row instead of merging a document into
+// it. Paths are dotted like filter keys, a set value replaces the value at its path whole
+type UpdateSpec struct {
+	Set   map[string]interface{}
+	Unset []string
+}
+
+// document returns the update as a nested document holding set(value) at the set paths and unset
+// at the removed ones
+func (u UpdateSpec) document(set func(val interface{}) interface{}, unset interface{}) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	for key, val := range u.Set {
+		path, err := parseFilterPath(nil, key)
+		if err != nil {
+			return nil, err
+		}
+		setPath(doc, path, set(val))
+	}
+	for _, key := range u.Unset {
+		path, err := parseFilterPath(nil, key)
+		if err != nil {
+			return nil, err
+		}
+		setPath(doc, path, unset)
+	}
+	return doc, nil
+}
+
+// apply sets and removes the paths of the update in doc
+func (u UpdateSpec) apply(doc map[string]interface{}) map[string]interface{} {
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+	for key, val := range u.Set {
+		setPath(doc, splitFieldPath(key), val)
+	}
+	for _, key := range u.Unset {
+		path := splitFieldPath(key)
+		parent := doc
+		for _, field := range path[:len(path)-1] {
+			if parent, _ = parent[field].(map[string]interface{}); parent == nil {
+				break
+			}
+		}
+		if parent != nil {
+			delete(parent, path[len(path)-1])
+		}
+	}
+	return doc
+}
+
+// setPath stores val at path in doc, replacing whatever is on the way which is not an object
+func setPath(doc map[string]interface{}, path []string, val interface{}) {
+	for _, field := range path[:len(path)-1] {
+		next, ok := doc[field].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			doc[field] = next
+		}
+		doc = next
+	}
+	doc[path[len(path)-1]] = val
+}
+
+// updater returns the function applying an update to a row: an UpdateSpec sets and removes its
+// paths, any other src is a document deep merged into the row
+func updater(src interface{}) (func(doc map[string]interface{}) map[string]interface{}, error) {
+	switch u := src.(type) {
+	case UpdateSpec:
+		return u.apply, u.validate()
+	case *UpdateSpec:
+		return u.apply, u.validate()
+	}
+	update, err := toDoc(src)
+	if err != nil {
+		return nil, err
+	}
+	return func(doc map[string]interface{}) map[string]interface{} {
+		return mergeDocs(doc, update)
+	}, nil
+}
+
+// validate checks the paths of the update
+func (u UpdateSpec) validate() error {
+	_, err := u.document(func(val interface{}) interface{} { return val }, nil)
+	return err
+}
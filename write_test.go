@@ -0,0 +1,37 @@
+package gostore
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUpdateSpec(t *testing.T) {
+	Convey("Giving stores with a row", t, func() {
+		store := NewMemoryStore()
+		_, err := store.Save("1", collection, map[string]interface{}{"id": "1", "kind": "thing", "rating": 5, "food": map[string]interface{}{"type": "egg", "cooked": false}})
+		So(err, ShouldBeNil)
+		Convey("An UpdateSpec sets and removes paths of the matching rows", func() {
+			spec := UpdateSpec{Set: map[string]interface{}{"food.cooked": true, "tags.first": "a"}, Unset: []string{"rating", "food.type", "missing.path"}}
+			So(store.FilterUpdate(map[string]interface{}{"kind": "thing"}, spec, collection, nil), ShouldBeNil)
+			var row map[string]interface{}
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			So(row, ShouldResemble, map[string]interface{}{
+				"id":   "1",
+				"kind": "thing",
+				"food": map[string]interface{}{"cooked": true},
+				"tags": map[string]interface{}{"first": "a"},
+			})
+		})
+		Convey("Set values replace what they are set over", func() {
+			spec := &UpdateSpec{Set: map[string]interface{}{"food": map[string]interface{}{"type": "fish"}}}
+			So(store.FilterUpdate(nil, spec, collection, nil), ShouldBeNil)
+			var row map[string]interface{}
+			So(store.Get("1", collection, &row), ShouldBeNil)
+			So(row["food"], ShouldResemble, map[string]interface{}{"type": "fish"})
+		})
+		Convey("Invalid paths are rejected", func() {
+			So(store.FilterUpdate(nil, UpdateSpec{Unset: []string{"."}}, collection, nil), ShouldNotBeNil)
+		})
+	})
+}